@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"userService/internal/logging"
+	"userService/internal/privacy"
+	"userService/internal/tenant"
+	"userService/internal/user"
+)
+
+// registerAdminUsers adds user routes under /v1/admin/tenants. Unlike the tenant scoped routes
+// they can see soft deleted users, with includeDeleted=true, and restore them.
+func registerAdminUsers(s *mux.Router) {
+	s.HandleFunc("/{tenantId}/users", listAdminUsers).Methods("GET")
+	s.HandleFunc("/{tenantId}/users/{userId}", getAdminUser).Methods("GET")
+	s.HandleFunc("/{tenantId}/users/{userId}/restore", restoreUser).Methods("POST")
+	s.HandleFunc("/{tenantId}/users/{userId}/data", exportUserData).Methods("GET")
+	s.HandleFunc("/{tenantId}/users/{userId}/erase", eraseUser).Methods("POST")
+}
+
+func adminUserContext(request *http.Request) (context.Context, error) {
+	ctx := tenant.WithTenant(request.Context(), mux.Vars(request)["tenantId"])
+
+	if text := request.URL.Query().Get("includeDeleted"); text != "" {
+		include, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, errors.New("includeDeleted must be true or false")
+		}
+		if include {
+			ctx = user.WithDeleted(ctx)
+		}
+	}
+
+	return ctx, nil
+}
+
+func adminUserId(request *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(request)["userId"], 10, 64)
+
+	return id, err == nil
+}
+
+func listAdminUsers(w http.ResponseWriter, request *http.Request) {
+	ctx, err := adminUserContext(request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	offset, limit := pagination(request)
+	users, total, err := user.FindUsers(ctx, bson.M{}, offset, limit)
+	if err != nil {
+		internalError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page{Items: users, Total: total, Offset: offset, Limit: limit})
+}
+
+func getAdminUser(w http.ResponseWriter, request *http.Request) {
+	ctx, err := adminUserContext(request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, ok := adminUserId(request)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "id is not valid")
+		return
+	}
+
+	found, err := user.GetUser(ctx, id)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		internalError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, found)
+}
+
+func restoreUser(w http.ResponseWriter, request *http.Request) {
+	id, ok := adminUserId(request)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "id is not valid")
+		return
+	}
+
+	ctx := tenant.WithTenant(request.Context(), mux.Vars(request)["tenantId"])
+	restored, err := user.RestoreUser(ctx, id)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		writeError(w, http.StatusNotFound, "no deleted user with this id")
+		return
+	}
+	if err != nil {
+		internalError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, restored)
+}
+
+// exportUserData answers a data subject access request with everything stored about the user,
+// as JSON or, with format=zip, as a zip of JSON files.
+func exportUserData(w http.ResponseWriter, request *http.Request) {
+	id, ok := adminUserId(request)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "id is not valid")
+		return
+	}
+
+	format := request.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "zip" {
+		writeError(w, http.StatusBadRequest, "format must be json or zip")
+		return
+	}
+
+	ctx := tenant.WithTenant(request.Context(), mux.Vars(request)["tenantId"])
+	archive, err := privacy.Collect(ctx, id)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		internalError(w, request, err)
+		return
+	}
+
+	filename := "user-" + strconv.FormatInt(id, 10)
+	if format == "zip" {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.zip"`)
+		err = privacy.WriteZip(w, archive)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		err = privacy.WriteJSON(w, archive)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("write user data failed", slog.Any("error", err))
+	}
+}
+
+func eraseUser(w http.ResponseWriter, request *http.Request) {
+	id, ok := adminUserId(request)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "id is not valid")
+		return
+	}
+
+	ctx := tenant.WithTenant(request.Context(), mux.Vars(request)["tenantId"])
+	err := privacy.Erase(ctx, id)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		internalError(w, request, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+	"userService/internal/audit"
+	"userService/internal/tenant"
+)
+
+func registerAudit(s *mux.Router) {
+	s.HandleFunc("/{tenantId}/audit", listAuditEvents).Methods("GET")
+	s.HandleFunc("/{tenantId}/audit/verify", verifyAuditChain).Methods("GET")
+}
+
+// listAuditEvents filters by actor, userId and an RFC 3339 time range from (inclusive) to
+// (exclusive), newest first.
+func listAuditEvents(w http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	filter := audit.Query{Actor: query.Get("actor")}
+
+	if text := query.Get("userId"); text != "" {
+		id, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "userId is not valid")
+			return
+		}
+		filter.UserId = id
+	}
+
+	for name, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if text := query.Get(name); text != "" {
+			parsed, err := time.Parse(time.RFC3339, text)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, name+" must be an RFC 3339 time")
+				return
+			}
+			*target = parsed
+		}
+	}
+
+	offset, limit := pagination(request)
+	ctx := tenant.WithTenant(request.Context(), mux.Vars(request)["tenantId"])
+
+	events, total, err := audit.Find(ctx, filter, offset, limit)
+	if err != nil {
+		internalError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page{Items: events, Total: total, Offset: offset, Limit: limit})
+}
+
+func verifyAuditChain(w http.ResponseWriter, request *http.Request) {
+	ctx := tenant.WithTenant(request.Context(), mux.Vars(request)["tenantId"])
+
+	result, err := audit.Verify(ctx)
+	if err != nil {
+		internalError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"slices"
+	"userService/internal/auth"
+	"userService/internal/group"
+	"userService/internal/user"
+)
+
+// roleAdmin lets a user manage the whole tenant.
+const roleAdmin = "admin"
+
+var (
+	errWatchForbidden      = errors.New("only changes to your own user can be watched")
+	errUserWriteForbidden  = errors.New("only tenant admins can change other users and roles, and only to roles they hold")
+	errUserCreateForbidden = errors.New("only tenant admins can create users, and only with roles they hold")
+)
+
+// caller returns the user making a request, which is false for service and admin tokens and for
+// users that no longer exist or are disabled.
+func caller(ctx context.Context) (user.Data, bool, error) {
+	claims, ok := auth.FromContext(ctx)
+	if !ok || claims.Service != "" {
+		return user.Data{}, false, nil
+	}
+
+	data, err := user.GetUser(ctx, claims.Subject)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return user.Data{}, false, nil
+	}
+	if err != nil {
+		return user.Data{}, false, err
+	}
+
+	return data, !data.Disabled, nil
+}
+
+// isTenantAdmin reports whether the caller may manage the whole tenant: the admin token,
+// service tokens, and users with the admin role. Roles are read from the user rather than the
+// token, so taking a role away applies at once.
+func isTenantAdmin(ctx context.Context) (bool, error) {
+	if claims, ok := auth.FromContext(ctx); ok && claims.Service != "" {
+		return true, nil
+	}
+
+	data, ok, err := caller(ctx)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return slices.Contains(data.Roles, roleAdmin), nil
+}
+
+// isOrganizationAdmin reports whether the caller may manage the organization: tenant admins
+// and members of its admins group.
+func isOrganizationAdmin(ctx context.Context, orgId primitive.ObjectID) (bool, error) {
+	if admin, err := isTenantAdmin(ctx); err != nil || admin {
+		return admin, err
+	}
+
+	data, ok, err := caller(ctx)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return group.IsOrganizationAdmin(ctx, orgId, data.UserId)
+}
+
+// mayManageOrganization is isOrganizationAdmin for an organization id from a request.
+func mayManageOrganization(ctx context.Context, orgId string) (bool, error) {
+	objectId, err := primitive.ObjectIDFromHex(orgId)
+	if err != nil {
+		return false, group.ErrOrganizationNotFound
+	}
+
+	return isOrganizationAdmin(ctx, objectId)
+}
+
+// mayManageGroup reports whether the caller may change the group and its members: admins of its
+// organization, or tenant admins for groups outside of one such as those from SCIM.
+func mayManageGroup(ctx context.Context, groupId string) (bool, error) {
+	found, err := group.GetGroup(ctx, groupId)
+	if err != nil {
+		return false, err
+	}
+	if found.OrgId.IsZero() {
+		return isTenantAdmin(ctx)
+	}
+
+	return isOrganizationAdmin(ctx, found.OrgId)
+}
+
+// grantable reports whether the caller holds all of roles, so that nobody hands out more than
+// they have. Service and admin tokens may grant any role.
+func grantable(ctx context.Context, roles []string) (bool, error) {
+	if claims, ok := auth.FromContext(ctx); ok && claims.Service != "" {
+		return true, nil
+	}
+
+	data, ok, err := caller(ctx)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	for _, role := range roles {
+		if !slices.Contains(data.Roles, role) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// mayCreateUser reports whether the caller may create a user with roles: only tenant admins
+// create users, and only with roles they may grant.
+func mayCreateUser(ctx context.Context, roles []string) (bool, error) {
+	if admin, err := isTenantAdmin(ctx); err != nil || !admin {
+		return false, err
+	}
+
+	return grantable(ctx, roles)
+}
+
+// mayUpdateUser reports whether the caller may change stored into updated. Tenant admins may
+// change any user, other users only the name, email and external id of their own. Roles that
+// are added must be grantable as well.
+func mayUpdateUser(ctx context.Context, stored, updated user.Data) (bool, error) {
+	admin, err := isTenantAdmin(ctx)
+	if err != nil {
+		return false, err
+	}
+	if !admin {
+		data, ok, err := caller(ctx)
+		if err != nil || !ok {
+			return false, err
+		}
+
+		return data.UserId == stored.UserId && updated.Disabled == stored.Disabled && sameRoles(stored.Roles, updated.Roles), nil
+	}
+
+	var added []string
+	for _, role := range updated.Roles {
+		if !slices.Contains(stored.Roles, role) {
+			added = append(added, role)
+		}
+	}
+
+	return grantable(ctx, added)
+}
+
+func sameRoles(a, b []string) bool {
+	for _, role := range a {
+		if !slices.Contains(b, role) {
+			return false
+		}
+	}
+	for _, role := range b {
+		if !slices.Contains(a, role) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// grantableRoles returns the roles the caller may grant, or nil when it may grant any role.
+func grantableRoles(ctx context.Context) ([]string, error) {
+	if claims, ok := auth.FromContext(ctx); ok && claims.Service != "" {
+		return nil, nil
+	}
+
+	data, ok, err := caller(ctx)
+	if err != nil || !ok {
+		return []string{}, err
+	}
+
+	return append([]string{}, data.Roles...), nil
+}
+
+// watchableUsers narrows the users whose changes the caller watches to those it may see:
+// service tokens and admins see every user of the tenant, other users only themselves. An empty
+// result means all users.
+func watchableUsers(ctx context.Context, requested []int64) ([]int64, error) {
+	if claims, ok := auth.FromContext(ctx); ok && claims.Service != "" {
+		return requested, nil
+	}
+
+	data, ok, err := caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errWatchForbidden
+	}
+	if slices.Contains(data.Roles, roleAdmin) {
+		return requested, nil
+	}
+
+	for _, id := range requested {
+		if id != data.UserId {
+			return nil, errWatchForbidden
+		}
+	}
+
+	return []int64{data.UserId}, nil
+}
+
+// requireTenantAdmin limits routes to tenant admins.
+func requireTenantAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		admin, err := isTenantAdmin(request.Context())
+		if err != nil {
+			internalError(w, request, err)
+			return
+		}
+		if !admin {
+			writeError(w, http.StatusForbidden, "tenant admin required")
+			return
+		}
+
+		next.ServeHTTP(w, request)
+	})
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+	"userService/internal/exporter"
+	"userService/internal/logging"
+	"userService/internal/user"
+)
+
+const exportTimeout = 30 * time.Minute
+
+func registerExport(r *mux.Router) {
+	r.Handle("/v1/users/export", requireTenantAdmin(http.HandlerFunc(exportUsers))).Methods("GET")
+}
+
+// exportUsers streams users as they are read from the database. Once the first byte is out the
+// status can no longer change, so a later failure is only logged and the body is cut short.
+func exportUsers(w http.ResponseWriter, request *http.Request) {
+	opts, err := exportOptions(request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filename := "users." + opts.Format
+	contentType := exporter.ContentType(opts.Format)
+	if opts.Gzip {
+		filename += ".gz"
+		contentType = "application/gzip"
+	}
+
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(exportTimeout))
+
+	body := &lazyHeaderWriter{ResponseWriter: w, header: func() {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	}}
+	exported, err := exporter.Export(request.Context(), body, opts)
+
+	logger := logging.FromContext(request.Context())
+	switch {
+	case err == nil:
+		body.start()
+		logger.Info("users exported", slog.Int("users", exported), slog.String("format", opts.Format))
+	case body.started:
+		logger.Error("export failed", slog.Int("users", exported), slog.Any("error", err))
+	case errors.Is(err, exporter.ErrUnknownFormat), errors.Is(err, exporter.ErrInvalidField), errors.Is(err, user.ErrEncryptedFilter):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		internalError(w, request, err)
+	}
+}
+
+func exportOptions(request *http.Request) (exporter.Options, error) {
+	query := request.URL.Query()
+
+	opts := exporter.Options{
+		Format: query.Get("format"),
+		Filter: exporter.Filter{Role: query.Get("role"), Email: query.Get("email"), Name: query.Get("name")},
+	}
+	if opts.Format == "" {
+		opts.Format = exporter.FormatNDJSON
+	}
+
+	var err error
+	if opts.Fields, err = exporter.ParseFields(query.Get("fields")); err != nil {
+		return opts, err
+	}
+
+	if text := query.Get("gzip"); text != "" {
+		if opts.Gzip, err = strconv.ParseBool(text); err != nil {
+			return opts, errors.New("gzip must be true or false")
+		}
+	}
+
+	if text := query.Get("disabled"); text != "" {
+		disabled, err := strconv.ParseBool(text)
+		if err != nil {
+			return opts, errors.New("disabled must be true or false")
+		}
+		opts.Filter.Disabled = &disabled
+	}
+
+	return opts, nil
+}
+
+// lazyHeaderWriter sets the download headers on the first write, so an error before any output
+// can still be answered with a JSON error.
+type lazyHeaderWriter struct {
+	http.ResponseWriter
+	header  func()
+	started bool
+}
+
+func (l *lazyHeaderWriter) start() {
+	if !l.started {
+		l.started = true
+		l.header()
+	}
+}
+
+func (l *lazyHeaderWriter) Write(p []byte) (int, error) {
+	l.start()
+
+	return l.ResponseWriter.Write(p)
+}
@@ -0,0 +1,324 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"strconv"
+	"strings"
+	"userService/internal/group"
+)
+
+type nameRequest struct {
+	Name string `json:"name"`
+}
+
+func registerGroups(r *mux.Router) {
+	r.HandleFunc("/v1/organizations", createOrganization).Methods("POST")
+	r.HandleFunc("/v1/organizations", listOrganizations).Methods("GET")
+	r.HandleFunc("/v1/organizations/{orgId}", getOrganization).Methods("GET")
+	r.HandleFunc("/v1/organizations/{orgId}", renameOrganization).Methods("PUT")
+	r.HandleFunc("/v1/organizations/{orgId}", deleteOrganization).Methods("DELETE")
+	r.HandleFunc("/v1/organizations/{orgId}/groups", createGroup).Methods("POST")
+	r.HandleFunc("/v1/organizations/{orgId}/groups", listOrganizationGroups).Methods("GET")
+
+	r.HandleFunc("/v1/groups/{groupId}", getGroup).Methods("GET")
+	r.HandleFunc("/v1/groups/{groupId}", renameGroup).Methods("PUT")
+	r.HandleFunc("/v1/groups/{groupId}", deleteGroup).Methods("DELETE")
+	r.HandleFunc("/v1/groups/{groupId}/members", listGroupMembers).Methods("GET")
+	r.HandleFunc("/v1/groups/{groupId}/members", addGroupMember).Methods("POST")
+	r.HandleFunc("/v1/groups/{groupId}/members/{type}/{value}", removeGroupMember).Methods("DELETE")
+
+	r.HandleFunc("/v1/users/{userId}/groups", listUserGroups).Methods("GET")
+}
+
+func decodeName(w http.ResponseWriter, request *http.Request) (string, bool) {
+	var body nameRequest
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return "", false
+	}
+
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return "", false
+	}
+
+	return body.Name, true
+}
+
+func writeGroupError(w http.ResponseWriter, request *http.Request, err error) {
+	switch {
+	case errors.Is(err, group.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, group.ErrOrganizationNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, mongo.ErrNoDocuments):
+		writeError(w, http.StatusNotFound, "user not found")
+	case errors.Is(err, group.ErrCycle), errors.Is(err, group.ErrInvalidType):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, group.ErrOrganizationGroup):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		internalError(w, request, err)
+	}
+}
+
+// permitted writes the 403, or the error, when a permission check did not pass.
+func permitted(w http.ResponseWriter, request *http.Request, ok bool, err error, message string) bool {
+	if err != nil {
+		writeGroupError(w, request, err)
+		return false
+	}
+	if !ok {
+		writeError(w, http.StatusForbidden, message)
+		return false
+	}
+
+	return true
+}
+
+func checkOrganizationAdmin(w http.ResponseWriter, request *http.Request) bool {
+	ok, err := mayManageOrganization(request.Context(), mux.Vars(request)["orgId"])
+
+	return permitted(w, request, ok, err, "organization admin required")
+}
+
+func checkGroupManager(w http.ResponseWriter, request *http.Request) bool {
+	ok, err := mayManageGroup(request.Context(), mux.Vars(request)["groupId"])
+
+	return permitted(w, request, ok, err, "organization admin required")
+}
+
+func checkTenantAdmin(w http.ResponseWriter, request *http.Request) bool {
+	ok, err := isTenantAdmin(request.Context())
+
+	return permitted(w, request, ok, err, "tenant admin required")
+}
+
+func createOrganization(w http.ResponseWriter, request *http.Request) {
+	if !checkTenantAdmin(w, request) {
+		return
+	}
+
+	name, ok := decodeName(w, request)
+	if !ok {
+		return
+	}
+
+	org, err := group.CreateOrganization(request.Context(), name)
+	if err != nil {
+		internalError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, org)
+}
+
+func listOrganizations(w http.ResponseWriter, request *http.Request) {
+	offset, limit := pagination(request)
+
+	orgs, total, err := group.ListOrganizations(request.Context(), offset, limit)
+	if err != nil {
+		internalError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page{Items: orgs, Total: total, Offset: offset, Limit: limit})
+}
+
+func getOrganization(w http.ResponseWriter, request *http.Request) {
+	org, err := group.GetOrganization(request.Context(), mux.Vars(request)["orgId"])
+	if err != nil {
+		writeGroupError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, org)
+}
+
+func renameOrganization(w http.ResponseWriter, request *http.Request) {
+	if !checkOrganizationAdmin(w, request) {
+		return
+	}
+
+	name, ok := decodeName(w, request)
+	if !ok {
+		return
+	}
+
+	org, err := group.RenameOrganization(request.Context(), mux.Vars(request)["orgId"], name)
+	if err != nil {
+		writeGroupError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, org)
+}
+
+func deleteOrganization(w http.ResponseWriter, request *http.Request) {
+	if !checkTenantAdmin(w, request) {
+		return
+	}
+
+	if err := group.DeleteOrganization(request.Context(), mux.Vars(request)["orgId"]); err != nil {
+		writeGroupError(w, request, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func createGroup(w http.ResponseWriter, request *http.Request) {
+	if !checkOrganizationAdmin(w, request) {
+		return
+	}
+
+	org, err := group.GetOrganization(request.Context(), mux.Vars(request)["orgId"])
+	if err != nil {
+		writeGroupError(w, request, err)
+		return
+	}
+
+	name, ok := decodeName(w, request)
+	if !ok {
+		return
+	}
+
+	created, err := group.CreateGroup(request.Context(), group.Group{OrgId: org.Id, Name: name})
+	if err != nil {
+		internalError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func listOrganizationGroups(w http.ResponseWriter, request *http.Request) {
+	orgId, err := primitive.ObjectIDFromHex(mux.Vars(request)["orgId"])
+	if err != nil {
+		writeGroupError(w, request, group.ErrOrganizationNotFound)
+		return
+	}
+
+	offset, limit := pagination(request)
+	groups, total, err := group.FindGroups(request.Context(), bson.M{"orgId": orgId}, offset, limit)
+	if err != nil {
+		internalError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page{Items: groups, Total: total, Offset: offset, Limit: limit})
+}
+
+func getGroup(w http.ResponseWriter, request *http.Request) {
+	found, err := group.GetGroup(request.Context(), mux.Vars(request)["groupId"])
+	if err != nil {
+		writeGroupError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, found)
+}
+
+func renameGroup(w http.ResponseWriter, request *http.Request) {
+	if !checkGroupManager(w, request) {
+		return
+	}
+
+	name, ok := decodeName(w, request)
+	if !ok {
+		return
+	}
+
+	renamed, err := group.RenameGroup(request.Context(), mux.Vars(request)["groupId"], name)
+	if err != nil {
+		writeGroupError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, renamed)
+}
+
+func deleteGroup(w http.ResponseWriter, request *http.Request) {
+	if !checkGroupManager(w, request) {
+		return
+	}
+
+	if err := group.DeleteGroup(request.Context(), mux.Vars(request)["groupId"]); err != nil {
+		writeGroupError(w, request, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func listGroupMembers(w http.ResponseWriter, request *http.Request) {
+	offset, limit := pagination(request)
+
+	members, total, err := group.ListMembers(request.Context(), mux.Vars(request)["groupId"], offset, limit)
+	if err != nil {
+		writeGroupError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page{Items: members, Total: total, Offset: offset, Limit: limit})
+}
+
+func addGroupMember(w http.ResponseWriter, request *http.Request) {
+	if !checkGroupManager(w, request) {
+		return
+	}
+
+	var member group.Member
+	if err := json.NewDecoder(request.Body).Decode(&member); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	updated, err := group.AddMember(request.Context(), mux.Vars(request)["groupId"], member)
+	if err != nil {
+		writeGroupError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func removeGroupMember(w http.ResponseWriter, request *http.Request) {
+	if !checkGroupManager(w, request) {
+		return
+	}
+
+	vars := mux.Vars(request)
+	member := group.Member{Type: vars["type"], Value: vars["value"]}
+
+	updated, err := group.RemoveMember(request.Context(), vars["groupId"], member)
+	if err != nil {
+		writeGroupError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func listUserGroups(w http.ResponseWriter, request *http.Request) {
+	userId, err := strconv.ParseInt(mux.Vars(request)["userId"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	groups, err := group.UserGroups(request.Context(), userId)
+	if err != nil {
+		internalError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, groups)
+}
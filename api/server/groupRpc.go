@@ -0,0 +1,225 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	pb "userService/generated/proto"
+	"userService/internal/group"
+)
+
+func groupStatus(err error) error {
+	switch {
+	case errors.Is(err, group.ErrNotFound), errors.Is(err, group.ErrOrganizationNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, group.ErrCycle), errors.Is(err, group.ErrInvalidType):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, group.ErrOrganizationGroup):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	return status.Error(codes.Internal, err.Error())
+}
+
+func organizationMessage(org group.Organization) *pb.Organization {
+	return &pb.Organization{Id: org.Id.Hex(), Name: org.Name, MembersGroupId: org.MembersGroupId.Hex(), AdminsGroupId: org.AdminsGroupId.Hex()}
+}
+
+func groupMessage(model group.Group) *pb.Group {
+	message := &pb.Group{Id: model.Id.Hex(), Name: model.Name}
+	if !model.OrgId.IsZero() {
+		message.OrgId = model.OrgId.Hex()
+	}
+
+	message.Members = memberMessages(model.Members)
+
+	return message
+}
+
+func memberMessages(members []group.Member) []*pb.GroupMember {
+	result := make([]*pb.GroupMember, 0, len(members))
+	for _, member := range members {
+		result = append(result, &pb.GroupMember{Type: member.Type, Value: member.Value})
+	}
+
+	return result
+}
+
+func (s *userServiceServer) CreateOrganization(ctx context.Context, req *pb.CreateOrganizationRequest) (*pb.Organization, error) {
+	if ok, err := isTenantAdmin(ctx); err != nil {
+		return nil, groupStatus(err)
+	} else if !ok {
+		return nil, status.Error(codes.PermissionDenied, "tenant admin required")
+	}
+
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	org, err := group.CreateOrganization(ctx, req.Name)
+	if err != nil {
+		return nil, groupStatus(err)
+	}
+
+	return organizationMessage(org), nil
+}
+
+func (s *userServiceServer) RenameOrganization(ctx context.Context, req *pb.RenameOrganizationRequest) (*pb.Organization, error) {
+	if ok, err := mayManageOrganization(ctx, req.Id); err != nil {
+		return nil, groupStatus(err)
+	} else if !ok {
+		return nil, status.Error(codes.PermissionDenied, "organization admin required")
+	}
+
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	org, err := group.RenameOrganization(ctx, req.Id, req.Name)
+	if err != nil {
+		return nil, groupStatus(err)
+	}
+
+	return organizationMessage(org), nil
+}
+
+func (s *userServiceServer) DeleteOrganization(ctx context.Context, req *pb.DeleteOrganizationRequest) (*pb.DeleteOrganizationResponse, error) {
+	if ok, err := isTenantAdmin(ctx); err != nil {
+		return nil, groupStatus(err)
+	} else if !ok {
+		return nil, status.Error(codes.PermissionDenied, "tenant admin required")
+	}
+
+	if err := group.DeleteOrganization(ctx, req.Id); err != nil {
+		return nil, groupStatus(err)
+	}
+
+	return &pb.DeleteOrganizationResponse{}, nil
+}
+
+func (s *userServiceServer) CreateGroup(ctx context.Context, req *pb.CreateGroupRequest) (*pb.Group, error) {
+	if ok, err := mayManageOrganization(ctx, req.OrgId); err != nil {
+		return nil, groupStatus(err)
+	} else if !ok {
+		return nil, status.Error(codes.PermissionDenied, "organization admin required")
+	}
+
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	org, err := group.GetOrganization(ctx, req.OrgId)
+	if err != nil {
+		return nil, groupStatus(err)
+	}
+
+	created, err := group.CreateGroup(ctx, group.Group{OrgId: org.Id, Name: req.Name})
+	if err != nil {
+		return nil, groupStatus(err)
+	}
+
+	return groupMessage(created), nil
+}
+
+func (s *userServiceServer) RenameGroup(ctx context.Context, req *pb.RenameGroupRequest) (*pb.Group, error) {
+	if ok, err := mayManageGroup(ctx, req.Id); err != nil {
+		return nil, groupStatus(err)
+	} else if !ok {
+		return nil, status.Error(codes.PermissionDenied, "organization admin required")
+	}
+
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	renamed, err := group.RenameGroup(ctx, req.Id, req.Name)
+	if err != nil {
+		return nil, groupStatus(err)
+	}
+
+	return groupMessage(renamed), nil
+}
+
+func (s *userServiceServer) DeleteGroup(ctx context.Context, req *pb.DeleteGroupRequest) (*pb.DeleteGroupResponse, error) {
+	if ok, err := mayManageGroup(ctx, req.Id); err != nil {
+		return nil, groupStatus(err)
+	} else if !ok {
+		return nil, status.Error(codes.PermissionDenied, "organization admin required")
+	}
+
+	if err := group.DeleteGroup(ctx, req.Id); err != nil {
+		return nil, groupStatus(err)
+	}
+
+	return &pb.DeleteGroupResponse{}, nil
+}
+
+func (s *userServiceServer) AddGroupMember(ctx context.Context, req *pb.GroupMemberRequest) (*pb.Group, error) {
+	if ok, err := mayManageGroup(ctx, req.GroupId); err != nil {
+		return nil, groupStatus(err)
+	} else if !ok {
+		return nil, status.Error(codes.PermissionDenied, "organization admin required")
+	}
+
+	if req.Member == nil {
+		return nil, status.Error(codes.InvalidArgument, "member is required")
+	}
+
+	updated, err := group.AddMember(ctx, req.GroupId, group.Member{Type: req.Member.Type, Value: req.Member.Value})
+	if err != nil {
+		return nil, groupStatus(err)
+	}
+
+	return groupMessage(updated), nil
+}
+
+func (s *userServiceServer) RemoveGroupMember(ctx context.Context, req *pb.GroupMemberRequest) (*pb.Group, error) {
+	if ok, err := mayManageGroup(ctx, req.GroupId); err != nil {
+		return nil, groupStatus(err)
+	} else if !ok {
+		return nil, status.Error(codes.PermissionDenied, "organization admin required")
+	}
+
+	if req.Member == nil {
+		return nil, status.Error(codes.InvalidArgument, "member is required")
+	}
+
+	updated, err := group.RemoveMember(ctx, req.GroupId, group.Member{Type: req.Member.Type, Value: req.Member.Value})
+	if err != nil {
+		return nil, groupStatus(err)
+	}
+
+	return groupMessage(updated), nil
+}
+
+func (s *userServiceServer) ListGroupMembers(ctx context.Context, req *pb.ListGroupMembersRequest) (*pb.ListGroupMembersResponse, error) {
+	limit := req.Limit
+	if limit <= 0 || limit > maxPageSize {
+		limit = defaultPageSize
+	}
+
+	members, total, err := group.ListMembers(ctx, req.GroupId, req.Offset, limit)
+	if err != nil {
+		return nil, groupStatus(err)
+	}
+
+	return &pb.ListGroupMembersResponse{Members: memberMessages(members), Total: total}, nil
+}
+
+func (s *userServiceServer) ListUserGroups(ctx context.Context, req *pb.ListUserGroupsRequest) (*pb.ListUserGroupsResponse, error) {
+	groups, err := group.UserGroups(ctx, req.UserId)
+	if err != nil {
+		return nil, groupStatus(err)
+	}
+
+	response := &pb.ListUserGroupsResponse{}
+	for _, model := range groups {
+		response.Groups = append(response.Groups, groupMessage(model))
+	}
+
+	return response, nil
+}
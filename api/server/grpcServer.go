@@ -1,37 +1,335 @@
 package server
 
 import (
+	"bytes"
 	"context"
-	"fmt"
+	"crypto/subtle"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
 	"google.golang.org/grpc"
-	"log"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"log/slog"
 	"net"
+	"strings"
+	"time"
 	pb "userService/generated/proto"
+	"userService/internal/audit"
+	"userService/internal/config"
+	"userService/internal/events"
+	"userService/internal/idempotency"
+	"userService/internal/logging"
+	"userService/internal/privacy"
 	"userService/internal/user"
 )
 
 type userServiceServer struct {
 	pb.UnimplementedUserServiceServer
+	adminToken string
+	// source backs WatchUsers; it is nil while events are disabled.
+	source events.Source
 }
 
-func StartRpc() {
-	lis, err := net.Listen("tcp", ":50051")
+func StartRpc(ctx context.Context, cfg *config.Config, health *Health, source events.Source) error {
+	lis, err := net.Listen("tcp", cfg.GRPCAddr)
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		return err
 	}
 
-	server := grpc.NewServer()
-	pb.RegisterUserServiceServer(server, &userServiceServer{})
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(tracingInterceptor, loggingInterceptor, metricsInterceptor, tenantInterceptor(cfg)),
+		grpc.ChainStreamInterceptor(tracingStreamInterceptor, loggingStreamInterceptor, metricsStreamInterceptor, tenantStreamInterceptor(cfg)),
+	)
+	pb.RegisterUserServiceServer(server, &userServiceServer{adminToken: cfg.AdminToken, source: source})
+	healthpb.RegisterHealthServer(server, health.grpc)
 
-	fmt.Print("grpc server connect success\n")
-	if err := server.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	slog.Info("starting grpc server", slog.String("addr", cfg.GRPCAddr))
+	health.grpcListening.Store(true)
+	health.setGrpcStatus(healthpb.HealthCheckResponse_SERVING)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(lis)
+	}()
+
+	select {
+	case err := <-errs:
+		health.grpcListening.Store(false)
+		return err
+	case <-ctx.Done():
 	}
+
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(cfg.ShutdownTimeout):
+		server.Stop()
+	}
+	health.grpcListening.Store(false)
+
+	return nil
 }
 
 func (s *userServiceServer) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUserResponse, error) {
+	found, err := user.GetUser(ctx, req.UserId)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("get user failed", slog.Any("error", err))
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
 	return &pb.GetUserResponse{
-		UserId: req.UserId,
-		Name:   user.GetUserByID(req.UserId).Name,
+		UserId:  found.UserId,
+		Name:    found.Name,
+		Version: found.Version,
 	}, nil
 }
+
+// CreateUser only stores successful responses for an idempotency key; after an error the key is
+// released and a retry runs again.
+func (s *userServiceServer) CreateUser(ctx context.Context, req *pb.CreateUserRequest) (*pb.User, error) {
+	fields := userFields{Name: req.Name, Email: req.Email, ExternalId: req.ExternalId, Disabled: req.Disabled, Roles: req.Roles}
+	if err := fields.normalize(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if ok, err := mayCreateUser(ctx, fields.Roles); err != nil {
+		return nil, userWriteStatus(ctx, err)
+	} else if !ok {
+		return nil, status.Error(codes.PermissionDenied, errUserCreateForbidden.Error())
+	}
+
+	if req.IdempotencyKey == "" {
+		return createUserMessage(ctx, fields)
+	}
+
+	payload := proto.Clone(req).(*pb.CreateUserRequest)
+	payload.IdempotencyKey = ""
+	body, err := proto.MarshalOptions{Deterministic: true}.Marshal(payload)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	scope := idempotencyScope(ctx, "grpc.CreateUser")
+	stored, err := idempotency.Begin(ctx, scope, req.IdempotencyKey, idempotency.Hash(body))
+	switch {
+	case errors.Is(err, idempotency.ErrInvalidKey):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, idempotency.ErrKeyReused):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, idempotency.ErrInProgress):
+		return nil, status.Error(codes.Aborted, err.Error())
+	case err != nil:
+		logging.FromContext(ctx).Error("begin idempotent request failed", slog.Any("error", err))
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	if stored != nil {
+		var replay pb.User
+		if err := proto.Unmarshal(stored.Response, &replay); err != nil {
+			logging.FromContext(ctx).Error("decode idempotent response failed", slog.Any("error", err))
+			return nil, status.Error(codes.Internal, "internal error")
+		}
+		return &replay, nil
+	}
+
+	created, err := createUserMessage(ctx, fields)
+	storeCtx := context.WithoutCancel(ctx)
+	if err != nil {
+		if releaseErr := idempotency.Release(storeCtx, scope, req.IdempotencyKey); releaseErr != nil {
+			logging.FromContext(ctx).Error("release idempotency key failed", slog.Any("error", releaseErr))
+		}
+		return nil, err
+	}
+
+	response, err := proto.Marshal(created)
+	if err == nil {
+		err = idempotency.Complete(storeCtx, scope, req.IdempotencyKey, created.UserId, 0, "application/x-protobuf", response)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("store idempotent response failed", slog.Any("error", err))
+	}
+
+	return created, nil
+}
+
+func createUserMessage(ctx context.Context, fields userFields) (*pb.User, error) {
+	created, err := user.InsertUser(ctx, user.Data{
+		Name:       fields.Name,
+		Email:      fields.Email,
+		ExternalId: fields.ExternalId,
+		Disabled:   fields.Disabled,
+		Roles:      fields.Roles,
+	})
+	if err != nil {
+		return nil, userWriteStatus(ctx, err)
+	}
+
+	return userMessage(created), nil
+}
+
+func userMessage(data user.Data) *pb.User {
+	return &pb.User{
+		UserId:     data.UserId,
+		Name:       data.Name,
+		Email:      data.Email,
+		ExternalId: data.ExternalId,
+		Disabled:   data.Disabled,
+		Roles:      data.Roles,
+		Version:    data.Version,
+	}
+}
+
+func (s *userServiceServer) UpdateUser(ctx context.Context, req *pb.UpdateUserRequest) (*pb.User, error) {
+	fields := userFields{Name: req.Name, Email: req.Email, ExternalId: req.ExternalId, Disabled: req.Disabled, Roles: req.Roles}
+	if err := fields.normalize(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	stored, err := user.GetUser(ctx, req.UserId)
+	if err != nil {
+		return nil, userWriteStatus(ctx, err)
+	}
+	data := user.Data{
+		UserId:     req.UserId,
+		Name:       fields.Name,
+		Email:      fields.Email,
+		ExternalId: fields.ExternalId,
+		Disabled:   fields.Disabled,
+		Roles:      fields.Roles,
+		Version:    req.ExpectedVersion,
+	}
+	if ok, err := mayUpdateUser(ctx, stored, data); err != nil {
+		return nil, userWriteStatus(ctx, err)
+	} else if !ok {
+		return nil, status.Error(codes.PermissionDenied, errUserWriteForbidden.Error())
+	}
+
+	updated, err := user.UpdateUser(ctx, data)
+	if err != nil {
+		return nil, userWriteStatus(ctx, err)
+	}
+
+	return userMessage(updated), nil
+}
+
+func (s *userServiceServer) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*pb.DeleteUserResponse, error) {
+	if admin, err := isTenantAdmin(ctx); err != nil {
+		return nil, userWriteStatus(ctx, err)
+	} else if !admin {
+		return nil, status.Error(codes.PermissionDenied, "tenant admin required")
+	}
+
+	if err := user.DeleteUser(ctx, req.UserId, req.ExpectedVersion); err != nil {
+		return nil, userWriteStatus(ctx, err)
+	}
+
+	return &pb.DeleteUserResponse{}, nil
+}
+
+func userWriteStatus(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, user.ErrVersionMismatch):
+		return status.Error(codes.Aborted, "user was modified concurrently")
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return status.Error(codes.NotFound, "user not found")
+	case mongo.IsDuplicateKeyError(err):
+		return status.Error(codes.AlreadyExists, "a user with this email already exists")
+	}
+
+	logging.FromContext(ctx).Error("write user failed", slog.Any("error", err))
+	return status.Error(codes.Internal, "internal error")
+}
+
+// CheckUser reports whether a user exists; soft deleted users do not.
+func (s *userServiceServer) CheckUser(ctx context.Context, req *pb.CheckUserRequest) (*pb.CheckUserResponse, error) {
+	_, err := user.GetUser(ctx, req.UserId)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &pb.CheckUserResponse{IsExists: false}, nil
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("check user failed", slog.Any("error", err))
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &pb.CheckUserResponse{IsExists: true}, nil
+}
+
+// requireAdmin checks the admin token in the authorization metadata and marks the admin as the
+// actor of the call.
+func (s *userServiceServer) requireAdmin(ctx context.Context) (context.Context, error) {
+	if s.adminToken == "" {
+		return nil, status.Error(codes.PermissionDenied, "admin api is disabled")
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	token := strings.TrimPrefix(firstMetadata(md, "authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+		return nil, status.Error(codes.Unauthenticated, "admin token required")
+	}
+
+	return audit.WithActor(ctx, "admin"), nil
+}
+
+func (s *userServiceServer) ExportUserData(ctx context.Context, req *pb.ExportUserDataRequest) (*pb.ExportUserDataResponse, error) {
+	ctx, err := s.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Format != "" && req.Format != "json" && req.Format != "zip" {
+		return nil, status.Error(codes.InvalidArgument, "format must be json or zip")
+	}
+
+	archive, err := privacy.Collect(ctx, req.UserId)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("collect user data failed", slog.Any("error", err))
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	var buf bytes.Buffer
+	response := &pb.ExportUserDataResponse{ContentType: "application/json"}
+	if req.Format == "zip" {
+		response.ContentType = "application/zip"
+		err = privacy.WriteZip(&buf, archive)
+	} else {
+		err = privacy.WriteJSON(&buf, archive)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("write user data failed", slog.Any("error", err))
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	response.Archive = buf.Bytes()
+
+	return response, nil
+}
+
+func (s *userServiceServer) EraseUser(ctx context.Context, req *pb.EraseUserRequest) (*pb.EraseUserResponse, error) {
+	ctx, err := s.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = privacy.Erase(ctx, req.UserId)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("erase user failed", slog.Any("error", err))
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &pb.EraseUserResponse{}, nil
+}
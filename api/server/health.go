@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"net/http"
+	"sync/atomic"
+	"time"
+	pb "userService/generated/proto"
+	"userService/internal/user"
+)
+
+const readinessTimeout = 2 * time.Second
+
+// Health tracks what the probes report: whether both servers are listening and whether the
+// process has started shutting down. It also owns the gRPC health service.
+type Health struct {
+	httpListening atomic.Bool
+	grpcListening atomic.Bool
+	draining      atomic.Bool
+	grpc          *health.Server
+}
+
+type readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+func NewHealth() *Health {
+	h := &Health{grpc: health.NewServer()}
+	h.setGrpcStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+
+	return h
+}
+
+func (h *Health) setGrpcStatus(status healthpb.HealthCheckResponse_ServingStatus) {
+	h.grpc.SetServingStatus("", status)
+	h.grpc.SetServingStatus(pb.UserService_ServiceDesc.ServiceName, status)
+}
+
+// Drain makes readiness fail and reports NOT_SERVING over gRPC so that load balancers stop
+// routing new requests before the servers close.
+func (h *Health) Drain() {
+	h.draining.Store(true)
+	h.grpc.Shutdown()
+}
+
+func (h *Health) register(r *mux.Router) {
+	r.HandleFunc("/healthz", h.live).Methods("GET")
+	r.HandleFunc("/readyz", h.ready).Methods("GET")
+}
+
+func (h *Health) live(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *Health) ready(w http.ResponseWriter, request *http.Request) {
+	result := readiness{Status: "ready", Checks: map[string]string{}}
+	check := func(name string, ok bool, reason string) {
+		if ok {
+			result.Checks[name] = "ok"
+			return
+		}
+
+		result.Status = "unavailable"
+		result.Checks[name] = reason
+	}
+
+	check("shutdown", !h.draining.Load(), "draining")
+	check("http", h.httpListening.Load(), "not listening")
+	check("grpc", h.grpcListening.Load(), "not listening")
+
+	ctx, cancel := context.WithTimeout(request.Context(), readinessTimeout)
+	defer cancel()
+
+	err := user.Ping(ctx)
+	check("mongo", err == nil, "unreachable")
+
+	status := http.StatusOK
+	if result.Status != "ready" {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, result)
+}
@@ -1,89 +1,168 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"github.com/gorilla/mux"
-	"log"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log/slog"
+	"net"
 	"net/http"
 	"strconv"
 	"time"
+	"userService/internal/config"
+	"userService/internal/events"
+	"userService/internal/oidc"
 	"userService/internal/user"
 )
 
-func StartServer() {
+func StartServer(ctx context.Context, cfg *config.Config, health *Health, source events.Source) error {
 	r := mux.NewRouter()
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	health.register(r)
 
-	r.HandleFunc("/createUser", createUser).Methods("POST")
-	r.HandleFunc("/getUsers", getUsers).Methods("GET")
-	r.HandleFunc("/getUser", getUserById).Methods("GET")
+	if cfg.AdminToken != "" {
+		registerTenantAdmin(r, cfg)
+	}
+
+	if cfg.OIDC.Enabled() {
+		provider, err := oidc.NewProvider(ctx, cfg.OIDC, nil)
+		if err != nil {
+			return err
+		}
+
+		handler := &oidcHandler{provider: provider, config: cfg}
+		r.HandleFunc("/auth/oidc/login", handler.login).Methods("GET")
+		r.HandleFunc("/auth/oidc/callback", handler.callback).Methods("GET")
+	}
+
+	registerInvitationAccept(r)
+
+	streams, stopStreams := context.WithCancel(context.Background())
+	defer stopStreams()
+
+	scoped := r.PathPrefix("/").Subrouter()
+	scoped.Use(tenantMiddleware(cfg))
+
+	scoped.Handle("/createUser", idempotent("createUser", http.HandlerFunc(createUser))).Methods("POST")
+	scoped.HandleFunc("/getUsers", getUsers).Methods("GET")
+	scoped.HandleFunc("/getUser", getUserById).Methods("GET")
+	registerImport(scoped)
+	registerExport(scoped)
+	registerUserEvents(scoped, source, streams)
+	registerUsers(scoped)
+	registerGroups(scoped)
+	registerInvitations(scoped, cfg, newMailer(cfg))
+
+	if cfg.SCIMEnabled {
+		registerScim(scoped)
+	}
+	if cfg.Webhooks.Enabled {
+		registerWebhooks(scoped)
+	}
 
 	server := &http.Server{
-		Addr:         ":8080",
-		Handler:      r,
+		Addr:         cfg.HTTPAddr,
+		Handler:      tracingMiddleware(r)(loggingMiddleware(metricsMiddleware(r)(r))),
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 	}
+	server.RegisterOnShutdown(stopStreams)
 
-	log.Printf("Starting server on port 8080")
+	listener, err := net.Listen("tcp", cfg.HTTPAddr)
+	if err != nil {
+		return err
+	}
 
-	err := server.ListenAndServe()
+	slog.Info("starting http server", slog.String("addr", cfg.HTTPAddr))
+	health.httpListening.Store(true)
 
-	if err != nil {
-		log.Fatal(err, "Error starting server on port 8080")
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-errs:
+		health.httpListening.Store(false)
+		return err
+	case <-ctx.Done():
 	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	err = server.Shutdown(shutdownCtx)
+	health.httpListening.Store(false)
+
+	return err
 }
 
 func getUserById(w http.ResponseWriter, request *http.Request) {
 	id := request.URL.Query().Get("id")
 
 	if id == "" {
-		log.Fatal("id is not valid")
-
+		writeError(w, http.StatusBadRequest, "id is not valid")
 		return
 	}
 
 	intId, err := strconv.ParseInt(id, 10, 64)
 
 	if err != nil {
-		log.Fatal(err)
+		writeError(w, http.StatusBadRequest, "id is not valid")
 		return
 	}
 
-	data := user.GetUserByID(intId)
-	errEncoder := json.NewEncoder(w).Encode(&data)
-
-	if errEncoder != nil {
-		log.Fatal(errEncoder)
+	data, err := user.GetUser(request.Context(), intId)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		internalError(w, request, err)
 		return
 	}
-}
 
-func getUsers(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, http.StatusOK, data)
+}
 
-	err := json.NewEncoder(w).Encode(user.GetUsers())
+func getUsers(w http.ResponseWriter, request *http.Request) {
+	users, err := user.GetUsers(request.Context())
 	if err != nil {
-		log.Fatal(err)
+		internalError(w, request, err)
 		return
 	}
+
+	writeJSON(w, http.StatusOK, users)
 }
 
 func createUser(w http.ResponseWriter, request *http.Request) {
-
-	w.Header().Set("Content-Type", "application/json")
 	var data user.Data
 	err := json.NewDecoder(request.Body).Decode(&data)
 	if err != nil {
-		log.Fatal(w, err)
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
 	}
 
-	result := user.CreateUser(data)
-	encoderErr := json.NewEncoder(w).Encode(map[string]interface{}{
+	if ok, err := mayCreateUser(request.Context(), data.Roles); err != nil {
+		internalError(w, request, err)
+		return
+	} else if !ok {
+		writeError(w, http.StatusForbidden, errUserCreateForbidden.Error())
+		return
+	}
+
+	created, result, err := user.CreateUser(request.Context(), data)
+	if err != nil {
+		internalError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"message": "User created successfully",
 		"id":      result.InsertedID,
+		"userId":  created.UserId,
 	})
-	if encoderErr != nil {
-		log.Fatal(encoderErr)
-		return
-	}
 }
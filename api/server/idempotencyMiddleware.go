@@ -0,0 +1,117 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"userService/internal/auth"
+	"userService/internal/idempotency"
+	"userService/internal/logging"
+)
+
+const maxIdempotentBody = 1 << 20
+
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (c *responseCapture) WriteHeader(status int) {
+	c.status = status
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *responseCapture) Write(data []byte) (int, error) {
+	c.body.Write(data)
+
+	return c.ResponseWriter.Write(data)
+}
+
+// userId is the id of the user a JSON response describes, if any, so that erasing the user also
+// drops the stored response.
+func (c *responseCapture) userId() int64 {
+	var described struct {
+		UserId int64 `json:"userId"`
+	}
+	_ = json.Unmarshal(c.body.Bytes(), &described)
+
+	return described.UserId
+}
+
+// idempotencyScope gives every caller its own keys within the tenant, so that a stored
+// response is only ever replayed to the caller that made the request.
+func idempotencyScope(ctx context.Context, scope string) string {
+	claims, _ := auth.FromContext(ctx)
+	if claims.Service != "" {
+		return scope + ":" + claims.Service
+	}
+
+	return scope + ":" + strconv.FormatInt(claims.Subject, 10)
+}
+
+// idempotent replays the stored response when a request repeats the Idempotency-Key of an
+// earlier one with the same body. Requests without the header run as usual.
+func idempotent(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		key := request.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, request)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, request.Body, maxIdempotentBody))
+		if err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, "request body is too large")
+			return
+		}
+
+		ctx := request.Context()
+		scope := idempotencyScope(ctx, scope)
+		stored, err := idempotency.Begin(ctx, scope, key, idempotency.Hash(body))
+		switch {
+		case errors.Is(err, idempotency.ErrInvalidKey):
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		case errors.Is(err, idempotency.ErrKeyReused):
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		case errors.Is(err, idempotency.ErrInProgress):
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		case err != nil:
+			internalError(w, request, err)
+			return
+		}
+
+		if stored != nil {
+			if stored.ContentType != "" {
+				w.Header().Set("Content-Type", stored.ContentType)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.Status)
+			_, _ = w.Write(stored.Response)
+			return
+		}
+
+		request.Body = io.NopCloser(bytes.NewReader(body))
+		capture := &responseCapture{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(capture, request)
+
+		// The outcome is stored even if the client went away, since that is when it retries.
+		ctx = context.WithoutCancel(ctx)
+		if capture.status >= http.StatusInternalServerError {
+			err = idempotency.Release(ctx, scope, key)
+		} else {
+			err = idempotency.Complete(ctx, scope, key, capture.userId(), capture.status, capture.Header().Get("Content-Type"), capture.body.Bytes())
+		}
+		if err != nil {
+			logging.FromContext(ctx).Error("store idempotent response failed", slog.Any("error", err))
+		}
+	})
+}
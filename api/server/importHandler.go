@@ -0,0 +1,91 @@
+package server
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+	"userService/internal/importer"
+	"userService/internal/logging"
+)
+
+const (
+	maxImportBytes = 32 << 20
+	maxImportRows  = 100000
+	importTimeout  = 5 * time.Minute
+)
+
+func registerImport(r *mux.Router) {
+	r.Handle("/v1/users/import", requireTenantAdmin(http.HandlerFunc(importUsers))).Methods("POST")
+}
+
+// importUsers takes the format from the format query parameter or the Content-Type, and only
+// validates when dryRun=true.
+func importUsers(w http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = importFormat(request.Header.Get("Content-Type"))
+	}
+
+	dryRun, err := strconv.ParseBool(query.Get("dryRun"))
+	if err != nil && query.Get("dryRun") != "" {
+		writeError(w, http.StatusBadRequest, "dryRun must be true or false")
+		return
+	}
+
+	roles, err := grantableRoles(request.Context())
+	if err != nil {
+		internalError(w, request, err)
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	_ = controller.SetReadDeadline(time.Now().Add(importTimeout))
+	_ = controller.SetWriteDeadline(time.Now().Add(importTimeout))
+
+	body := http.MaxBytesReader(w, request.Body, maxImportBytes)
+	report, err := importer.Import(request.Context(), body, importer.Options{
+		Format:  format,
+		DryRun:  dryRun,
+		MaxRows: maxImportRows,
+		// Nobody may hand out roles they do not hold, like with invitations.
+		GrantableRoles: roles,
+	})
+
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, report)
+	case errors.As(err, &tooLarge), errors.Is(err, importer.ErrTooManyRows):
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, importer.ErrUnknownFormat), errors.Is(err, importer.ErrInvalidInput):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		// Earlier batches may already be written, so the client gets the report to resume from.
+		logging.FromContext(request.Context()).Error("import failed", slog.Any("error", err))
+		writeJSON(w, http.StatusInternalServerError, importFailure{Error: "internal error", Report: report})
+	}
+}
+
+type importFailure struct {
+	Error  string          `json:"error"`
+	Report importer.Report `json:"report"`
+}
+
+func importFormat(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case "text/csv":
+		return importer.FormatCSV
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return importer.FormatNDJSON
+	}
+
+	return ""
+}
@@ -0,0 +1,250 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"net/mail"
+	"strings"
+	"userService/internal/config"
+	"userService/internal/group"
+	"userService/internal/invitation"
+)
+
+type invitationHandler struct {
+	config *config.Config
+	mailer invitation.Mailer
+}
+
+// sentInvitation carries the accept link back to the inviting admin when no mailer delivers it.
+type sentInvitation struct {
+	invitation.Invitation
+	AcceptURL string `json:"acceptUrl,omitempty"`
+}
+
+type createInvitationRequest struct {
+	Email string   `json:"email"`
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+}
+
+type acceptInvitationRequest struct {
+	Token string `json:"token"`
+	Name  string `json:"name"`
+}
+
+// registerInvitationAccept adds the accept endpoint, which is called by invitees without a
+// tenant and so must be registered outside the tenant-scoped router.
+func registerInvitationAccept(r *mux.Router) {
+	h := &invitationHandler{}
+
+	r.HandleFunc("/v1/invitations/accept", h.accept).Methods("POST")
+}
+
+func registerInvitations(scoped *mux.Router, cfg *config.Config, mailer invitation.Mailer) {
+	h := &invitationHandler{config: cfg, mailer: mailer}
+
+	scoped.HandleFunc("/v1/organizations/{orgId}/invitations", h.create).Methods("POST")
+	scoped.HandleFunc("/v1/organizations/{orgId}/invitations", h.listPending).Methods("GET")
+	scoped.HandleFunc("/v1/invitations/{invitationId}", h.get).Methods("GET")
+	scoped.HandleFunc("/v1/invitations/{invitationId}/resend", h.resend).Methods("POST")
+	scoped.HandleFunc("/v1/invitations/{invitationId}", h.revoke).Methods("DELETE")
+}
+
+func newMailer(cfg *config.Config) invitation.Mailer {
+	if cfg.SMTPAddr == "" {
+		return invitation.LogMailer{}
+	}
+
+	return invitation.SMTPMailer{Addr: cfg.SMTPAddr, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword, From: cfg.InvitationFrom}
+}
+
+func writeInvitationError(w http.ResponseWriter, request *http.Request, err error) {
+	switch {
+	case errors.Is(err, invitation.ErrNotFound), errors.Is(err, group.ErrOrganizationNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, invitation.ErrAlreadyInvited), errors.Is(err, invitation.ErrUserExists), errors.Is(err, invitation.ErrNotPending):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, invitation.ErrExpired):
+		writeError(w, http.StatusGone, err.Error())
+	default:
+		internalError(w, request, err)
+	}
+}
+
+// authorize lets only admins of the organization manage its invitations.
+func (h *invitationHandler) authorize(w http.ResponseWriter, request *http.Request, orgId primitive.ObjectID) bool {
+	admin, err := isOrganizationAdmin(request.Context(), orgId)
+	if err != nil {
+		writeInvitationError(w, request, err)
+		return false
+	}
+	if !admin {
+		writeError(w, http.StatusForbidden, "organization admin required")
+		return false
+	}
+
+	return true
+}
+
+// load returns the invitation in the path if the caller may manage it.
+func (h *invitationHandler) load(w http.ResponseWriter, request *http.Request) (invitation.Invitation, bool) {
+	found, err := invitation.Get(request.Context(), mux.Vars(request)["invitationId"])
+	if err != nil {
+		writeInvitationError(w, request, err)
+		return invitation.Invitation{}, false
+	}
+
+	return found, h.authorize(w, request, found.OrgId)
+}
+
+func (h *invitationHandler) create(w http.ResponseWriter, request *http.Request) {
+	org, err := group.GetOrganization(request.Context(), mux.Vars(request)["orgId"])
+	if err != nil {
+		writeInvitationError(w, request, err)
+		return
+	}
+	if !h.authorize(w, request, org.Id) {
+		return
+	}
+
+	var body createInvitationRequest
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	address, err := mail.ParseAddress(body.Email)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid email")
+		return
+	}
+
+	for _, role := range body.Roles {
+		if strings.TrimSpace(role) == "" {
+			writeError(w, http.StatusBadRequest, "roles must not be empty")
+			return
+		}
+	}
+	// Without roles the invitation grants the default roles, which anyone may hand out.
+	if ok, err := grantable(request.Context(), body.Roles); err != nil {
+		internalError(w, request, err)
+		return
+	} else if !ok {
+		writeError(w, http.StatusForbidden, "only roles you hold can be granted")
+		return
+	}
+
+	created, token, err := invitation.Create(request.Context(), invitation.Invitation{
+		OrgId: org.Id,
+		Email: strings.ToLower(address.Address),
+		Name:  body.Name,
+		Roles: body.Roles,
+	}, h.config.InvitationTTL)
+	if err != nil {
+		writeInvitationError(w, request, err)
+		return
+	}
+
+	sent, ok := h.send(w, request, created, token)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, sent)
+}
+
+func (h *invitationHandler) send(w http.ResponseWriter, request *http.Request, sent invitation.Invitation, token string) (sentInvitation, bool) {
+	acceptURL := invitation.AcceptURL(h.config.InvitationURL, token)
+	if err := h.mailer.SendInvitation(request.Context(), sent, acceptURL); err != nil {
+		internalError(w, request, err)
+		return sentInvitation{}, false
+	}
+
+	if invitation.Delivers(h.mailer) {
+		return sentInvitation{Invitation: sent}, true
+	}
+
+	return sentInvitation{Invitation: sent, AcceptURL: acceptURL}, true
+}
+
+func (h *invitationHandler) listPending(w http.ResponseWriter, request *http.Request) {
+	org, err := group.GetOrganization(request.Context(), mux.Vars(request)["orgId"])
+	if err != nil {
+		writeInvitationError(w, request, err)
+		return
+	}
+	if !h.authorize(w, request, org.Id) {
+		return
+	}
+
+	offset, limit := pagination(request)
+	invitations, total, err := invitation.ListPending(request.Context(), org.Id, offset, limit)
+	if err != nil {
+		internalError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page{Items: invitations, Total: total, Offset: offset, Limit: limit})
+}
+
+func (h *invitationHandler) get(w http.ResponseWriter, request *http.Request) {
+	found, ok := h.load(w, request)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, found)
+}
+
+func (h *invitationHandler) resend(w http.ResponseWriter, request *http.Request) {
+	found, ok := h.load(w, request)
+	if !ok {
+		return
+	}
+
+	updated, token, err := invitation.Resend(request.Context(), found.Id.Hex(), h.config.InvitationTTL)
+	if err != nil {
+		writeInvitationError(w, request, err)
+		return
+	}
+
+	sent, ok := h.send(w, request, updated, token)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sent)
+}
+
+func (h *invitationHandler) revoke(w http.ResponseWriter, request *http.Request) {
+	found, ok := h.load(w, request)
+	if !ok {
+		return
+	}
+
+	if err := invitation.Revoke(request.Context(), found.Id.Hex()); err != nil {
+		writeInvitationError(w, request, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *invitationHandler) accept(w http.ResponseWriter, request *http.Request) {
+	var body acceptInvitationRequest
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil || body.Token == "" {
+		writeError(w, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	created, err := invitation.Accept(request.Context(), body.Token, strings.TrimSpace(body.Name))
+	if err != nil {
+		writeInvitationError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, created)
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+	"userService/internal/audit"
+	"userService/internal/logging"
+	"userService/internal/tenant"
+)
+
+const requestIdHeader = "X-Request-ID"
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func requestLogger(ctx context.Context, requestId string) (context.Context, *slog.Logger) {
+	logger := slog.Default().With(slog.String("request_id", requestId))
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		logger = logger.With(slog.String("trace_id", spanContext.TraceID().String()))
+	}
+	ctx = logging.WithRequestId(ctx, requestId)
+
+	return logging.WithLogger(ctx, logger), logger
+}
+
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		started := time.Now()
+
+		requestId := request.Header.Get(requestIdHeader)
+		if !logging.ValidRequestId(requestId) {
+			requestId = logging.NewRequestId()
+		}
+		w.Header().Set(requestIdHeader, requestId)
+
+		ctx, logger := requestLogger(request.Context(), requestId)
+		ctx = audit.WithSourceIP(ctx, remoteHost(request.RemoteAddr))
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, request.WithContext(ctx))
+
+		logger.Info("http request",
+			slog.String("method", request.Method),
+			slog.String("path", request.URL.Path),
+			slog.Int("status", recorder.status),
+			slog.Duration("duration", time.Since(started)),
+			slog.String("remote_addr", request.RemoteAddr),
+		)
+	})
+}
+
+// tenantLogger adds the resolved tenant to the request logger once it is known.
+func tenantLogger(ctx context.Context) context.Context {
+	if tenantId, ok := tenant.FromContext(ctx); ok {
+		return logging.WithLogger(ctx, logging.FromContext(ctx).With(slog.String("tenant", tenantId)))
+	}
+
+	return ctx
+}
+
+func loggingInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	started := time.Now()
+
+	ctx, logger, requestId := rpcLogger(ctx)
+	_ = grpc.SetHeader(ctx, metadata.Pairs("x-request-id", requestId))
+	response, err := handler(ctx, req)
+
+	logger.Info("grpc request",
+		slog.String("method", info.FullMethod),
+		slog.String("code", status.Code(err).String()),
+		slog.Duration("duration", time.Since(started)),
+	)
+
+	return response, err
+}
+
+// loggingStreamInterceptor logs a stream once it ends, which for watches can be much later than
+// it started.
+func loggingStreamInterceptor(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	started := time.Now()
+
+	ctx, logger, requestId := rpcLogger(stream.Context())
+	_ = stream.SetHeader(metadata.Pairs("x-request-id", requestId))
+	err := handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+
+	logger.Info("grpc stream",
+		slog.String("method", info.FullMethod),
+		slog.String("code", status.Code(err).String()),
+		slog.Duration("duration", time.Since(started)),
+	)
+
+	return err
+}
+
+// rpcLogger takes the request id from the call metadata, or makes one up, and sets up the
+// request logger and source address like loggingMiddleware does for HTTP.
+func rpcLogger(ctx context.Context) (context.Context, *slog.Logger, string) {
+	requestId := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		requestId = firstMetadata(md, "x-request-id")
+	}
+	if !logging.ValidRequestId(requestId) {
+		requestId = logging.NewRequestId()
+	}
+
+	ctx, logger := requestLogger(ctx, requestId)
+	if client, ok := peer.FromContext(ctx); ok {
+		ctx = audit.WithSourceIP(ctx, remoteHost(client.Addr.String()))
+	}
+
+	return ctx, logger, requestId
+}
+
+func remoteHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"strconv"
+	"time"
+	"userService/internal/metrics"
+)
+
+// metricsMiddleware labels requests by route template rather than raw path so that ids in the
+// URL do not create a new series per request.
+func metricsMiddleware(router *mux.Router) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+			started := time.Now()
+			route := routeTemplate(router, request)
+
+			metrics.HTTPInFlight.Inc()
+			defer metrics.HTTPInFlight.Dec()
+
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, request)
+
+			metrics.HTTPRequests.WithLabelValues(route, request.Method, strconv.Itoa(recorder.status)).Inc()
+			metrics.HTTPDuration.WithLabelValues(route, request.Method).Observe(time.Since(started).Seconds())
+		})
+	}
+}
+
+func routeTemplate(router *mux.Router, request *http.Request) string {
+	var match mux.RouteMatch
+	if !router.Match(request, &match) || match.Route == nil {
+		return "unmatched"
+	}
+
+	template, err := match.Route.GetPathTemplate()
+	if err != nil {
+		return "unmatched"
+	}
+
+	return template
+}
+
+func metricsInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	started := time.Now()
+
+	metrics.GRPCInFlight.Inc()
+	defer metrics.GRPCInFlight.Dec()
+
+	response, err := handler(ctx, req)
+
+	metrics.GRPCRequests.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+	metrics.GRPCDuration.WithLabelValues(info.FullMethod).Observe(time.Since(started).Seconds())
+
+	return response, err
+}
+
+func metricsStreamInterceptor(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	started := time.Now()
+
+	metrics.GRPCInFlight.Inc()
+	defer metrics.GRPCInFlight.Dec()
+
+	err := handler(srv, stream)
+
+	metrics.GRPCRequests.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+	metrics.GRPCDuration.WithLabelValues(info.FullMethod).Observe(time.Since(started).Seconds())
+
+	return err
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"userService/internal/auth"
+	"userService/internal/config"
+	"userService/internal/group"
+	"userService/internal/logging"
+	"userService/internal/oidc"
+	"userService/internal/tenant"
+)
+
+const (
+	oidcStateCookie  = "oidc_state"
+	oidcNonceCookie  = "oidc_nonce"
+	oidcTenantCookie = "oidc_tenant"
+)
+
+type oidcHandler struct {
+	provider *oidc.Provider
+	config   *config.Config
+}
+
+func (h *oidcHandler) login(w http.ResponseWriter, request *http.Request) {
+	tenantId := request.URL.Query().Get("tenant")
+	if tenantId == "" {
+		tenantId = h.config.DefaultTenant
+	}
+	if tenantId == "" {
+		writeTenantError(w, request, errTenantRequired)
+		return
+	}
+	if err := checkTenant(request.Context(), tenantId); err != nil {
+		writeTenantError(w, request, err)
+		return
+	}
+
+	state := oidc.RandomString()
+	nonce := oidc.RandomString()
+
+	setOidcCookie(w, request, oidcStateCookie, state)
+	setOidcCookie(w, request, oidcNonceCookie, nonce)
+	setOidcCookie(w, request, oidcTenantCookie, tenantId)
+
+	http.Redirect(w, request, h.provider.AuthCodeURL(state, nonce), http.StatusFound)
+}
+
+func (h *oidcHandler) callback(w http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+
+	if providerErr := query.Get("error"); providerErr != "" {
+		http.Error(w, "oidc login failed: "+providerErr, http.StatusUnauthorized)
+		return
+	}
+
+	state, err := request.Cookie(oidcStateCookie)
+	if err != nil || state.Value == "" || state.Value != query.Get("state") {
+		http.Error(w, "invalid oidc state", http.StatusBadRequest)
+		return
+	}
+
+	nonce, err := request.Cookie(oidcNonceCookie)
+	if err != nil || nonce.Value == "" {
+		http.Error(w, "invalid oidc nonce", http.StatusBadRequest)
+		return
+	}
+
+	tenantCookie, err := request.Cookie(oidcTenantCookie)
+	if err != nil {
+		http.Error(w, "invalid oidc tenant", http.StatusBadRequest)
+		return
+	}
+
+	tenantId := tenantCookie.Value
+	if err := checkTenant(request.Context(), tenantId); err != nil {
+		writeTenantError(w, request, err)
+		return
+	}
+	ctx := tenant.WithTenant(request.Context(), tenantId)
+
+	clearOidcCookie(w, oidcStateCookie)
+	clearOidcCookie(w, oidcNonceCookie)
+	clearOidcCookie(w, oidcTenantCookie)
+
+	idToken, err := h.provider.Exchange(ctx, query.Get("code"), nonce.Value)
+	if err != nil {
+		logging.FromContext(ctx).Error("oidc exchange failed", slog.Any("error", err))
+		http.Error(w, "oidc login failed", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := oidc.SignIn(ctx, h.provider.Issuer(), idToken)
+	if errors.Is(err, oidc.ErrUserDisabled) || errors.Is(err, oidc.ErrUserDeleted) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("oidc sign in failed", slog.Any("error", err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	groups, err := group.UserGroups(ctx, result.User.UserId)
+	if err != nil {
+		logging.FromContext(ctx).Error("load groups failed", slog.Any("error", err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	claims := auth.Claims{Subject: result.User.UserId, Tenant: tenantId, Email: result.User.Email}
+	for _, g := range groups {
+		claims.Groups = append(claims.Groups, g.Id.Hex())
+	}
+
+	token, err := auth.Issue(h.config.AuthSecret, claims, h.config.TokenTTL)
+	if err != nil {
+		logging.FromContext(ctx).Error("issue token failed", slog.Any("error", err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoderErr := json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":   token,
+		"user":    result.User,
+		"created": result.Created,
+		"linked":  result.Linked,
+	})
+	if encoderErr != nil {
+		logging.FromContext(ctx).Warn("encode response failed", slog.Any("error", encoderErr))
+	}
+}
+
+func setOidcCookie(w http.ResponseWriter, request *http.Request, name, value string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/auth/oidc",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   request.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearOidcCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{Name: name, Path: "/auth/oidc", MaxAge: -1, HttpOnly: true})
+}
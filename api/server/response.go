@@ -0,0 +1,58 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"userService/internal/logging"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+type page struct {
+	Items  any   `json:"items"`
+	Total  int64 `json:"total"`
+	Offset int64 `json:"offset"`
+	Limit  int64 `json:"limit"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Warn("encode response failed", slog.Any("error", err))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func internalError(w http.ResponseWriter, request *http.Request, err error) {
+	logging.FromContext(request.Context()).Error("request failed", slog.Any("error", err))
+	writeError(w, http.StatusInternalServerError, "internal error")
+}
+
+func pagination(request *http.Request) (int64, int64) {
+	query := request.URL.Query()
+
+	offset, err := strconv.ParseInt(query.Get("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	limit, err := strconv.ParseInt(query.Get("limit"), 10, 64)
+	if err != nil || limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	return offset, limit
+}
@@ -0,0 +1,622 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"userService/internal/auth"
+	"userService/internal/group"
+	"userService/internal/logging"
+	"userService/internal/scim"
+	"userService/internal/user"
+)
+
+const scimContentType = "application/scim+json"
+
+// scimService is the service of the tokens SCIM clients are given for their tenant.
+const scimService = "scim"
+
+type scimHandler struct{}
+
+func registerScim(r *mux.Router) {
+	h := &scimHandler{}
+
+	s := r.PathPrefix("/scim/v2").Subrouter()
+	s.Use(h.authenticate)
+
+	s.HandleFunc("/ServiceProviderConfig", h.serviceProviderConfig).Methods("GET")
+	s.HandleFunc("/ResourceTypes", h.resourceTypes).Methods("GET")
+	s.HandleFunc("/ResourceTypes/{id}", h.resourceTypes).Methods("GET")
+	s.HandleFunc("/Schemas", h.schemas).Methods("GET")
+	s.HandleFunc("/Schemas/{id}", h.schemas).Methods("GET")
+
+	s.HandleFunc("/Users", h.listUsers).Methods("GET")
+	s.HandleFunc("/Users", h.createUser).Methods("POST")
+	s.HandleFunc("/Users/{id}", h.getUser).Methods("GET")
+	s.HandleFunc("/Users/{id}", h.replaceUser).Methods("PUT")
+	s.HandleFunc("/Users/{id}", h.patchUser).Methods("PATCH")
+	s.HandleFunc("/Users/{id}", h.deleteUser).Methods("DELETE")
+
+	s.HandleFunc("/Groups", h.listGroups).Methods("GET")
+	s.HandleFunc("/Groups", h.createGroup).Methods("POST")
+	s.HandleFunc("/Groups/{id}", h.getGroup).Methods("GET")
+	s.HandleFunc("/Groups/{id}", h.replaceGroup).Methods("PUT")
+	s.HandleFunc("/Groups/{id}", h.patchGroup).Methods("PATCH")
+	s.HandleFunc("/Groups/{id}", h.deleteGroup).Methods("DELETE")
+}
+
+func (h *scimHandler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		claims, _ := auth.FromContext(request.Context())
+		if claims.Service != scimService && claims.Service != auth.AdminService {
+			writeScimError(w, http.StatusForbidden, "", "a scim service token is required")
+			return
+		}
+
+		next.ServeHTTP(w, request)
+	})
+}
+
+func (h *scimHandler) serviceProviderConfig(w http.ResponseWriter, request *http.Request) {
+	writeScim(w, http.StatusOK, "", scim.ServiceProviderConfig(scimBaseURL(request)))
+}
+
+func (h *scimHandler) resourceTypes(w http.ResponseWriter, request *http.Request) {
+	h.discoveryList(w, request, scim.ResourceTypes(scimBaseURL(request)))
+}
+
+func (h *scimHandler) schemas(w http.ResponseWriter, request *http.Request) {
+	h.discoveryList(w, request, scim.Schemas(scimBaseURL(request)))
+}
+
+func (h *scimHandler) discoveryList(w http.ResponseWriter, request *http.Request, items []map[string]any) {
+	id, ok := mux.Vars(request)["id"]
+	if !ok {
+		writeScim(w, http.StatusOK, "", scim.ListResponse{
+			Schemas:      []string{scim.ListResponseSchema},
+			TotalResults: int64(len(items)),
+			StartIndex:   1,
+			ItemsPerPage: len(items),
+			Resources:    items,
+		})
+		return
+	}
+
+	for _, item := range items {
+		if item["id"] == id {
+			writeScim(w, http.StatusOK, "", item)
+			return
+		}
+	}
+
+	writeScimError(w, http.StatusNotFound, "", "resource "+id+" not found")
+}
+
+func (h *scimHandler) listUsers(w http.ResponseWriter, request *http.Request) {
+	filter, err := scim.UserFilter(request.URL.Query().Get("filter"))
+	if err != nil {
+		writeScimError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+
+	startIndex, count := scimPagination(request)
+	// A count of 0 only asks for totalResults, which must not read every matching user.
+	var users []user.Data
+	var total int64
+	if count > 0 {
+		users, total, err = user.FindUsers(request.Context(), filter, startIndex-1, int64(count))
+	} else {
+		total, err = user.CountUsers(request.Context(), filter)
+	}
+	if errors.Is(err, user.ErrEncryptedFilter) {
+		writeScimError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+	if err != nil {
+		scimInternalError(w, request, err)
+		return
+	}
+
+	resources := []scim.User{}
+	for _, data := range users {
+		resources = append(resources, scim.UserFromData(data, scimBaseURL(request)))
+	}
+
+	writeScim(w, http.StatusOK, "", scim.ListResponse{
+		Schemas:      []string{scim.ListResponseSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func (h *scimHandler) createUser(w http.ResponseWriter, request *http.Request) {
+	var resource scim.User
+	if err := json.NewDecoder(request.Body).Decode(&resource); err != nil {
+		writeScimError(w, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	data := resource.ToData(user.Data{})
+	if data.Name == "" {
+		writeScimError(w, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+
+	if conflict, err := h.userNameTaken(request, data); err != nil {
+		scimInternalError(w, request, err)
+		return
+	} else if conflict {
+		writeScimError(w, http.StatusConflict, "uniqueness", "userName "+data.Name+" already exists")
+		return
+	}
+
+	data, err := user.InsertUser(request.Context(), data)
+	if err != nil {
+		scimInternalError(w, request, err)
+		return
+	}
+
+	created := scim.UserFromData(data, scimBaseURL(request))
+	w.Header().Set("Location", created.Meta.Location)
+	writeScim(w, http.StatusCreated, created.Meta.Version, created)
+}
+
+func (h *scimHandler) getUser(w http.ResponseWriter, request *http.Request) {
+	data, ok := h.loadUser(w, request)
+	if !ok {
+		return
+	}
+
+	resource := scim.UserFromData(data, scimBaseURL(request))
+	if etagMatches(request.Header.Get("If-None-Match"), resource.Meta.Version) {
+		w.Header().Set("ETag", resource.Meta.Version)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeScim(w, http.StatusOK, resource.Meta.Version, resource)
+}
+
+func (h *scimHandler) replaceUser(w http.ResponseWriter, request *http.Request) {
+	data, ok := h.loadUserForUpdate(w, request)
+	if !ok {
+		return
+	}
+
+	var resource scim.User
+	if err := json.NewDecoder(request.Body).Decode(&resource); err != nil {
+		writeScimError(w, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	h.saveUser(w, request, resource.ToData(data))
+}
+
+func (h *scimHandler) patchUser(w http.ResponseWriter, request *http.Request) {
+	data, ok := h.loadUserForUpdate(w, request)
+	if !ok {
+		return
+	}
+
+	patch, ok := decodePatch(w, request)
+	if !ok {
+		return
+	}
+
+	data, err := scim.ApplyUserPatch(data, patch)
+	if err != nil {
+		writePatchError(w, request, err)
+		return
+	}
+
+	h.saveUser(w, request, data)
+}
+
+func (h *scimHandler) saveUser(w http.ResponseWriter, request *http.Request, data user.Data) {
+	if data.Name == "" {
+		writeScimError(w, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+
+	if conflict, err := h.userNameTaken(request, data); err != nil {
+		scimInternalError(w, request, err)
+		return
+	} else if conflict {
+		writeScimError(w, http.StatusConflict, "uniqueness", "userName "+data.Name+" already exists")
+		return
+	}
+
+	data, err := user.UpdateUser(request.Context(), data)
+	if errors.Is(err, user.ErrVersionMismatch) {
+		writeScimError(w, http.StatusPreconditionFailed, "", "resource was modified concurrently")
+		return
+	}
+	if err != nil {
+		scimInternalError(w, request, err)
+		return
+	}
+
+	resource := scim.UserFromData(data, scimBaseURL(request))
+	writeScim(w, http.StatusOK, resource.Meta.Version, resource)
+}
+
+func (h *scimHandler) deleteUser(w http.ResponseWriter, request *http.Request) {
+	data, ok := h.loadUserForUpdate(w, request)
+	if !ok {
+		return
+	}
+
+	err := user.DeleteUser(request.Context(), data.UserId, data.Version)
+	if errors.Is(err, user.ErrVersionMismatch) {
+		writeScimError(w, http.StatusPreconditionFailed, "", "resource was modified concurrently")
+		return
+	}
+	if err != nil {
+		scimInternalError(w, request, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *scimHandler) loadUser(w http.ResponseWriter, request *http.Request) (user.Data, bool) {
+	id, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		writeScimError(w, http.StatusNotFound, "", "user not found")
+		return user.Data{}, false
+	}
+
+	data, err := user.GetUser(request.Context(), id)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		writeScimError(w, http.StatusNotFound, "", "user not found")
+		return user.Data{}, false
+	}
+	if err != nil {
+		scimInternalError(w, request, err)
+		return user.Data{}, false
+	}
+
+	return data, true
+}
+
+func (h *scimHandler) loadUserForUpdate(w http.ResponseWriter, request *http.Request) (user.Data, bool) {
+	data, ok := h.loadUser(w, request)
+	if !ok {
+		return data, false
+	}
+
+	current := scim.UserFromData(data, scimBaseURL(request)).Meta.Version
+	if ifMatch := request.Header.Get("If-Match"); ifMatch != "" && !etagMatchesStrongly(ifMatch, current) {
+		writeScimError(w, http.StatusPreconditionFailed, "", "resource version does not match If-Match")
+		return data, false
+	}
+
+	return data, true
+}
+
+func (h *scimHandler) userNameTaken(request *http.Request, data user.Data) (bool, error) {
+	filter, err := scim.UserFilter(`userName eq ` + strconv.Quote(data.Name))
+	if err != nil {
+		return false, err
+	}
+	filter = bson.M{"$and": []bson.M{filter, {"userId": bson.M{"$ne": data.UserId}}}}
+
+	_, total, err := user.FindUsers(request.Context(), filter, 0, 1)
+
+	return total > 0, err
+}
+
+func (h *scimHandler) listGroups(w http.ResponseWriter, request *http.Request) {
+	filter, err := scim.GroupFilter(request.URL.Query().Get("filter"))
+	if err != nil {
+		writeScimError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+
+	startIndex, count := scimPagination(request)
+	var groups []group.Group
+	var total int64
+	if count > 0 {
+		groups, total, err = group.FindGroups(request.Context(), filter, startIndex-1, int64(count))
+	} else {
+		total, err = group.CountGroups(request.Context(), filter)
+	}
+	if err != nil {
+		scimInternalError(w, request, err)
+		return
+	}
+
+	resources := []scim.Group{}
+	for _, model := range groups {
+		resources = append(resources, scim.GroupFromModel(model, scimBaseURL(request)))
+	}
+
+	writeScim(w, http.StatusOK, "", scim.ListResponse{
+		Schemas:      []string{scim.ListResponseSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func (h *scimHandler) createGroup(w http.ResponseWriter, request *http.Request) {
+	var resource scim.Group
+	if err := json.NewDecoder(request.Body).Decode(&resource); err != nil {
+		writeScimError(w, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	model := resource.ToModel(group.Group{})
+	if !h.validGroup(w, request, model) {
+		return
+	}
+
+	model, err := group.CreateGroup(request.Context(), model)
+	if err != nil {
+		scimInternalError(w, request, err)
+		return
+	}
+
+	created := scim.GroupFromModel(model, scimBaseURL(request))
+	w.Header().Set("Location", created.Meta.Location)
+	writeScim(w, http.StatusCreated, created.Meta.Version, created)
+}
+
+func (h *scimHandler) getGroup(w http.ResponseWriter, request *http.Request) {
+	model, ok := h.loadGroup(w, request)
+	if !ok {
+		return
+	}
+
+	resource := scim.GroupFromModel(model, scimBaseURL(request))
+	if etagMatches(request.Header.Get("If-None-Match"), resource.Meta.Version) {
+		w.Header().Set("ETag", resource.Meta.Version)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeScim(w, http.StatusOK, resource.Meta.Version, resource)
+}
+
+func (h *scimHandler) replaceGroup(w http.ResponseWriter, request *http.Request) {
+	model, ok := h.loadGroupForUpdate(w, request)
+	if !ok {
+		return
+	}
+
+	var resource scim.Group
+	if err := json.NewDecoder(request.Body).Decode(&resource); err != nil {
+		writeScimError(w, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	h.saveGroup(w, request, resource.ToModel(model))
+}
+
+func (h *scimHandler) patchGroup(w http.ResponseWriter, request *http.Request) {
+	model, ok := h.loadGroupForUpdate(w, request)
+	if !ok {
+		return
+	}
+
+	patch, ok := decodePatch(w, request)
+	if !ok {
+		return
+	}
+
+	model, err := scim.ApplyGroupPatch(model, patch)
+	if err != nil {
+		writePatchError(w, request, err)
+		return
+	}
+
+	h.saveGroup(w, request, model)
+}
+
+func (h *scimHandler) saveGroup(w http.ResponseWriter, request *http.Request, model group.Group) {
+	if !h.validGroup(w, request, model) {
+		return
+	}
+
+	model, err := group.ReplaceGroup(request.Context(), model)
+	if err != nil {
+		scimInternalError(w, request, err)
+		return
+	}
+
+	resource := scim.GroupFromModel(model, scimBaseURL(request))
+	writeScim(w, http.StatusOK, resource.Meta.Version, resource)
+}
+
+func (h *scimHandler) deleteGroup(w http.ResponseWriter, request *http.Request) {
+	model, ok := h.loadGroupForUpdate(w, request)
+	if !ok {
+		return
+	}
+
+	err := group.DeleteGroup(request.Context(), model.Id.Hex())
+	if errors.Is(err, group.ErrOrganizationGroup) {
+		writeScimError(w, http.StatusConflict, "", err.Error())
+		return
+	}
+	if err != nil {
+		scimInternalError(w, request, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *scimHandler) loadGroup(w http.ResponseWriter, request *http.Request) (group.Group, bool) {
+	model, err := group.GetGroup(request.Context(), mux.Vars(request)["id"])
+	if errors.Is(err, group.ErrNotFound) {
+		writeScimError(w, http.StatusNotFound, "", "group not found")
+		return model, false
+	}
+	if err != nil {
+		scimInternalError(w, request, err)
+		return model, false
+	}
+
+	return model, true
+}
+
+func (h *scimHandler) loadGroupForUpdate(w http.ResponseWriter, request *http.Request) (group.Group, bool) {
+	model, ok := h.loadGroup(w, request)
+	if !ok {
+		return model, false
+	}
+
+	current := scim.GroupFromModel(model, scimBaseURL(request)).Meta.Version
+	if ifMatch := request.Header.Get("If-Match"); ifMatch != "" && !etagMatchesStrongly(ifMatch, current) {
+		writeScimError(w, http.StatusPreconditionFailed, "", "resource version does not match If-Match")
+		return model, false
+	}
+
+	return model, true
+}
+
+func (h *scimHandler) validGroup(w http.ResponseWriter, request *http.Request, model group.Group) bool {
+	if model.Name == "" {
+		writeScimError(w, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return false
+	}
+
+	for _, member := range model.Members {
+		var err error
+		if member.Type == group.MemberTypeGroup {
+			_, err = group.GetGroup(request.Context(), member.Value)
+		} else {
+			var id int64
+			if id, err = strconv.ParseInt(member.Value, 10, 64); err == nil {
+				_, err = user.GetUser(request.Context(), id)
+			}
+		}
+		if err != nil {
+			writeScimError(w, http.StatusBadRequest, "invalidValue", "member "+member.Value+" is not a known "+member.Type)
+			return false
+		}
+	}
+
+	return true
+}
+
+func decodePatch(w http.ResponseWriter, request *http.Request) (scim.PatchRequest, bool) {
+	var patch scim.PatchRequest
+	if err := json.NewDecoder(request.Body).Decode(&patch); err != nil {
+		writeScimError(w, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return patch, false
+	}
+
+	if len(patch.Operations) == 0 {
+		writeScimError(w, http.StatusBadRequest, "invalidSyntax", "Operations is required")
+		return patch, false
+	}
+
+	return patch, true
+}
+
+func writePatchError(w http.ResponseWriter, request *http.Request, err error) {
+	var patchErr *scim.PatchError
+	if errors.As(err, &patchErr) {
+		writeScimError(w, http.StatusBadRequest, patchErr.ScimType, patchErr.Detail)
+		return
+	}
+
+	scimInternalError(w, request, err)
+}
+
+func scimPagination(request *http.Request) (int64, int) {
+	query := request.URL.Query()
+
+	startIndex, err := strconv.ParseInt(query.Get("startIndex"), 10, 64)
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+
+	count, err := strconv.Atoi(query.Get("count"))
+	if err != nil || count > scim.MaxResults {
+		count = scim.MaxResults
+	}
+	if count < 0 {
+		count = 0
+	}
+
+	return startIndex, count
+}
+
+func scimBaseURL(request *http.Request) string {
+	scheme := "http"
+	if request.TLS != nil || request.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	return scheme + "://" + request.Host + "/scim/v2"
+}
+
+// etagMatches compares If-None-Match weakly, ignoring any W/ prefix, as RFC 9110 asks for.
+func etagMatches(header, current string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(current, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// etagMatchesStrongly compares If-Match strongly: weak tags never match, since a write must only
+// apply to exactly the version the client read.
+func etagMatchesStrongly(header, current string) bool {
+	if strings.HasPrefix(current, "W/") {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == current {
+			return true
+		}
+	}
+
+	return false
+}
+
+func writeScim(w http.ResponseWriter, status int, version string, body any) {
+	w.Header().Set("Content-Type", scimContentType)
+	if version != "" {
+		w.Header().Set("ETag", version)
+	}
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Warn("encode scim response failed", slog.Any("error", err))
+	}
+}
+
+func writeScimError(w http.ResponseWriter, status int, scimType, detail string) {
+	body := map[string]any{
+		"schemas": []string{scim.ErrorSchema},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+
+	writeScim(w, status, "", body)
+}
+
+func scimInternalError(w http.ResponseWriter, request *http.Request, err error) {
+	logging.FromContext(request.Context()).Error("scim request failed", slog.Any("error", err))
+	writeScimError(w, http.StatusInternalServerError, "", "internal error")
+}
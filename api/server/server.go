@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"golang.org/x/sync/errgroup"
+	"log/slog"
+	"userService/internal/config"
+	"userService/internal/events"
+	"userService/internal/group"
+	"userService/internal/user"
+	"userService/internal/webhook"
+)
+
+// Run serves HTTP and gRPC until ctx is cancelled or either server fails, then drains and shuts
+// both down.
+func Run(ctx context.Context, cfg *config.Config) error {
+	var publisher events.EventPublisher
+	var source events.Source
+	if events.Outbox {
+		var publishers []events.EventPublisher
+		if cfg.Events.Publisher != "" {
+			configured, err := events.NewPublisher(cfg.Events)
+			if err != nil {
+				return err
+			}
+			publishers = append(publishers, configured)
+
+			source = events.ChangeStreamSource{}
+			if memory, ok := configured.(*events.MemoryPublisher); ok {
+				source = memory
+			}
+		}
+		if cfg.Webhooks.Enabled {
+			publishers = append(publishers, webhook.Publisher{})
+		}
+
+		publisher = events.Combine(publishers...)
+		defer publisher.Close()
+	}
+
+	health := NewHealth()
+	group, ctx := errgroup.WithContext(ctx)
+
+	go func() {
+		<-ctx.Done()
+		slog.Info("shutting down")
+		health.Drain()
+	}()
+
+	group.Go(func() error {
+		return StartServer(ctx, cfg, health, source)
+	})
+	group.Go(func() error {
+		return StartRpc(ctx, cfg, health, source)
+	})
+	if publisher != nil {
+		group.Go(func() error {
+			events.NewRelay(publisher, cfg.Events.RelayInterval).Run(ctx)
+			return nil
+		})
+	}
+	if source != nil {
+		group.Go(func() error {
+			user.RunCacheInvalidator(ctx, source)
+			return nil
+		})
+	}
+	if cfg.Webhooks.Enabled {
+		group.Go(func() error {
+			webhook.RunDispatcher(ctx, cfg.Webhooks.DispatchInterval)
+			return nil
+		})
+	}
+	if cfg.DeletedRetention > 0 && cfg.PurgeInterval > 0 {
+		group.Go(func() error {
+			user.RunPurger(ctx, cfg.DeletedRetention, cfg.PurgeInterval, removeMemberships)
+			return nil
+		})
+	}
+
+	return group.Wait()
+}
+
+// removeMemberships drops a purged user from its groups. Soft deleted users keep theirs so that a
+// restore brings them back.
+func removeMemberships(ctx context.Context, deleted user.Data) error {
+	return group.RemoveUser(ctx, deleted.UserId)
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"userService/internal/audit"
+	"userService/internal/auth"
+	"userService/internal/config"
+	"userService/internal/tenant"
+	"userService/internal/user"
+)
+
+// defaultServiceTokenTTL is how long service tokens are valid unless the request says otherwise.
+const defaultServiceTokenTTL = 90 * 24 * time.Hour
+
+var servicePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+type tenantRequest struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Disabled bool   `json:"disabled"`
+}
+
+type serviceTokenRequest struct {
+	Service string `json:"service"`
+	TTL     string `json:"ttl"`
+}
+
+func registerTenantAdmin(r *mux.Router, cfg *config.Config) {
+	s := r.PathPrefix("/v1/admin/tenants").Subrouter()
+	s.Use(requireAdmin(cfg.AdminToken))
+
+	s.HandleFunc("", createTenant).Methods("POST")
+	s.HandleFunc("", listTenants).Methods("GET")
+	s.HandleFunc("/{tenantId}", getTenant).Methods("GET")
+	s.HandleFunc("/{tenantId}", updateTenant).Methods("PUT")
+	s.HandleFunc("/{tenantId}", deleteTenant).Methods("DELETE")
+	s.HandleFunc("/{tenantId}/tokens", issueServiceToken(cfg.AuthSecret)).Methods("POST")
+	registerAdminUsers(s)
+	registerAudit(s)
+}
+
+func requireAdmin(adminToken string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+			token := strings.TrimPrefix(request.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+				writeError(w, http.StatusUnauthorized, "admin token required")
+				return
+			}
+
+			next.ServeHTTP(w, request.WithContext(audit.WithActor(request.Context(), "admin")))
+		})
+	}
+}
+
+func writeTenantAdminError(w http.ResponseWriter, request *http.Request, err error) {
+	switch {
+	case errors.Is(err, tenant.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, tenant.ErrAlreadyExists):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, tenant.ErrInvalidId):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		internalError(w, request, err)
+	}
+}
+
+func createTenant(w http.ResponseWriter, request *http.Request) {
+	var body tenantRequest
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if body.Name == "" {
+		body.Name = body.Id
+	}
+
+	created, err := tenant.CreateTenant(request.Context(), body.Id, body.Name)
+	if err != nil {
+		writeTenantAdminError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func listTenants(w http.ResponseWriter, request *http.Request) {
+	offset, limit := pagination(request)
+
+	tenants, total, err := tenant.ListTenants(request.Context(), offset, limit)
+	if err != nil {
+		internalError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page{Items: tenants, Total: total, Offset: offset, Limit: limit})
+}
+
+func getTenant(w http.ResponseWriter, request *http.Request) {
+	found, err := tenant.GetTenant(request.Context(), mux.Vars(request)["tenantId"])
+	if err != nil {
+		writeTenantAdminError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, found)
+}
+
+func updateTenant(w http.ResponseWriter, request *http.Request) {
+	var body tenantRequest
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil || body.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	updated, err := tenant.UpdateTenant(request.Context(), mux.Vars(request)["tenantId"], body.Name, body.Disabled)
+	if err != nil {
+		writeTenantAdminError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func deleteTenant(w http.ResponseWriter, request *http.Request) {
+	tenantId := mux.Vars(request)["tenantId"]
+
+	users, err := user.CountUsers(user.WithDeleted(tenant.WithTenant(request.Context(), tenantId)), bson.M{})
+	if err != nil {
+		internalError(w, request, err)
+		return
+	}
+	if users > 0 {
+		writeError(w, http.StatusConflict, "tenant still has users")
+		return
+	}
+
+	if err := tenant.DeleteTenant(request.Context(), tenantId); err != nil {
+		writeTenantAdminError(w, request, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// issueServiceToken returns a token for an integration such as a SCIM client, which acts for
+// the whole tenant. It cannot be revoked before it expires other than by changing the secret.
+func issueServiceToken(secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, request *http.Request) {
+		if secret == "" {
+			writeError(w, http.StatusServiceUnavailable, "AUTH_SECRET is not configured")
+			return
+		}
+
+		var body serviceTokenRequest
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if !servicePattern.MatchString(body.Service) || body.Service == auth.AdminService {
+			writeError(w, http.StatusBadRequest, "service must be 1-63 lowercase letters, digits or dashes and not admin")
+			return
+		}
+
+		ttl := defaultServiceTokenTTL
+		if body.TTL != "" {
+			parsed, err := time.ParseDuration(body.TTL)
+			if err != nil || parsed <= 0 {
+				writeError(w, http.StatusBadRequest, "ttl must be a positive duration")
+				return
+			}
+			ttl = parsed
+		}
+
+		found, err := tenant.GetTenant(request.Context(), mux.Vars(request)["tenantId"])
+		if err != nil {
+			writeTenantAdminError(w, request, err)
+			return
+		}
+
+		token, err := auth.Issue(secret, auth.Claims{Tenant: found.Id, Service: body.Service}, ttl)
+		if err != nil {
+			internalError(w, request, err)
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, map[string]any{
+			"token":     token,
+			"tenantId":  found.Id,
+			"service":   body.Service,
+			"expiresAt": time.Now().Add(ttl).UTC(),
+		})
+	}
+}
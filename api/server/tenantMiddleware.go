@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"net/http"
+	"strings"
+	"userService/internal/audit"
+	"userService/internal/auth"
+	"userService/internal/config"
+	"userService/internal/logging"
+	"userService/internal/tenant"
+)
+
+// tenantHeader names the tenant of requests made with the admin token. Other callers get their
+// tenant from their token.
+const tenantHeader = "X-Tenant-ID"
+
+var (
+	errUnauthenticated = errors.New("a valid bearer token is required")
+	errTenantRequired  = errors.New("tenant is required")
+	errTenantMismatch  = errors.New("tenant does not match the token")
+	errTenantDisabled  = errors.New("tenant is disabled")
+)
+
+// authenticate verifies the bearer token of a request and returns the claims the request acts
+// with. The tenant comes from the token claim; only the admin token, which is held by trusted
+// internal callers, names its tenant in the header instead.
+func authenticate(ctx context.Context, cfg *config.Config, authorization, header string) (auth.Claims, error) {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || token == "" {
+		return auth.Claims{}, errUnauthenticated
+	}
+
+	header = strings.TrimSpace(header)
+	claims := auth.Claims{Tenant: header, Service: auth.AdminService}
+	if cfg.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) != 1 {
+		var err error
+		if claims, err = auth.Parse(cfg.AuthSecret, token); err != nil {
+			return auth.Claims{}, errUnauthenticated
+		}
+		if header != "" && header != claims.Tenant {
+			return auth.Claims{}, errTenantMismatch
+		}
+	}
+
+	if claims.Tenant == "" {
+		return auth.Claims{}, errTenantRequired
+	}
+	if err := checkTenant(ctx, claims.Tenant); err != nil {
+		return auth.Claims{}, err
+	}
+
+	return claims, nil
+}
+
+// checkTenant fails unless the tenant is registered and enabled.
+func checkTenant(ctx context.Context, tenantId string) error {
+	registered, err := tenant.GetTenant(ctx, tenantId)
+	if err != nil {
+		return err
+	}
+	if registered.Disabled {
+		return errTenantDisabled
+	}
+
+	return nil
+}
+
+// authenticated scopes ctx to the tenant of claims, with the caller as the audit actor.
+func authenticated(ctx context.Context, claims auth.Claims) context.Context {
+	actor := claims.Service
+	if actor == "" {
+		actor = audit.UserActor(claims.Subject)
+	}
+
+	ctx = auth.WithClaims(tenant.WithTenant(ctx, claims.Tenant), claims)
+
+	return tenantLogger(audit.WithActor(ctx, actor))
+}
+
+func tenantMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+			claims, err := authenticate(request.Context(), cfg, request.Header.Get("Authorization"), request.Header.Get(tenantHeader))
+			if err != nil {
+				writeTenantError(w, request, err)
+				return
+			}
+
+			next.ServeHTTP(w, request.WithContext(authenticated(request.Context(), claims)))
+		})
+	}
+}
+
+func writeTenantError(w http.ResponseWriter, request *http.Request, err error) {
+	switch {
+	case errors.Is(err, errUnauthenticated):
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, errTenantRequired):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, tenant.ErrNotFound), errors.Is(err, errTenantMismatch), errors.Is(err, errTenantDisabled):
+		writeError(w, http.StatusForbidden, err.Error())
+	default:
+		internalError(w, request, err)
+	}
+}
+
+func tenantInterceptor(cfg *config.Config) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if isHealthMethod(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		ctx, err := rpcTenant(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func tenantStreamInterceptor(cfg *config.Config) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if isHealthMethod(info.FullMethod) {
+			return handler(srv, stream)
+		}
+
+		ctx, err := rpcTenant(stream.Context(), cfg)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+func isHealthMethod(method string) bool {
+	return strings.HasPrefix(method, "/"+healthpb.Health_ServiceDesc.ServiceName+"/")
+}
+
+// rpcTenant authenticates a call from its metadata and returns the failure as a status error.
+func rpcTenant(ctx context.Context, cfg *config.Config) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	claims, err := authenticate(ctx, cfg, firstMetadata(md, "authorization"), firstMetadata(md, "x-tenant-id"))
+	switch {
+	case err == nil:
+		return authenticated(ctx, claims), nil
+	case errors.Is(err, errUnauthenticated):
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, errTenantRequired):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, tenant.ErrNotFound), errors.Is(err, errTenantMismatch), errors.Is(err, errTenantDisabled):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	logging.FromContext(ctx).Error("resolve tenant failed", slog.Any("error", err))
+
+	return nil, status.Error(codes.Internal, "internal error")
+}
+
+func firstMetadata(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	parentTraceId     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	parentSpanId      = "00f067aa0ba902b7"
+	parentTraceparent = "00-" + parentTraceId + "-" + parentSpanId + "-01"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	previous, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		otel.SetTextMapPropagator(propagator)
+	})
+
+	return recorder
+}
+
+func attributes(span sdktrace.ReadOnlySpan) map[string]string {
+	result := map[string]string{}
+	for _, attribute := range span.Attributes() {
+		result[string(attribute.Key)] = attribute.Value.Emit()
+	}
+
+	return result
+}
+
+// assertChildOfParent checks that span continues the trace of parentTraceparent.
+func assertChildOfParent(t *testing.T, span sdktrace.ReadOnlySpan) {
+	t.Helper()
+
+	if span.SpanContext().TraceID().String() != parentTraceId {
+		t.Errorf("%s trace id = %s, want %s", span.Name(), span.SpanContext().TraceID(), parentTraceId)
+	}
+	if span.Parent().SpanID().String() != parentSpanId || !span.Parent().IsRemote() {
+		t.Errorf("%s parent = %s, want remote %s", span.Name(), span.Parent().SpanID(), parentSpanId)
+	}
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	recorder := recordSpans(t)
+
+	var handlerSpan trace.SpanContext
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/users/{userId}", func(w http.ResponseWriter, request *http.Request) {
+		handlerSpan = trace.SpanContextFromContext(request.Context())
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET")
+	r.HandleFunc("/v1/failing", func(w http.ResponseWriter, request *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	handler := tracingMiddleware(r)(r)
+
+	request := httptest.NewRequest("GET", "/v1/users/42", nil)
+	request.Header.Set("traceparent", parentTraceparent)
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/failing", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("ended %d spans, want 2", len(spans))
+	}
+
+	span := spans[0]
+	if span.Name() != "GET /v1/users/{userId}" || span.SpanKind() != trace.SpanKindServer {
+		t.Errorf("span = %q of kind %v", span.Name(), span.SpanKind())
+	}
+	assertChildOfParent(t, span)
+	if handlerSpan.SpanID() != span.SpanContext().SpanID() {
+		t.Error("the handler does not run in the request span")
+	}
+	got := attributes(span)
+	for key, want := range map[string]string{"http.request.method": "GET", "http.route": "/v1/users/{userId}", "url.path": "/v1/users/42", "http.response.status_code": "200"} {
+		if got[key] != want {
+			t.Errorf("%s = %q, want %q", key, got[key], want)
+		}
+	}
+	if span.Status().Code != otelcodes.Unset {
+		t.Errorf("status = %v", span.Status())
+	}
+
+	failing := spans[1]
+	if failing.Parent().IsValid() {
+		t.Error("a request without traceparent continued a trace")
+	}
+	if failing.Status().Code != otelcodes.Error || attributes(failing)["http.response.status_code"] != "503" {
+		t.Errorf("failing status = %v, attributes %v", failing.Status(), attributes(failing))
+	}
+}
+
+// traceHealth is a health server that records the span of every call it serves.
+type traceHealth struct {
+	*health.Server
+	spans chan trace.SpanContext
+}
+
+func (h *traceHealth) Check(ctx context.Context, request *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	h.spans <- trace.SpanContextFromContext(ctx)
+
+	return h.Server.Check(ctx, request)
+}
+
+func (h *traceHealth) Watch(request *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	h.spans <- trace.SpanContextFromContext(stream.Context())
+
+	return status.Error(codes.Unavailable, "not watching")
+}
+
+func TestTracingInterceptors(t *testing.T) {
+	recorder := recordSpans(t)
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(tracingInterceptor),
+		grpc.ChainStreamInterceptor(tracingStreamInterceptor),
+	)
+	service := &traceHealth{Server: health.NewServer(), spans: make(chan trace.SpanContext, 2)}
+	healthpb.RegisterHealthServer(server, service)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	client := healthpb.NewHealthClient(conn)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "traceparent", parentTraceparent)
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Watch error = %v", err)
+	}
+	server.GracefulStop()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("ended %d spans, want 2", len(spans))
+	}
+
+	unary, streaming := spans[0], spans[1]
+	tests := []struct {
+		span   sdktrace.ReadOnlySpan
+		name   string
+		method string
+		code   string
+	}{
+		{span: unary, name: "grpc.health.v1.Health/Check", method: "Check", code: "0"},
+		{span: streaming, name: "grpc.health.v1.Health/Watch", method: "Watch", code: "14"},
+	}
+	for _, test := range tests {
+		if test.span.Name() != test.name || test.span.SpanKind() != trace.SpanKindServer {
+			t.Errorf("span = %q of kind %v, want server span %q", test.span.Name(), test.span.SpanKind(), test.name)
+		}
+		assertChildOfParent(t, test.span)
+		if handled := <-service.spans; handled.SpanID() != test.span.SpanContext().SpanID() {
+			t.Errorf("%s handler does not run in the call span", test.name)
+		}
+
+		got := attributes(test.span)
+		for key, want := range map[string]string{"rpc.system": "grpc", "rpc.service": "grpc.health.v1.Health", "rpc.method": test.method, "rpc.grpc.status_code": test.code} {
+			if got[key] != want {
+				t.Errorf("%s %s = %q, want %q", test.name, key, got[key], want)
+			}
+		}
+	}
+	if unary.Status().Code != otelcodes.Unset || streaming.Status().Code != otelcodes.Error {
+		t.Errorf("statuses = %v, %v", unary.Status(), streaming.Status())
+	}
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"userService/internal/auth"
+	"userService/internal/events"
+	"userService/internal/logging"
+	"userService/internal/tenant"
+)
+
+const (
+	sseHeartbeat = 15 * time.Second
+	// sseRetry is the reconnect delay, in milliseconds, that browsers are told to use.
+	sseRetry = 3000
+)
+
+type userEventsHandler struct {
+	source events.Source
+	// streams is cancelled when the server shuts down, which would otherwise wait for open
+	// streams until its timeout.
+	streams context.Context
+}
+
+// registerUserEvents must come before registerUsers, whose /v1/users/{userId} would match.
+func registerUserEvents(r *mux.Router, source events.Source, streams context.Context) {
+	h := &userEventsHandler{source: source, streams: streams}
+
+	r.HandleFunc("/v1/users/events", h.stream).Methods("GET")
+}
+
+// sseWriter writes Server-Sent Events from the watch and the heartbeat, one at a time.
+type sseWriter struct {
+	mu         sync.Mutex
+	w          http.ResponseWriter
+	controller *http.ResponseController
+}
+
+func (s *sseWriter) write(message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := fmt.Fprint(s.w, message); err != nil {
+		return err
+	}
+
+	return s.controller.Flush()
+}
+
+func (s *sseWriter) event(id, eventType string, data []byte) error {
+	return s.write(fmt.Sprintf("id: %s\nevent: %s\ndata: %s\n\n", id, eventType, data))
+}
+
+// stream sends the changes to users of the tenant as Server-Sent Events, optionally only those
+// of the users given as userId. Users who are not admins only get their own changes. Each event id resumes the stream after it, through the
+// Last-Event-ID header browsers send when they reconnect or the lastEventId parameter. When the
+// stream cannot resume, a reset event tells the client to reload the users, and the stream goes
+// on from now.
+func (h *userEventsHandler) stream(w http.ResponseWriter, request *http.Request) {
+	if h.source == nil {
+		writeError(w, http.StatusServiceUnavailable, "change events are disabled")
+		return
+	}
+
+	var requested []int64
+	for _, text := range request.URL.Query()["userId"] {
+		id, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "userId is not valid")
+			return
+		}
+		requested = append(requested, id)
+	}
+	userIds, err := watchableUsers(request.Context(), requested)
+	if errors.Is(err, errWatchForbidden) {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		internalError(w, request, err)
+		return
+	}
+
+	ctx, cancel := h.streamContext(request)
+	defer cancel()
+
+	tenantId, _ := tenant.FromContext(ctx)
+	filter := events.Filter{TenantId: tenantId, UserIds: userIds}
+
+	token := request.Header.Get("Last-Event-ID")
+	if token == "" {
+		token = request.URL.Query().Get("lastEventId")
+	}
+
+	controller := http.NewResponseController(w)
+	_ = controller.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	out := &sseWriter{w: w, controller: controller}
+	if err := out.write(fmt.Sprintf("retry: %d\n\n", sseRetry)); err != nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(sseHeartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := out.write(": heartbeat\n\n"); err != nil {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	send := func(event events.Event, token string) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		return out.event(token, event.Type, data)
+	}
+
+	for {
+		err := h.source.Watch(ctx, filter, token, send)
+		if token != "" && (errors.Is(err, events.ErrInvalidResumeToken) || errors.Is(err, events.ErrResumeTokenExpired)) {
+			data, _ := json.Marshal(map[string]string{"error": err.Error()})
+			if err := out.event("", "reset", data); err != nil {
+				return
+			}
+			token = ""
+			continue
+		}
+
+		// A lagging stream ends, and the browser reconnects from its last event.
+		if err != nil && ctx.Err() == nil && !errors.Is(err, events.ErrLagging) {
+			logging.FromContext(ctx).Error("user events stream failed", slog.Any("error", err))
+		}
+
+		return
+	}
+}
+
+// streamContext ends the stream with the request, on shutdown, and when the bearer token the
+// stream was authorized with expires.
+func (h *userEventsHandler) streamContext(request *http.Request) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(request.Context())
+	stop := context.AfterFunc(h.streams, cancel)
+
+	if claims, ok := auth.FromContext(ctx); ok && claims.ExpiresAt > 0 {
+		var cancelDeadline context.CancelFunc
+		ctx, cancelDeadline = context.WithDeadline(ctx, time.Unix(claims.ExpiresAt, 0))
+		return ctx, func() {
+			cancelDeadline()
+			stop()
+			cancel()
+		}
+	}
+
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
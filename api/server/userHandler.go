@@ -0,0 +1,253 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"userService/internal/user"
+)
+
+// userFields are the fields of a user that clients can change. PUT replaces all of them and
+// PATCH takes a JSON merge patch of them.
+type userFields struct {
+	Name       string   `json:"name"`
+	Email      string   `json:"email"`
+	ExternalId string   `json:"externalId"`
+	Disabled   bool     `json:"disabled"`
+	Roles      []string `json:"roles"`
+}
+
+// registerUsers must come after the import, export and events routes, which share the /v1/users
+// prefix.
+func registerUsers(r *mux.Router) {
+	r.HandleFunc("/v1/users/{userId}", getVersionedUser).Methods("GET")
+	r.HandleFunc("/v1/users/{userId}", replaceUser).Methods("PUT")
+	r.HandleFunc("/v1/users/{userId}", patchUser).Methods("PATCH")
+	r.HandleFunc("/v1/users/{userId}", deleteUser).Methods("DELETE")
+}
+
+func userETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+func loadUser(w http.ResponseWriter, request *http.Request) (user.Data, bool) {
+	id, err := strconv.ParseInt(mux.Vars(request)["userId"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "id is not valid")
+		return user.Data{}, false
+	}
+
+	data, err := user.GetUser(request.Context(), id)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		writeError(w, http.StatusNotFound, "user not found")
+		return user.Data{}, false
+	}
+	if err != nil {
+		internalError(w, request, err)
+		return user.Data{}, false
+	}
+
+	return data, true
+}
+
+// loadUserForWrite loads the user and checks it against If-Match, which writes must send so
+// they cannot overwrite a change they have not seen.
+func loadUserForWrite(w http.ResponseWriter, request *http.Request) (user.Data, bool) {
+	ifMatch := request.Header.Get("If-Match")
+	if ifMatch == "" {
+		writeError(w, http.StatusPreconditionRequired, "If-Match is required")
+		return user.Data{}, false
+	}
+
+	data, ok := loadUser(w, request)
+	if !ok {
+		return data, false
+	}
+
+	if !etagMatchesStrongly(ifMatch, userETag(data.Version)) {
+		writeError(w, http.StatusPreconditionFailed, "user version does not match If-Match")
+		return data, false
+	}
+
+	return data, true
+}
+
+func writeUser(w http.ResponseWriter, data user.Data) {
+	w.Header().Set("ETag", userETag(data.Version))
+	writeJSON(w, http.StatusOK, data)
+}
+
+func writeUserWriteError(w http.ResponseWriter, request *http.Request, err error) {
+	switch {
+	case errors.Is(err, user.ErrVersionMismatch):
+		writeError(w, http.StatusPreconditionFailed, "user was modified concurrently")
+	case errors.Is(err, mongo.ErrNoDocuments):
+		writeError(w, http.StatusNotFound, "user not found")
+	case mongo.IsDuplicateKeyError(err):
+		writeError(w, http.StatusConflict, "a user with this email already exists")
+	default:
+		internalError(w, request, err)
+	}
+}
+
+func getVersionedUser(w http.ResponseWriter, request *http.Request) {
+	data, ok := loadUser(w, request)
+	if !ok {
+		return
+	}
+
+	if ifNoneMatch := request.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, userETag(data.Version)) {
+		w.Header().Set("ETag", userETag(data.Version))
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeUser(w, data)
+}
+
+func replaceUser(w http.ResponseWriter, request *http.Request) {
+	data, ok := loadUserForWrite(w, request)
+	if !ok {
+		return
+	}
+
+	var fields userFields
+	if err := json.NewDecoder(request.Body).Decode(&fields); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	saveUser(w, request, data, fields)
+}
+
+func patchUser(w http.ResponseWriter, request *http.Request) {
+	data, ok := loadUserForWrite(w, request)
+	if !ok {
+		return
+	}
+
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(request.Body).Decode(&patch); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	fields := userFields{Name: data.Name, Email: data.Email, ExternalId: data.ExternalId, Disabled: data.Disabled, Roles: data.Roles}
+	if err := fields.merge(patch); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	saveUser(w, request, data, fields)
+}
+
+func saveUser(w http.ResponseWriter, request *http.Request, data user.Data, fields userFields) {
+	if err := fields.normalize(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	stored := data
+	data.Name, data.Email, data.ExternalId = fields.Name, fields.Email, fields.ExternalId
+	data.Disabled, data.Roles = fields.Disabled, fields.Roles
+
+	if ok, err := mayUpdateUser(request.Context(), stored, data); err != nil {
+		internalError(w, request, err)
+		return
+	} else if !ok {
+		writeError(w, http.StatusForbidden, errUserWriteForbidden.Error())
+		return
+	}
+
+	updated, err := user.UpdateUser(request.Context(), data)
+	if err != nil {
+		writeUserWriteError(w, request, err)
+		return
+	}
+
+	writeUser(w, updated)
+}
+
+func deleteUser(w http.ResponseWriter, request *http.Request) {
+	if admin, err := isTenantAdmin(request.Context()); err != nil {
+		internalError(w, request, err)
+		return
+	} else if !admin {
+		writeError(w, http.StatusForbidden, "tenant admin required")
+		return
+	}
+
+	data, ok := loadUserForWrite(w, request)
+	if !ok {
+		return
+	}
+
+	if err := user.DeleteUser(request.Context(), data.UserId, data.Version); err != nil {
+		writeUserWriteError(w, request, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// merge applies a JSON merge patch: present fields are replaced and null clears them.
+func (f *userFields) merge(patch map[string]json.RawMessage) error {
+	targets := map[string]any{
+		"name":       &f.Name,
+		"email":      &f.Email,
+		"externalId": &f.ExternalId,
+		"disabled":   &f.Disabled,
+		"roles":      &f.Roles,
+	}
+
+	for name, value := range patch {
+		target, ok := targets[name]
+		if !ok {
+			return fmt.Errorf("%s cannot be changed", name)
+		}
+
+		if string(value) == "null" {
+			reflect.ValueOf(target).Elem().SetZero()
+			continue
+		}
+		if err := json.Unmarshal(value, target); err != nil {
+			return fmt.Errorf("invalid %s", name)
+		}
+	}
+
+	return nil
+}
+
+func (f *userFields) normalize() error {
+	f.Name = strings.TrimSpace(f.Name)
+	f.Email = strings.TrimSpace(f.Email)
+	f.ExternalId = strings.TrimSpace(f.ExternalId)
+
+	if f.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if f.Email != "" {
+		address, err := mail.ParseAddress(f.Email)
+		if err != nil || address.Address != f.Email {
+			return fmt.Errorf("invalid email %q", f.Email)
+		}
+		f.Email = strings.ToLower(f.Email)
+	}
+
+	for i, role := range f.Roles {
+		f.Roles[i] = strings.TrimSpace(role)
+		if f.Roles[i] == "" {
+			return errors.New("roles must not be empty")
+		}
+	}
+
+	return nil
+}
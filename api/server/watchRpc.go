@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	pb "userService/generated/proto"
+	"userService/internal/events"
+	"userService/internal/logging"
+	"userService/internal/tenant"
+	"userService/internal/user"
+)
+
+func (s *userServiceServer) WatchUsers(req *pb.WatchUsersRequest, stream pb.UserService_WatchUsersServer) error {
+	if s.source == nil {
+		return status.Error(codes.FailedPrecondition, "change events are disabled")
+	}
+
+	ctx := stream.Context()
+	userIds, err := watchableUsers(ctx, req.UserIds)
+	if errors.Is(err, errWatchForbidden) {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("watch users failed", slog.Any("error", err))
+		return status.Error(codes.Internal, "internal error")
+	}
+	tenantId, _ := tenant.FromContext(ctx)
+	filter := events.Filter{TenantId: tenantId, UserIds: userIds}
+
+	err = s.source.Watch(ctx, filter, req.ResumeToken, func(event events.Event, token string) error {
+		message, err := userEventMessage(ctx, event, token)
+		if err != nil {
+			return err
+		}
+
+		return stream.Send(message)
+	})
+
+	switch {
+	case ctx.Err() != nil:
+		return status.FromContextError(ctx.Err()).Err()
+	case err == nil:
+		return nil
+	case errors.Is(err, events.ErrInvalidResumeToken):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, events.ErrResumeTokenExpired):
+		return status.Error(codes.OutOfRange, err.Error())
+	case errors.Is(err, events.ErrLagging):
+		return status.Error(codes.Aborted, err.Error())
+	}
+
+	logging.FromContext(ctx).Error("watch users failed", slog.Any("error", err))
+
+	return status.Error(codes.Internal, "internal error")
+}
+
+// userEventMessage converts an event, adding the user as it is now, since events carry no user
+// data.
+func userEventMessage(ctx context.Context, event events.Event, token string) (*pb.UserEvent, error) {
+	message := &pb.UserEvent{
+		Id:               event.Id.Hex(),
+		Type:             event.Type,
+		UserId:           event.UserId,
+		Version:          event.Version,
+		OccurredAtUnixMs: event.OccurredAt.UnixMilli(),
+		ResumeToken:      token,
+		Fields:           event.Fields,
+	}
+
+	if event.Type != events.UserDeleted {
+		data, err := user.GetUser(ctx, event.UserId)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+		if err == nil {
+			message.User = userMessage(data)
+		}
+	}
+
+	return message, nil
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"slices"
+	"userService/internal/webhook"
+)
+
+var deliveryStatuses = []string{webhook.StatusPending, webhook.StatusDelivered, webhook.StatusDead}
+
+// registerWebhooks adds the webhook management routes, which only tenant admins may use.
+func registerWebhooks(r *mux.Router) {
+	s := r.PathPrefix("/v1/webhooks").Subrouter()
+	s.Use(requireTenantAdmin)
+
+	s.HandleFunc("", createWebhook).Methods("POST")
+	s.HandleFunc("", listWebhooks).Methods("GET")
+	s.HandleFunc("/{webhookId}", getWebhook).Methods("GET")
+	s.HandleFunc("/{webhookId}", replaceWebhook).Methods("PUT")
+	s.HandleFunc("/{webhookId}", deleteWebhook).Methods("DELETE")
+	s.HandleFunc("/{webhookId}/deliveries", listWebhookDeliveries).Methods("GET")
+	s.HandleFunc("/{webhookId}/deliveries/{deliveryId}", getWebhookDelivery).Methods("GET")
+	s.HandleFunc("/{webhookId}/deliveries/{deliveryId}/redeliver", redeliverWebhook).Methods("POST")
+}
+
+func writeWebhookError(w http.ResponseWriter, request *http.Request, err error) {
+	switch {
+	case errors.Is(err, webhook.ErrNotFound), errors.Is(err, webhook.ErrDeliveryNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, webhook.ErrInvalid):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		internalError(w, request, err)
+	}
+}
+
+func decodeWebhook(w http.ResponseWriter, request *http.Request) (webhook.Subscription, bool) {
+	var body struct {
+		URL        string   `json:"url"`
+		EventTypes []string `json:"eventTypes"`
+		Secret     string   `json:"secret"`
+		Disabled   bool     `json:"disabled"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return webhook.Subscription{}, false
+	}
+
+	return webhook.Subscription{URL: body.URL, EventTypes: body.EventTypes, Secret: body.Secret, Disabled: body.Disabled}, true
+}
+
+func createWebhook(w http.ResponseWriter, request *http.Request) {
+	subscription, ok := decodeWebhook(w, request)
+	if !ok {
+		return
+	}
+
+	subscription, err := webhook.CreateSubscription(request.Context(), subscription)
+	if err != nil {
+		writeWebhookError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, subscription)
+}
+
+func listWebhooks(w http.ResponseWriter, request *http.Request) {
+	offset, limit := pagination(request)
+
+	subscriptions, total, err := webhook.ListSubscriptions(request.Context(), offset, limit)
+	if err != nil {
+		internalError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page{Items: subscriptions, Total: total, Offset: offset, Limit: limit})
+}
+
+func getWebhook(w http.ResponseWriter, request *http.Request) {
+	subscription, err := webhook.GetSubscription(request.Context(), mux.Vars(request)["webhookId"])
+	if err != nil {
+		writeWebhookError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, subscription)
+}
+
+func replaceWebhook(w http.ResponseWriter, request *http.Request) {
+	changes, ok := decodeWebhook(w, request)
+	if !ok {
+		return
+	}
+
+	subscription, err := webhook.UpdateSubscription(request.Context(), mux.Vars(request)["webhookId"], changes)
+	if err != nil {
+		writeWebhookError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, subscription)
+}
+
+func deleteWebhook(w http.ResponseWriter, request *http.Request) {
+	if err := webhook.DeleteSubscription(request.Context(), mux.Vars(request)["webhookId"]); err != nil {
+		writeWebhookError(w, request, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func listWebhookDeliveries(w http.ResponseWriter, request *http.Request) {
+	status := request.URL.Query().Get("status")
+	if status != "" && !slices.Contains(deliveryStatuses, status) {
+		writeError(w, http.StatusBadRequest, "status must be pending, delivered or dead")
+		return
+	}
+	offset, limit := pagination(request)
+
+	deliveries, total, err := webhook.ListDeliveries(request.Context(), mux.Vars(request)["webhookId"], status, offset, limit)
+	if err != nil {
+		writeWebhookError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page{Items: deliveries, Total: total, Offset: offset, Limit: limit})
+}
+
+func getWebhookDelivery(w http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+
+	delivery, err := webhook.GetDelivery(request.Context(), vars["webhookId"], vars["deliveryId"])
+	if err != nil {
+		writeWebhookError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, delivery)
+}
+
+func redeliverWebhook(w http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+
+	delivery, err := webhook.Redeliver(request.Context(), vars["webhookId"], vars["deliveryId"])
+	if err != nil {
+		writeWebhookError(w, request, err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, delivery)
+}
@@ -0,0 +1,479 @@
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"slices"
+	"strconv"
+	"time"
+	"userService/internal/logging"
+	"userService/internal/tenant"
+)
+
+const (
+	ActionCreate     = "create"
+	ActionUpdate     = "update"
+	ActionRoleChange = "role_change"
+	ActionDelete     = "delete"
+	ActionRestore    = "restore"
+	ActionPurge      = "purge"
+	ActionErase      = "erase"
+
+	ActorAnonymous = "anonymous"
+	ActorSystem    = "system"
+)
+
+// Change holds the value of one field before and after a mutation; a nil side means the field
+// was not set. Changes to PersonalFields only name the field and hold no values.
+type Change struct {
+	Before any `json:"before,omitempty" bson:"before,omitempty"`
+	After  any `json:"after,omitempty" bson:"after,omitempty"`
+}
+
+type Event struct {
+	Id        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TenantId  string             `json:"tenantId" bson:"tenantId"`
+	Actor     string             `json:"actor" bson:"actor"`
+	Action    string             `json:"action" bson:"action"`
+	UserId    int64              `json:"userId" bson:"userId"`
+	Changes   map[string]Change  `json:"changes,omitempty" bson:"changes,omitempty"`
+	RequestId string             `json:"requestId,omitempty" bson:"requestId,omitempty"`
+	SourceIP  string             `json:"sourceIp,omitempty" bson:"sourceIp,omitempty"`
+	Timestamp time.Time          `json:"timestamp" bson:"timestamp"`
+	// Seq, PrevHash and Hash are only set when hash chaining is enabled. Hash covers the
+	// personal data through PersonalHash, which is salted so that it cannot be guessed once
+	// Redact removed the data and the salt.
+	Seq          int64  `json:"seq,omitempty" bson:"seq,omitempty"`
+	PrevHash     string `json:"prevHash,omitempty" bson:"prevHash,omitempty"`
+	Hash         string `json:"hash,omitempty" bson:"hash,omitempty"`
+	PersonalHash string `json:"personalHash,omitempty" bson:"personalHash,omitempty"`
+	PersonalSalt string `json:"-" bson:"personalSalt,omitempty"`
+	// RedactedAt is set once personal data was removed from the event by an erasure. It is not
+	// covered by the hash.
+	RedactedAt *time.Time `json:"redactedAt,omitempty" bson:"redactedAt,omitempty"`
+}
+
+type Query struct {
+	Actor  string
+	UserId int64
+	// From is inclusive and To exclusive; zero values leave the range open.
+	From time.Time
+	To   time.Time
+}
+
+var collection *mongo.Collection
+
+// HashChain links each new event of a tenant to the previous one, so that editing or removing
+// an event breaks every hash after it. It relies on the unique tenantId_seq index.
+var HashChain bool
+
+func UseDatabase(database *mongo.Database) {
+	collection = database.Collection("audit")
+}
+
+type contextKey int
+
+const (
+	actorKey contextKey = iota
+	sourceKey
+)
+
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+func WithSourceIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, sourceKey, ip)
+}
+
+// UserActor is the actor recorded for requests authenticated as a user.
+func UserActor(userId int64) string {
+	return "user:" + strconv.FormatInt(userId, 10)
+}
+
+func Actor(ctx context.Context) string {
+	if actor, _ := ctx.Value(actorKey).(string); actor != "" {
+		return actor
+	}
+
+	return ActorAnonymous
+}
+
+// Record appends events, filling in who made the change from ctx. An event keeps a tenant it
+// already has, which lets jobs that work across tenants record on their behalf.
+func Record(ctx context.Context, events ...Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	sourceIP, _ := ctx.Value(sourceKey).(string)
+	tenantId, _ := tenant.FromContext(ctx)
+
+	for i := range events {
+		if events[i].TenantId == "" {
+			events[i].TenantId = tenantId
+		}
+		if events[i].TenantId == "" {
+			return tenant.ErrMissingTenant
+		}
+		events[i].Actor = Actor(ctx)
+		events[i].RequestId = logging.RequestId(ctx)
+		events[i].SourceIP = sourceIP
+		events[i].Timestamp = now
+
+		changes, err := normalize(events[i].Changes)
+		if err != nil {
+			return err
+		}
+		events[i].Changes = changes
+	}
+
+	if !HashChain {
+		documents := make([]any, len(events))
+		for i := range events {
+			documents[i] = events[i]
+		}
+		_, err := collection.InsertMany(ctx, documents)
+
+		return err
+	}
+
+	for _, event := range events {
+		if err := appendChained(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// appendChained inserts event after the current head of its tenant's chain. The unique index on
+// tenantId and seq makes concurrent writers collide, and the loser retries on the new head.
+func appendChained(ctx context.Context, event Event) error {
+	for {
+		head, err := chainHead(ctx, event.TenantId)
+		if err != nil {
+			return err
+		}
+
+		event.Seq = head.Seq + 1
+		event.PrevHash = head.Hash
+		event.PersonalSalt = newSalt()
+		if event.PersonalHash, err = personalHash(event); err != nil {
+			return err
+		}
+		if event.Hash, err = hash(event); err != nil {
+			return err
+		}
+
+		_, err = collection.InsertOne(ctx, event)
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+}
+
+func chainHead(ctx context.Context, tenantId string) (Event, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}})
+
+	var head Event
+	err := collection.FindOne(ctx, bson.M{"tenantId": tenantId, "seq": bson.M{"$gt": 0}}, opts).Decode(&head)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Event{}, nil
+	}
+
+	return head, err
+}
+
+// hash covers every field of the event except its id, the hash itself and the personal data,
+// which is covered by PersonalHash instead. Events from before personal hashes cover their
+// personal data directly.
+func hash(event Event) (string, error) {
+	event.Id = primitive.NilObjectID
+	event.Hash = ""
+	event.RedactedAt = nil
+	event.PersonalSalt = ""
+	event.Timestamp = event.Timestamp.UTC()
+	if event.PersonalHash != "" {
+		event.Changes, _ = split(event.Changes)
+		event.SourceIP = ""
+	}
+
+	return digest("", event)
+}
+
+// personalHash covers the personal data of the event, salted with its PersonalSalt.
+func personalHash(event Event) (string, error) {
+	_, personal := split(event.Changes)
+
+	return digest(event.PersonalSalt, struct {
+		Changes  map[string]Change `json:"changes,omitempty"`
+		SourceIP string            `json:"sourceIp,omitempty"`
+	}{personal, event.SourceIP})
+}
+
+func digest(salt string, value any) (string, error) {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(salt), payload...))
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func newSalt() string {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(salt)
+}
+
+// split separates the changes to PersonalFields from the others.
+func split(changes map[string]Change) (map[string]Change, map[string]Change) {
+	var other, personal map[string]Change
+	for field, change := range changes {
+		target := &other
+		if slices.Contains(PersonalFields, field) {
+			target = &personal
+		}
+		if *target == nil {
+			*target = map[string]Change{}
+		}
+		(*target)[field] = change
+	}
+
+	return other, personal
+}
+
+// verifyPersonal checks the personal data of an event against its PersonalHash. Once redacted,
+// the data and salt are gone, and the event may only hold what Redact left.
+func verifyPersonal(event Event) (bool, error) {
+	if event.RedactedAt == nil {
+		expected, err := personalHash(event)
+		return event.PersonalHash == expected, err
+	}
+
+	_, personal := split(event.Changes)
+	for _, change := range personal {
+		if (change.Before != nil && change.Before != redacted) || (change.After != nil && change.After != redacted) {
+			return false, nil
+		}
+	}
+
+	return event.PersonalSalt == "", nil
+}
+
+// normalize turns change values into plain JSON types, so they hash the same after a round trip
+// through the database.
+func normalize(changes map[string]Change) (map[string]Change, error) {
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	payload, err := json.Marshal(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]Change
+	err = json.Unmarshal(payload, &result)
+
+	return result, err
+}
+
+func (q Query) filter() bson.M {
+	filter := bson.M{}
+	if q.Actor != "" {
+		filter["actor"] = q.Actor
+	}
+	if q.UserId != 0 {
+		filter["userId"] = q.UserId
+	}
+
+	timestamp := bson.M{}
+	if !q.From.IsZero() {
+		timestamp["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		timestamp["$lt"] = q.To
+	}
+	if len(timestamp) > 0 {
+		filter["timestamp"] = timestamp
+	}
+
+	return filter
+}
+
+// Find returns the events of the tenant in ctx matching query, newest first.
+func Find(ctx context.Context, query Query, skip, limit int64) ([]Event, int64, error) {
+	filter, err := tenant.Scope(ctx, query.filter())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}).SetSkip(skip)
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	result := []Event{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, 0, err
+	}
+
+	return result, total, nil
+}
+
+type Verification struct {
+	Verified int64 `json:"verified"`
+	Valid    bool  `json:"valid"`
+	// BrokenAt is the first sequence number whose event is missing or does not match its hash.
+	BrokenAt int64 `json:"brokenAt,omitempty"`
+}
+
+// Verify walks the hash chain of the tenant in ctx from the start and reports the first event
+// that was altered, removed or inserted out of order.
+func Verify(ctx context.Context) (Verification, error) {
+	filter, err := tenant.Scope(ctx, bson.M{"seq": bson.M{"$gt": 0}})
+	if err != nil {
+		return Verification{}, err
+	}
+
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}))
+	if err != nil {
+		return Verification{}, err
+	}
+	defer cursor.Close(ctx)
+
+	result := Verification{Valid: true}
+	previous := ""
+	for cursor.Next(ctx) {
+		var event Event
+		if err := cursor.Decode(&event); err != nil {
+			return result, err
+		}
+
+		expected, err := hash(event)
+		if err != nil {
+			return result, err
+		}
+		valid := event.Hash == expected
+		switch {
+		case event.PersonalHash != "":
+			personal, err := verifyPersonal(event)
+			if err != nil {
+				return result, err
+			}
+			valid = valid && personal
+		case event.RedactedAt != nil:
+			// Events redacted before personal hashes can only be checked for their place in the
+			// chain.
+			valid = true
+		}
+		if event.Seq != result.Verified+1 || event.PrevHash != previous || !valid {
+			result.Valid = false
+			result.BrokenAt = result.Verified + 1
+			return result, nil
+		}
+
+		previous = event.Hash
+		result.Verified++
+	}
+
+	return result, cursor.Err()
+}
+
+// PersonalFields are the change fields that Redact removes.
+var PersonalFields = []string{"name", "email", "externalId"}
+
+const redacted = "[erased]"
+
+// Redact removes personal data from the events about a user in the tenant of ctx, keeping the
+// events themselves so the history stays complete. The values of personal fields are replaced
+// and the source address is dropped from events the user made.
+func Redact(ctx context.Context, userId int64) (int64, error) {
+	actor := UserActor(userId)
+	filter, err := tenant.Scope(ctx, bson.M{"$or": []bson.M{{"userId": userId}, {"actor": actor}}})
+	if err != nil {
+		return 0, err
+	}
+
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	now := time.Now().UTC()
+	var count int64
+	for cursor.Next(ctx) {
+		var event Event
+		if err := cursor.Decode(&event); err != nil {
+			return count, err
+		}
+
+		set := bson.M{}
+		if event.UserId == userId {
+			for _, field := range PersonalFields {
+				change, ok := event.Changes[field]
+				if !ok {
+					continue
+				}
+				if change.Before != nil {
+					set["changes."+field+".before"] = redacted
+				}
+				if change.After != nil {
+					set["changes."+field+".after"] = redacted
+				}
+			}
+		}
+
+		unset := bson.M{}
+		if event.Actor == actor && event.SourceIP != "" {
+			unset["sourceIp"] = ""
+		}
+		if len(set) == 0 && len(unset) == 0 {
+			continue
+		}
+		// Without the salt the personal hash can no longer be matched against guessed data.
+		if event.PersonalSalt != "" {
+			unset["personalSalt"] = ""
+		}
+		set["redactedAt"] = now
+
+		update := bson.M{"$set": set}
+		if len(unset) > 0 {
+			update["$unset"] = unset
+		}
+
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": event.Id}, update); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, cursor.Err()
+}
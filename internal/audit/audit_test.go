@@ -0,0 +1,144 @@
+package audit
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+	"time"
+)
+
+// chained returns an event as appendChained stores it.
+func chained(t *testing.T) Event {
+	t.Helper()
+
+	changes, err := normalize(map[string]Change{
+		"email": {Before: "ada@example.com", After: "lovelace@example.com"},
+		"roles": {Before: []string{"member"}, After: []string{"member", "admin"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := Event{
+		Id:           primitive.NewObjectID(),
+		TenantId:     "tenant-a",
+		Actor:        UserActor(7),
+		Action:       ActionRoleChange,
+		UserId:       7,
+		Changes:      changes,
+		RequestId:    "request-1",
+		SourceIP:     "203.0.113.7",
+		Timestamp:    time.Now().UTC().Truncate(time.Millisecond),
+		Seq:          3,
+		PrevHash:     "previous",
+		PersonalSalt: newSalt(),
+	}
+	if event.PersonalHash, err = personalHash(event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Hash, err = hash(event); err != nil {
+		t.Fatal(err)
+	}
+
+	return event
+}
+
+func TestHashSurvivesStorage(t *testing.T) {
+	event := chained(t)
+
+	stored, err := bson.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded Event
+	if err := bson.Unmarshal(stored, &loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, err := hash(loaded); err != nil || expected != event.Hash {
+		t.Errorf("hash %s after loading, want %s (%v)", expected, event.Hash, err)
+	}
+	if valid, err := verifyPersonal(loaded); err != nil || !valid {
+		t.Errorf("personal data of a loaded event does not verify: %v", err)
+	}
+}
+
+func TestHash(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(*Event)
+		changes bool
+	}{
+		{name: "tenant", tamper: func(e *Event) { e.TenantId = "tenant-b" }, changes: true},
+		{name: "actor", tamper: func(e *Event) { e.Actor = ActorSystem }, changes: true},
+		{name: "action", tamper: func(e *Event) { e.Action = ActionUpdate }, changes: true},
+		{name: "user", tamper: func(e *Event) { e.UserId = 8 }, changes: true},
+		{name: "other change", tamper: func(e *Event) { e.Changes["roles"] = Change{After: []any{"member"}} }, changes: true},
+		{name: "request", tamper: func(e *Event) { e.RequestId = "request-2" }, changes: true},
+		{name: "timestamp", tamper: func(e *Event) { e.Timestamp = e.Timestamp.Add(time.Millisecond) }, changes: true},
+		{name: "sequence", tamper: func(e *Event) { e.Seq = 4 }, changes: true},
+		{name: "previous hash", tamper: func(e *Event) { e.PrevHash = "other" }, changes: true},
+		{name: "personal hash", tamper: func(e *Event) { e.PersonalHash = "other" }, changes: true},
+		// Personal data is covered by the personal hash, so redacting it keeps the chain intact.
+		{name: "personal change", tamper: func(e *Event) { e.Changes["email"] = Change{Before: redacted, After: redacted} }},
+		{name: "source address", tamper: func(e *Event) { e.SourceIP = "" }},
+		{name: "salt", tamper: func(e *Event) { e.PersonalSalt = "" }},
+		{name: "redaction time", tamper: func(e *Event) { now := time.Now(); e.RedactedAt = &now }},
+		{name: "id", tamper: func(e *Event) { e.Id = primitive.NewObjectID() }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event := chained(t)
+			test.tamper(&event)
+
+			expected, err := hash(event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (expected != event.Hash) != test.changes {
+				t.Errorf("hash changed %v, want %v", expected != event.Hash, test.changes)
+			}
+		})
+	}
+}
+
+func TestVerifyPersonal(t *testing.T) {
+	now := time.Now().UTC()
+	redact := func(e *Event) {
+		e.Changes["email"] = Change{Before: redacted, After: redacted}
+		e.SourceIP = ""
+		e.PersonalSalt = ""
+		e.RedactedAt = &now
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(*Event)
+		valid  bool
+	}{
+		{name: "untouched", tamper: func(*Event) {}, valid: true},
+		{name: "personal value edited", tamper: func(e *Event) { e.Changes["email"] = Change{Before: "ada@example.com", After: "eve@example.com"} }},
+		{name: "personal value removed", tamper: func(e *Event) { delete(e.Changes, "email") }},
+		{name: "source address edited", tamper: func(e *Event) { e.SourceIP = "198.51.100.1" }},
+		{name: "salt replaced", tamper: func(e *Event) { e.PersonalSalt = newSalt() }},
+		{name: "redacted", tamper: redact, valid: true},
+		{name: "redacted keeping the salt", tamper: func(e *Event) { salt := e.PersonalSalt; redact(e); e.PersonalSalt = salt }},
+		{name: "redacted keeping a value", tamper: func(e *Event) { redact(e); e.Changes["email"] = Change{Before: redacted, After: "eve@example.com"} }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event := chained(t)
+			test.tamper(&event)
+
+			valid, err := verifyPersonal(event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if valid != test.valid {
+				t.Errorf("valid %v, want %v", valid, test.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package audit_test
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+	"time"
+	"userService/internal/audit"
+	"userService/internal/tenant"
+	"userService/internal/testdb"
+	"userService/internal/user"
+)
+
+// chain records five chained events for a tenant of its own and returns its context.
+func chain(t *testing.T) context.Context {
+	t.Helper()
+
+	ctx := testdb.Tenant(t)
+	audit.HashChain = true
+	t.Cleanup(func() { audit.HashChain = false })
+
+	ctx = audit.WithSourceIP(audit.WithActor(ctx, audit.UserActor(1)), "203.0.113.7")
+	for i := int64(1); i <= 5; i++ {
+		err := audit.Record(ctx, audit.Event{Action: audit.ActionUpdate, UserId: i, Changes: map[string]audit.Change{
+			"email": {Before: "before@example.com", After: "after@example.com"},
+			"roles": {After: []string{"member"}},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return ctx
+}
+
+func edit(t *testing.T, ctx context.Context, seq int64, update bson.M) {
+	t.Helper()
+
+	tenantId, _ := tenant.FromContext(ctx)
+	result, err := user.Database().Collection("audit").UpdateOne(ctx, bson.M{"tenantId": tenantId, "seq": seq}, update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ModifiedCount != 1 {
+		t.Fatalf("event %d was not changed", seq)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ctx := chain(t)
+
+	result, err := audit.Verify(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid || result.Verified != 5 {
+		t.Errorf("got %+v, want 5 valid events", result)
+	}
+
+	// Erasing user 1 redacts the event about it and the source address of all the events it made,
+	// and keeps the chain valid.
+	if redacted, err := audit.Redact(ctx, 1); err != nil || redacted != 5 {
+		t.Fatalf("redacted %d events, %v", redacted, err)
+	}
+	if result, err := audit.Verify(ctx); err != nil || !result.Valid || result.Verified != 5 {
+		t.Errorf("after redaction got %+v, %v", result, err)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, ctx context.Context)
+		broken int64
+	}{
+		{
+			name: "edited action",
+			tamper: func(t *testing.T, ctx context.Context) {
+				edit(t, ctx, 3, bson.M{"$set": bson.M{"action": audit.ActionDelete}})
+			},
+			broken: 3,
+		},
+		{
+			name: "edited role change",
+			tamper: func(t *testing.T, ctx context.Context) {
+				edit(t, ctx, 2, bson.M{"$set": bson.M{"changes.roles.after": bson.A{"admin"}}})
+			},
+			broken: 2,
+		},
+		{
+			name: "edited personal value",
+			tamper: func(t *testing.T, ctx context.Context) {
+				edit(t, ctx, 4, bson.M{"$set": bson.M{"changes.email.after": "eve@example.com"}})
+			},
+			broken: 4,
+		},
+		{
+			name: "faked redaction",
+			tamper: func(t *testing.T, ctx context.Context) {
+				edit(t, ctx, 2, bson.M{"$set": bson.M{"changes.email.after": "[erased]", "redactedAt": time.Now().UTC()}})
+			},
+			broken: 2,
+		},
+		{
+			name: "removed event",
+			tamper: func(t *testing.T, ctx context.Context) {
+				tenantId, _ := tenant.FromContext(ctx)
+				if _, err := user.Database().Collection("audit").DeleteOne(ctx, bson.M{"tenantId": tenantId, "seq": 2}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			broken: 2,
+		},
+		{
+			name: "removed head",
+			tamper: func(t *testing.T, ctx context.Context) {
+				tenantId, _ := tenant.FromContext(ctx)
+				if _, err := user.Database().Collection("audit").DeleteOne(ctx, bson.M{"tenantId": tenantId, "seq": 1}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			broken: 1,
+		},
+		{
+			name: "relinked event",
+			tamper: func(t *testing.T, ctx context.Context) {
+				edit(t, ctx, 3, bson.M{"$set": bson.M{"prevHash": "forged"}})
+			},
+			broken: 3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := chain(t)
+			test.tamper(t, ctx)
+
+			result, err := audit.Verify(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Valid || result.BrokenAt != test.broken {
+				t.Errorf("got %+v, want broken at %d", result, test.broken)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package auth
+
+import "context"
+
+// AdminService is the service of callers holding the admin token. They are trusted internal
+// callers and the only ones that may pick a tenant without a token for it.
+const AdminService = "admin"
+
+type contextKey struct{}
+
+// WithClaims records the verified claims of the caller of a request.
+func WithClaims(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+func FromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(Claims)
+
+	return claims, ok
+}
@@ -0,0 +1,29 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"userService/internal/config"
+)
+
+// Cache stores opaque values by key for up to a TTL. A value may be empty; found tells it
+// apart from a missing key.
+type Cache interface {
+	Get(ctx context.Context, key string) (value []byte, found bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+	Close() error
+}
+
+// New builds the cache selected by cfg.Backend.
+func New(cfg config.Cache) (Cache, error) {
+	switch cfg.Backend {
+	case "memory":
+		return NewLRU(cfg.MaxEntries), nil
+	case "redis":
+		return NewRedis(cfg.RedisURL)
+	}
+
+	return nil, fmt.Errorf("unknown cache backend %q", cfg.Backend)
+}
@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"testing"
+	"time"
+)
+
+// backend is a cache under test with a way to let time pass for its entries.
+type backend struct {
+	name    string
+	cache   Cache
+	advance func(time.Duration)
+}
+
+func backends(t *testing.T) []backend {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	redis, err := NewRedis("redis://" + server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = redis.Close() })
+
+	return []backend{
+		{name: "lru", cache: NewLRU(100), advance: time.Sleep},
+		{name: "redis", cache: redis, advance: server.FastForward},
+	}
+}
+
+func get(t *testing.T, c Cache, key string) (string, bool) {
+	t.Helper()
+
+	value, found, err := c.Get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(value), found
+}
+
+func set(t *testing.T, c Cache, key, value string, ttl time.Duration) {
+	t.Helper()
+
+	if err := c.Set(context.Background(), key, []byte(value), ttl); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCache(t *testing.T) {
+	for _, b := range backends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			if _, found := get(t, b.cache, "missing"); found {
+				t.Error("found a key that was never set")
+			}
+
+			set(t, b.cache, "a", "1", time.Minute)
+			set(t, b.cache, "a", "2", time.Minute)
+			if value, found := get(t, b.cache, "a"); !found || value != "2" {
+				t.Errorf("Get(a) = %q, %v, want the latest value", value, found)
+			}
+
+			// An empty value is how the user cache remembers ids that do not exist.
+			set(t, b.cache, "empty", "", time.Minute)
+			if value, found := get(t, b.cache, "empty"); !found || value != "" {
+				t.Errorf("Get(empty) = %q, %v, want an empty value", value, found)
+			}
+
+			set(t, b.cache, "b", "3", time.Minute)
+			if err := b.cache.Delete(ctx, "a", "b", "never-set"); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.cache.Delete(ctx); err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range []string{"a", "b"} {
+				if _, found := get(t, b.cache, key); found {
+					t.Errorf("%s is still cached after Delete", key)
+				}
+			}
+			if _, found := get(t, b.cache, "empty"); !found {
+				t.Error("Delete removed a key it was not given")
+			}
+		})
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	for _, b := range backends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			set(t, b.cache, "short", "1", 50*time.Millisecond)
+			set(t, b.cache, "long", "2", time.Minute)
+
+			b.advance(100 * time.Millisecond)
+
+			if _, found := get(t, b.cache, "short"); found {
+				t.Error("an entry outlived its TTL")
+			}
+			if value, found := get(t, b.cache, "long"); !found || value != "2" {
+				t.Errorf("Get(long) = %q, %v", value, found)
+			}
+		})
+	}
+}
+
+func TestLRUEviction(t *testing.T) {
+	c := NewLRU(3)
+	for i := range 3 {
+		set(t, c, fmt.Sprint(i), "value", time.Minute)
+	}
+
+	// Reading 0 makes 1 the least recently used entry.
+	if _, found := get(t, c, "0"); !found {
+		t.Fatal("0 is not cached")
+	}
+	set(t, c, "3", "value", time.Minute)
+
+	for key, want := range map[string]bool{"0": true, "1": false, "2": true, "3": true} {
+		if _, found := get(t, c, key); found != want {
+			t.Errorf("%s cached = %v, want %v", key, found, want)
+		}
+	}
+	if c.order.Len() != 3 || len(c.entries) != 3 {
+		t.Errorf("holds %d entries, want 3", c.order.Len())
+	}
+}
+
+func TestRedisPrefixesKeys(t *testing.T) {
+	server := miniredis.RunT(t)
+	c, err := NewRedis("redis://" + server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	set(t, c, "user:tenant-a:7", "value", time.Minute)
+
+	if !server.Exists(keyPrefix + "user:tenant-a:7") {
+		t.Errorf("keys = %v, want the key under %q", server.Keys(), keyPrefix)
+	}
+	if ttl := server.TTL(keyPrefix + "user:tenant-a:7"); ttl != time.Minute {
+		t.Errorf("TTL = %v, want 1m", ttl)
+	}
+}
+
+func TestRedisReportsErrors(t *testing.T) {
+	server := miniredis.RunT(t)
+	c, err := NewRedis("redis://" + server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	server.Close()
+
+	// The user cache logs these and falls back to the database.
+	if _, _, err := c.Get(context.Background(), "key"); err == nil {
+		t.Error("Get() hid that the server is gone")
+	}
+}
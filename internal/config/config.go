@@ -0,0 +1,235 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Mongo struct {
+	URL         string
+	MaxPoolSize uint64
+	MinPoolSize uint64
+	// ReadPreference is a mode name such as primary or secondaryPreferred.
+	ReadPreference string
+	// WriteConcern is majority or the number of nodes that must acknowledge a write.
+	WriteConcern           string
+	ServerSelectionTimeout time.Duration
+	OperationTimeout       time.Duration
+	// ConnectTimeout bounds how long startup keeps retrying an unreachable database.
+	ConnectTimeout time.Duration
+}
+
+type OIDC struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Encryption is disabled while Keyring is empty.
+type Encryption struct {
+	Keyring string
+	Fields  []string
+}
+
+// Events is disabled while Publisher is empty; otherwise it is memory, webhook, nats or kafka.
+type Events struct {
+	Publisher     string
+	RelayInterval time.Duration
+	WebhookURL    string
+	WebhookSecret string
+	NATSURL       string
+	NATSSubject   string
+	KafkaBrokers  []string
+	KafkaTopic    string
+}
+
+// Webhooks turns on tenant managed webhook subscriptions and their dispatcher.
+type Webhooks struct {
+	Enabled          bool
+	DispatchInterval time.Duration
+	MaxAttempts      int
+	// AllowPrivateTargets lets subscriptions point at loopback and private addresses; it is
+	// meant for development only.
+	AllowPrivateTargets bool
+}
+
+// Cache puts a read-through cache in front of user lookups while Backend is set; it is memory
+// or redis.
+type Cache struct {
+	Backend     string
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	MaxEntries  int
+	RedisURL    string
+}
+
+type Config struct {
+	HTTPAddr   string
+	GRPCAddr   string
+	AuthSecret string
+	TokenTTL   time.Duration
+	// SCIMEnabled serves SCIM to service tokens issued for scim.
+	SCIMEnabled bool
+	AdminToken  string
+	// DefaultTenant is assigned to data written before tenants existed, and used by commands and
+	// OIDC logins that name no tenant. Requests never fall back to it.
+	DefaultTenant string
+	InvitationURL string
+	InvitationTTL time.Duration
+	// SMTPAddr is the relay invitations are mailed through; without it the accept link is returned
+	// to the admin who created the invitation instead.
+	SMTPAddr        string
+	SMTPUsername    string
+	SMTPPassword    string
+	InvitationFrom  string
+	LogLevel        string
+	LogFormat       string
+	TraceExporter   string
+	ShutdownTimeout time.Duration
+	// MigrateOnStart applies pending migrations before serving.
+	MigrateOnStart bool
+	// DeletedRetention is how long soft deleted users are kept before being purged; zero keeps
+	// them forever.
+	DeletedRetention time.Duration
+	PurgeInterval    time.Duration
+	// AuditHashChain links audit events into a per-tenant hash chain.
+	AuditHashChain bool
+	// IdempotencyTTL is how long idempotency keys and their responses are kept.
+	IdempotencyTTL time.Duration
+	Mongo          Mongo
+	OIDC           OIDC
+	Encryption     Encryption
+	Events         Events
+	Webhooks       Webhooks
+	Cache          Cache
+}
+
+func (o OIDC) Enabled() bool {
+	return o.Issuer != "" && o.ClientID != ""
+}
+
+func Load() *Config {
+	return &Config{
+		HTTPAddr:         getEnv("HTTP_ADDR", ":8080"),
+		GRPCAddr:         getEnv("GRPC_ADDR", ":50051"),
+		AuthSecret:       getEnv("AUTH_SECRET", ""),
+		TokenTTL:         getDuration("TOKEN_TTL", time.Hour),
+		SCIMEnabled:      getBool("SCIM_ENABLED", false),
+		AdminToken:       getEnv("ADMIN_TOKEN", ""),
+		DefaultTenant:    getEnv("DEFAULT_TENANT", ""),
+		InvitationURL:    getEnv("INVITATION_URL", "http://localhost:8080/v1/invitations/accept"),
+		InvitationTTL:    getDuration("INVITATION_TTL", 72*time.Hour),
+		SMTPAddr:         getEnv("SMTP_ADDR", ""),
+		SMTPUsername:     getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:     getEnv("SMTP_PASSWORD", ""),
+		InvitationFrom:   getEnv("INVITATION_FROM", "no-reply@localhost"),
+		LogLevel:         getEnv("LOG_LEVEL", "info"),
+		LogFormat:        getEnv("LOG_FORMAT", "json"),
+		TraceExporter:    getEnv("TRACE_EXPORTER", "none"),
+		ShutdownTimeout:  getDuration("SHUTDOWN_TIMEOUT", 15*time.Second),
+		MigrateOnStart:   getBool("MIGRATE_ON_START", false),
+		DeletedRetention: getDuration("DELETED_RETENTION", 30*24*time.Hour),
+		PurgeInterval:    getDuration("PURGE_INTERVAL", time.Hour),
+		AuditHashChain:   getBool("AUDIT_HASH_CHAIN", false),
+		IdempotencyTTL:   getDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		Mongo: Mongo{
+			URL:                    getEnv("MONGO_URL", "mongodb://localhost:27017"),
+			MaxPoolSize:            getUint("MONGO_MAX_POOL_SIZE", 100),
+			MinPoolSize:            getUint("MONGO_MIN_POOL_SIZE", 0),
+			ReadPreference:         getEnv("MONGO_READ_PREFERENCE", "primary"),
+			WriteConcern:           getEnv("MONGO_WRITE_CONCERN", "majority"),
+			ServerSelectionTimeout: getDuration("MONGO_SERVER_SELECTION_TIMEOUT", 5*time.Second),
+			OperationTimeout:       getDuration("MONGO_OPERATION_TIMEOUT", 10*time.Second),
+			ConnectTimeout:         getDuration("MONGO_CONNECT_TIMEOUT", time.Minute),
+		},
+		OIDC: OIDC{
+			Issuer:       strings.TrimSuffix(getEnv("OIDC_ISSUER", ""), "/"),
+			ClientID:     getEnv("OIDC_CLIENT_ID", ""),
+			ClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:  getEnv("OIDC_REDIRECT_URL", "http://localhost:8080/auth/oidc/callback"),
+			Scopes:       getList("OIDC_SCOPES", []string{"openid", "email", "profile"}),
+		},
+		Encryption: Encryption{
+			Keyring: getEnv("ENCRYPTION_KEYRING", ""),
+			Fields:  getList("ENCRYPTED_FIELDS", []string{"name", "email"}),
+		},
+		Events: Events{
+			Publisher:     getEnv("EVENT_PUBLISHER", ""),
+			RelayInterval: getDuration("EVENT_RELAY_INTERVAL", time.Second),
+			WebhookURL:    getEnv("EVENT_WEBHOOK_URL", ""),
+			WebhookSecret: getEnv("EVENT_WEBHOOK_SECRET", ""),
+			NATSURL:       getEnv("NATS_URL", "nats://localhost:4222"),
+			NATSSubject:   getEnv("NATS_SUBJECT", "users"),
+			KafkaBrokers:  getList("KAFKA_BROKERS", []string{"localhost:9092"}),
+			KafkaTopic:    getEnv("KAFKA_TOPIC", "users"),
+		},
+		Webhooks: Webhooks{
+			Enabled:             getBool("WEBHOOKS_ENABLED", false),
+			DispatchInterval:    getDuration("WEBHOOK_DISPATCH_INTERVAL", 5*time.Second),
+			MaxAttempts:         int(getUint("WEBHOOK_MAX_ATTEMPTS", 8)),
+			AllowPrivateTargets: getBool("WEBHOOK_ALLOW_PRIVATE_TARGETS", false),
+		},
+		Cache: Cache{
+			Backend:     getEnv("USER_CACHE", ""),
+			TTL:         getDuration("USER_CACHE_TTL", 30*time.Second),
+			NegativeTTL: getDuration("USER_CACHE_NEGATIVE_TTL", 5*time.Second),
+			MaxEntries:  int(getUint("USER_CACHE_MAX_ENTRIES", 10000)),
+			RedisURL:    getEnv("REDIS_URL", "redis://localhost:6379/0"),
+		},
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+
+	return value
+}
+
+func getBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+
+	return value
+}
+
+func getUint(key string, fallback uint64) uint64 {
+	value, err := strconv.ParseUint(getEnv(key, ""), 10, 64)
+	if err != nil {
+		return fallback
+	}
+
+	return value
+}
+
+func getList(key string, fallback []string) []string {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,166 @@
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// prefix marks encrypted values, so plain values written before encryption was enabled can
+// still be read and later re-encrypted.
+const prefix = "enc:v1:"
+
+var ErrMalformed = errors.New("malformed encrypted value")
+
+// Cipher encrypts field values with envelope encryption: each value gets a fresh AES-256-GCM
+// data key, which is stored next to it wrapped by the provider's current key. Values are
+// stored as strings of the form enc:v1:<key id>:<wrapped data key>:<ciphertext>.
+type Cipher struct {
+	provider KeyProvider
+}
+
+func NewCipher(provider KeyProvider) *Cipher {
+	return &Cipher{provider: provider}
+}
+
+func (c *Cipher) CurrentKeyId(ctx context.Context) (string, error) {
+	key, err := c.provider.CurrentKey(ctx)
+
+	return key.Id, err
+}
+
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// KeyId returns the id of the key that wrapped value, or "" for a plain value.
+func KeyId(value string) string {
+	if !IsEncrypted(value) {
+		return ""
+	}
+
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+
+	return id
+}
+
+// Encrypt binds the ciphertext to binding, typically the tenant, document and field, so a
+// value copied elsewhere fails to decrypt.
+func (c *Cipher) Encrypt(ctx context.Context, plaintext, binding string) (string, error) {
+	key, err := c.provider.CurrentKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	wrapped, err := seal(key.Material, dataKey, []byte(key.Id))
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(dataKey, []byte(plaintext), []byte(binding))
+	if err != nil {
+		return "", err
+	}
+
+	encoding := base64.RawURLEncoding
+	return prefix + key.Id + ":" + encoding.EncodeToString(wrapped) + ":" + encoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns plain values unchanged.
+func (c *Cipher) Decrypt(ctx context.Context, value, binding string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", ErrMalformed
+	}
+
+	key, err := c.provider.Key(ctx, parts[0])
+	if err != nil {
+		return "", err
+	}
+
+	encoding := base64.RawURLEncoding
+	wrapped, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	sealed, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	dataKey, err := open(key.Material, wrapped, []byte(key.Id))
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataKey, sealed, []byte(binding))
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// BlindIndex is a keyed hash of value for equality lookups on an encrypted field. Callers
+// normalize value first, for example by lowercasing emails.
+func (c *Cipher) BlindIndex(ctx context.Context, value string) (string, error) {
+	key, err := c.provider.IndexKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func seal(key, plaintext, additional []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(key, sealed, additional []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+
+	return aead.Open(nil, nonce, ciphertext, additional)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
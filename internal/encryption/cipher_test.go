@@ -0,0 +1,199 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newKeyring(current string, ids ...string) *Keyring {
+	keyring := &Keyring{current: current, keys: map[string][]byte{}, indexKey: bytes.Repeat([]byte{'i'}, keySize)}
+	for _, id := range ids {
+		keyring.keys[id] = bytes.Repeat([]byte(id[len(id)-1:]), keySize)
+	}
+
+	return keyring
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	cipher := NewCipher(newKeyring("k1", "k1"))
+
+	for _, plaintext := range []string{"", "ada@example.com", "Ada Lovelace", "名前 with: colons"} {
+		sealed, err := cipher.Encrypt(ctx, plaintext, "tenant/1/name")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsEncrypted(sealed) || KeyId(sealed) != "k1" {
+			t.Errorf("%q: sealed as %q", plaintext, sealed)
+		}
+		if plaintext != "" && strings.Contains(sealed, plaintext) {
+			t.Errorf("%q: plaintext is visible in %q", plaintext, sealed)
+		}
+
+		again, err := cipher.Encrypt(ctx, plaintext, "tenant/1/name")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again == sealed {
+			t.Errorf("%q: encrypting twice gave the same value", plaintext)
+		}
+
+		opened, err := cipher.Decrypt(ctx, sealed, "tenant/1/name")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opened != plaintext {
+			t.Errorf("got %q, want %q", opened, plaintext)
+		}
+	}
+}
+
+func TestDecryptPlainValue(t *testing.T) {
+	cipher := NewCipher(newKeyring("k1", "k1"))
+
+	opened, err := cipher.Decrypt(context.Background(), "ada@example.com", "tenant/1/email")
+	if err != nil || opened != "ada@example.com" {
+		t.Errorf("got %q, %v", opened, err)
+	}
+	if KeyId("ada@example.com") != "" {
+		t.Error("plain value has a key id")
+	}
+}
+
+func TestDecryptRejects(t *testing.T) {
+	ctx := context.Background()
+	cipher := NewCipher(newKeyring("k1", "k1"))
+
+	sealed, err := cipher.Encrypt(ctx, "ada@example.com", "tenant/1/email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(sealed, ":")
+
+	// The same key id with other material stands for a wrong key.
+	wrongKey := newKeyring("k1", "k1")
+	wrongKey.keys["k1"] = bytes.Repeat([]byte{'x'}, keySize)
+
+	tests := []struct {
+		name    string
+		cipher  *Cipher
+		value   string
+		binding string
+		want    error
+	}{
+		{name: "wrong key", cipher: NewCipher(wrongKey), value: sealed, binding: "tenant/1/email"},
+		{name: "unknown key", cipher: NewCipher(newKeyring("k2", "k2")), value: sealed, binding: "tenant/1/email", want: ErrUnknownKey},
+		{name: "other binding", cipher: cipher, value: sealed, binding: "tenant/2/email"},
+		{name: "tampered ciphertext", cipher: cipher, value: strings.Join(parts[:4], ":") + ":" + tamper(parts[4]), binding: "tenant/1/email"},
+		{name: "tampered data key", cipher: cipher, value: strings.Join(parts[:3], ":") + ":" + tamper(parts[3]) + ":" + parts[4], binding: "tenant/1/email"},
+		{name: "missing part", cipher: cipher, value: strings.Join(parts[:4], ":"), binding: "tenant/1/email", want: ErrMalformed},
+		{name: "invalid encoding", cipher: cipher, value: strings.Join(parts[:4], ":") + ":!!", binding: "tenant/1/email", want: ErrMalformed},
+		{name: "too short", cipher: cipher, value: strings.Join(parts[:4], ":") + ":AA", binding: "tenant/1/email", want: ErrMalformed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opened, err := test.cipher.Decrypt(ctx, test.value, test.binding)
+			if err == nil {
+				t.Fatalf("decrypted to %q", opened)
+			}
+			if test.want != nil && !errors.Is(err, test.want) {
+				t.Errorf("error %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+// tamper flips the first character of an encoded value to another valid one.
+func tamper(encoded string) string {
+	if encoded[0] == 'A' {
+		return "B" + encoded[1:]
+	}
+
+	return "A" + encoded[1:]
+}
+
+func TestKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	keyring := newKeyring("k1", "k1")
+	cipher := NewCipher(keyring)
+
+	old, err := cipher.Encrypt(ctx, "ada@example.com", "tenant/1/email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldIndex, err := cipher.BlindIndex(ctx, "ada@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring.keys["k2"] = bytes.Repeat([]byte{'2'}, keySize)
+	keyring.current = "k2"
+
+	if id, err := cipher.CurrentKeyId(ctx); err != nil || id != "k2" {
+		t.Fatalf("current key %q, %v", id, err)
+	}
+	rotated, err := cipher.Encrypt(ctx, "ada@example.com", "tenant/1/email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if KeyId(rotated) != "k2" || KeyId(old) != "k1" {
+		t.Errorf("key ids %q and %q", KeyId(old), KeyId(rotated))
+	}
+
+	for _, value := range []string{old, rotated} {
+		if opened, err := cipher.Decrypt(ctx, value, "tenant/1/email"); err != nil || opened != "ada@example.com" {
+			t.Errorf("got %q, %v", opened, err)
+		}
+	}
+
+	// Rotating the key encryption key leaves blind indexes alone.
+	if index, err := cipher.BlindIndex(ctx, "ada@example.com"); err != nil || index != oldIndex {
+		t.Errorf("index changed to %q, %v", index, err)
+	}
+
+	delete(keyring.keys, "k1")
+	if _, err := cipher.Decrypt(ctx, old, "tenant/1/email"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("error %v, want %v", err, ErrUnknownKey)
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	ctx := context.Background()
+	cipher := NewCipher(newKeyring("k1", "k1"))
+	same := NewCipher(newKeyring("k2", "k2"))
+	otherKeyring := newKeyring("k1", "k1")
+	otherKeyring.indexKey = bytes.Repeat([]byte{'o'}, keySize)
+	other := NewCipher(otherKeyring)
+
+	index := func(c *Cipher, value string) string {
+		t.Helper()
+
+		result, err := c.BlindIndex(ctx, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return result
+	}
+
+	first := index(cipher, "email:ada@example.com")
+	if index(cipher, "email:ada@example.com") != first {
+		t.Error("index is not stable")
+	}
+	if index(same, "email:ada@example.com") != first {
+		t.Error("index depends on the key encryption key")
+	}
+	if index(cipher, "email:bob@example.com") == first {
+		t.Error("different values share an index")
+	}
+	if index(other, "email:ada@example.com") == first {
+		t.Error("different index keys give the same index")
+	}
+	if strings.Contains(first, "ada") {
+		t.Errorf("index %q reveals the value", first)
+	}
+}
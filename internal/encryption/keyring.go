@@ -0,0 +1,103 @@
+package encryption
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const keySize = 32
+
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// Key is a key encryption key. Data keys are wrapped with it, so it never touches field values
+// directly.
+type Key struct {
+	Id       string
+	Material []byte
+}
+
+// KeyProvider supplies key encryption keys, for example from a KMS. Keys that are no longer
+// current must stay available until the rotation job has re-encrypted everything under them.
+type KeyProvider interface {
+	CurrentKey(ctx context.Context) (Key, error)
+	Key(ctx context.Context, id string) (Key, error)
+	// IndexKey is the secret for blind indexes. Changing it invalidates every index value.
+	IndexKey(ctx context.Context) ([]byte, error)
+}
+
+// Keyring is a KeyProvider backed by a local JSON file, meant for development:
+//
+//	{"current": "k2", "keys": {"k1": "<base64>", "k2": "<base64>"}, "indexKey": "<base64>"}
+//
+// Every key is 32 random bytes.
+type Keyring struct {
+	current  string
+	keys     map[string][]byte
+	indexKey []byte
+}
+
+type keyringFile struct {
+	Current  string            `json:"current"`
+	Keys     map[string]string `json:"keys"`
+	IndexKey string            `json:"indexKey"`
+}
+
+func LoadKeyring(path string) (*Keyring, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file keyringFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("keyring %s: %w", path, err)
+	}
+
+	keyring := &Keyring{current: file.Current, keys: map[string][]byte{}}
+	for id, encoded := range file.Keys {
+		if keyring.keys[id], err = decodeKey(encoded); err != nil {
+			return nil, fmt.Errorf("keyring %s: key %q: %w", path, id, err)
+		}
+	}
+	if _, ok := keyring.keys[file.Current]; !ok {
+		return nil, fmt.Errorf("keyring %s: current key %q is missing", path, file.Current)
+	}
+	if keyring.indexKey, err = decodeKey(file.IndexKey); err != nil {
+		return nil, fmt.Errorf("keyring %s: index key: %w", path, err)
+	}
+
+	return keyring, nil
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key must be %d bytes", keySize)
+	}
+
+	return key, nil
+}
+
+func (k *Keyring) CurrentKey(ctx context.Context) (Key, error) {
+	return k.Key(ctx, k.current)
+}
+
+func (k *Keyring) Key(_ context.Context, id string) (Key, error) {
+	material, ok := k.keys[id]
+	if !ok {
+		return Key{}, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+
+	return Key{Id: id, Material: material}, nil
+}
+
+func (k *Keyring) IndexKey(context.Context) ([]byte, error) {
+	return k.indexKey, nil
+}
@@ -0,0 +1,50 @@
+package encryption
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadKeyring(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", keySize)))
+	short := base64.StdEncoding.EncodeToString([]byte("short"))
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "valid", content: `{"current":"k2","keys":{"k1":"` + key + `","k2":"` + key + `"},"indexKey":"` + key + `"}`},
+		{name: "missing current key", content: `{"current":"k3","keys":{"k1":"` + key + `"},"indexKey":"` + key + `"}`, wantErr: true},
+		{name: "short key", content: `{"current":"k1","keys":{"k1":"` + short + `"},"indexKey":"` + key + `"}`, wantErr: true},
+		{name: "invalid base64", content: `{"current":"k1","keys":{"k1":"!!"},"indexKey":"` + key + `"}`, wantErr: true},
+		{name: "missing index key", content: `{"current":"k1","keys":{"k1":"` + key + `"}}`, wantErr: true},
+		{name: "invalid json", content: `{"current":`, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keyring.json")
+			if err := os.WriteFile(path, []byte(test.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			keyring, err := LoadKeyring(path)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error %v, want error %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+
+			current, err := keyring.CurrentKey(context.Background())
+			if err != nil || current.Id != "k2" || len(current.Material) != keySize {
+				t.Errorf("current key %+v, %v", current, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package events
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+	"userService/internal/tenant"
+)
+
+const (
+	UserCreated = "UserCreated"
+	UserUpdated = "UserUpdated"
+	UserDeleted = "UserDeleted"
+)
+
+// Event is a change to a user as published to other services. Version is the user version
+// after the change, so consumers can drop events they already applied. Events hold no personal
+// data; consumers read the user itself through the API.
+type Event struct {
+	Id         primitive.ObjectID `json:"id" bson:"_id"`
+	Type       string             `json:"type" bson:"type"`
+	TenantId   string             `json:"tenantId" bson:"tenantId"`
+	UserId     int64              `json:"userId" bson:"userId"`
+	Version    int64              `json:"version" bson:"version"`
+	OccurredAt time.Time          `json:"occurredAt" bson:"occurredAt"`
+	// Fields names the fields a UserUpdated changed.
+	Fields []string `json:"fields,omitempty" bson:"fields,omitempty"`
+	// Attempts counts failed deliveries and is not published.
+	Attempts int `json:"-" bson:"attempts,omitempty"`
+}
+
+// EventPublisher delivers events to consumers. Publish must only return nil once the event is
+// durably accepted, since the relay then drops it from the outbox.
+type EventPublisher interface {
+	Publish(ctx context.Context, event Event) error
+	Close() error
+}
+
+// Outbox turns on writing events. Writes then run in transactions, which need a replica set.
+var Outbox bool
+
+var outbox *mongo.Collection
+
+func UseDatabase(database *mongo.Database) {
+	outbox = database.Collection("outbox")
+}
+
+// Add writes events to the outbox. ctx must carry the transaction of the change they describe,
+// so that either both or neither are stored.
+func Add(ctx context.Context, events ...Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	documents := make([]any, len(events))
+	for i, event := range events {
+		event.Id = primitive.NewObjectID()
+		event.OccurredAt = now
+		if event.TenantId == "" {
+			event.TenantId, _ = tenant.FromContext(ctx)
+		}
+		documents[i] = event
+	}
+
+	_, err := outbox.InsertMany(ctx, documents)
+
+	return err
+}
+
+// EraseUser strips the user data that events written before they stopped carrying it hold, from
+// the events of the user still waiting in the outbox.
+func EraseUser(ctx context.Context, userId int64) error {
+	filter, err := tenant.Scope(ctx, bson.M{"userId": userId, "data": bson.M{"$exists": true}})
+	if err != nil {
+		return err
+	}
+
+	_, err = outbox.UpdateMany(ctx, filter, bson.M{"$unset": bson.M{"data": ""}})
+
+	return err
+}
@@ -0,0 +1,19 @@
+package events
+
+import (
+	"context"
+)
+
+// The relay tests live in events_test, since they need testdb, which imports this package.
+
+func NewRelayFor(publisher EventPublisher, owner string) *Relay {
+	return &Relay{publisher: publisher, owner: owner}
+}
+
+func (r *Relay) Relay(ctx context.Context) error {
+	return r.relay(ctx)
+}
+
+func (r *Relay) Lease(ctx context.Context) (bool, error) {
+	return r.lease(ctx)
+}
@@ -0,0 +1,45 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/segmentio/kafka-go"
+	"strconv"
+)
+
+// KafkaPublisher writes events to a topic keyed by tenant and user, so all events of a user land
+// on one partition in order. Every write waits for all in-sync replicas.
+type KafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaPublisher(brokers []string, topic string) *KafkaPublisher {
+	return &KafkaPublisher{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		// The relay publishes one event at a time, so there is nothing to wait for.
+		BatchSize: 1,
+	}}
+}
+
+func (p *KafkaPublisher) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(event.TenantId + "/" + strconv.FormatInt(event.UserId, 10)),
+		Value: body,
+		Headers: []kafka.Header{
+			{Key: "event-id", Value: []byte(event.Id.Hex())},
+			{Key: "event-type", Value: []byte(event.Type)},
+		},
+	})
+}
+
+func (p *KafkaPublisher) Close() error {
+	return p.writer.Close()
+}
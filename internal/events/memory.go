@@ -0,0 +1,151 @@
+package events
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sync"
+)
+
+const (
+	memoryHistory = 1024
+	watchBuffer   = 256
+)
+
+// MemoryPublisher broadcasts events to watchers in this process and keeps the latest ones, so
+// a watcher can resume from an event id that is still in that history. Since only the replica
+// running the relay publishes, it is meant for single instance deployments.
+type MemoryPublisher struct {
+	mu          sync.Mutex
+	history     []Event
+	subscribers map[*subscriber]struct{}
+}
+
+// subscriber is dropped, with lagged set, once its buffer is full, rather than holding up the
+// relay or silently missing events.
+type subscriber struct {
+	events chan Event
+	lagged bool
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{subscribers: map[*subscriber]struct{}{}}
+}
+
+func (m *MemoryPublisher) Publish(_ context.Context, event Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.history) == memoryHistory {
+		copy(m.history, m.history[1:])
+		m.history = m.history[:memoryHistory-1]
+	}
+	m.history = append(m.history, event)
+
+	for s := range m.subscribers {
+		select {
+		case s.events <- event:
+		default:
+			s.lagged = true
+			delete(m.subscribers, s)
+			close(s.events)
+		}
+	}
+
+	return nil
+}
+
+// Watch replays the events after resumeToken that are still in the history and then follows
+// new ones. Its tokens are event ids.
+func (m *MemoryPublisher) Watch(ctx context.Context, filter Filter, resumeToken string, fn func(event Event, token string) error) error {
+	backlog, s, err := m.subscribe(resumeToken)
+	if err != nil {
+		return err
+	}
+	defer m.unsubscribe(s)
+
+	for _, event := range backlog {
+		if filter.matches(event) {
+			if err := fn(event, event.Id.Hex()); err != nil {
+				return err
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-s.events:
+			if !ok {
+				return m.closed(s)
+			}
+			if filter.matches(event) {
+				if err := fn(event, event.Id.Hex()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func (m *MemoryPublisher) subscribe(resumeToken string) ([]Event, *subscriber, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var backlog []Event
+	if resumeToken != "" {
+		id, err := primitive.ObjectIDFromHex(resumeToken)
+		if err != nil {
+			return nil, nil, ErrInvalidResumeToken
+		}
+
+		found := false
+		for i, event := range m.history {
+			if event.Id == id {
+				backlog, found = append(backlog, m.history[i+1:]...), true
+				break
+			}
+		}
+		if !found {
+			return nil, nil, ErrResumeTokenExpired
+		}
+	}
+
+	s := &subscriber{events: make(chan Event, watchBuffer)}
+	m.subscribers[s] = struct{}{}
+
+	return backlog, s, nil
+}
+
+func (m *MemoryPublisher) unsubscribe(s *subscriber) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.subscribers[s]; ok {
+		delete(m.subscribers, s)
+		close(s.events)
+	}
+}
+
+func (m *MemoryPublisher) closed(s *subscriber) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s.lagged {
+		return ErrLagging
+	}
+
+	return nil
+}
+
+func (m *MemoryPublisher) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for s := range m.subscribers {
+		delete(m.subscribers, s)
+		close(s.events)
+	}
+
+	return nil
+}
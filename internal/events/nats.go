@@ -0,0 +1,49 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/nats-io/nats.go"
+)
+
+// NATSPublisher publishes to JetStream on <subject>.<event type> and waits for the stream to
+// acknowledge each event. The event id is the message id, so JetStream drops redeliveries
+// within its duplicate window.
+type NATSPublisher struct {
+	conn    *nats.Conn
+	stream  nats.JetStreamContext
+	subject string
+}
+
+func NewNATSPublisher(url, subject string) (*NATSPublisher, error) {
+	conn, err := nats.Connect(url, nats.Name("userService"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &NATSPublisher{conn: conn, stream: stream, subject: subject}, nil
+}
+
+func (p *NATSPublisher) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	message := nats.NewMsg(p.subject + "." + event.Type)
+	message.Data = body
+	message.Header.Set("Tenant-Id", event.TenantId)
+	_, err = p.stream.PublishMsg(message, nats.Context(ctx), nats.MsgId(event.Id.Hex()))
+
+	return err
+}
+
+func (p *NATSPublisher) Close() error {
+	return p.conn.Drain()
+}
@@ -0,0 +1,58 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"userService/internal/config"
+)
+
+// NewPublisher builds the publisher selected by cfg.Publisher.
+func NewPublisher(cfg config.Events) (EventPublisher, error) {
+	switch cfg.Publisher {
+	case "memory":
+		return NewMemoryPublisher(), nil
+	case "webhook":
+		if cfg.WebhookURL == "" {
+			return nil, errors.New("EVENT_WEBHOOK_URL is required for the webhook publisher")
+		}
+		return NewWebhookPublisher(cfg.WebhookURL, cfg.WebhookSecret), nil
+	case "nats":
+		return NewNATSPublisher(cfg.NATSURL, cfg.NATSSubject)
+	case "kafka":
+		return NewKafkaPublisher(cfg.KafkaBrokers, cfg.KafkaTopic), nil
+	}
+
+	return nil, fmt.Errorf("unknown event publisher %q", cfg.Publisher)
+}
+
+// fanout hands every event to all of its publishers. It fails when any of them fails, and the
+// relay then publishes the event to all of them again.
+type fanout []EventPublisher
+
+// Combine returns a publisher for all of publishers.
+func Combine(publishers ...EventPublisher) EventPublisher {
+	if len(publishers) == 1 {
+		return publishers[0]
+	}
+
+	return fanout(publishers)
+}
+
+func (f fanout) Publish(ctx context.Context, event Event) error {
+	var errs []error
+	for _, publisher := range f {
+		errs = append(errs, publisher.Publish(ctx, event))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (f fanout) Close() error {
+	var errs []error
+	for _, publisher := range f {
+		errs = append(errs, publisher.Close())
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,201 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+	"userService/internal/metrics"
+)
+
+const (
+	relayLockId    = "relay"
+	relayLeaseTTL  = 30 * time.Second
+	relayBatchSize = 100
+	// relayPublishTimeout bounds one publish well within the lease, which is renewed between
+	// publishes.
+	relayPublishTimeout = 10 * time.Second
+	// relayMaxAttempts is how often an event may fail before it is moved to the dead letter
+	// collection, so that it no longer holds up the later events of its user.
+	relayMaxAttempts = 10
+)
+
+type userKey struct {
+	tenantId string
+	userId   int64
+}
+
+// Relay moves events from the outbox to a publisher. Only the replica holding the relay lease
+// publishes, and an event leaves the outbox only after it was published, so every event is
+// delivered at least once. Events of one user are published in the order they were written,
+// unless one failed relayMaxAttempts times and was dead lettered.
+type Relay struct {
+	publisher EventPublisher
+	interval  time.Duration
+	owner     string
+	// leasedAt is when the lease was last taken or renewed.
+	leasedAt time.Time
+}
+
+func NewRelay(publisher EventPublisher, interval time.Duration) *Relay {
+	host, _ := os.Hostname()
+
+	return &Relay{publisher: publisher, interval: interval, owner: host + ":" + strconv.Itoa(os.Getpid())}
+}
+
+func (r *Relay) locks() *mongo.Collection {
+	return outbox.Database().Collection("outbox.lock")
+}
+
+func deadLetters() *mongo.Collection {
+	return outbox.Database().Collection("outbox.dead")
+}
+
+// Run relays events every interval until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		err := r.relay(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("relay outbox events failed", slog.Any("error", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// lease takes or renews the relay lease; a lease left by a replica that stopped expires after
+// relayLeaseTTL.
+func (r *Relay) lease(ctx context.Context) (bool, error) {
+	now := time.Now().UTC()
+	filter := bson.M{"_id": relayLockId, "$or": []bson.M{{"owner": r.owner}, {"expiresAt": bson.M{"$lt": now}}}}
+	update := bson.M{"$set": bson.M{"owner": r.owner, "expiresAt": now.Add(relayLeaseTTL)}}
+
+	_, err := r.locks().UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err == nil {
+		r.leasedAt = now
+	}
+
+	return err == nil, err
+}
+
+// renew renews the lease once a third of it has passed, so that a slow batch cannot outlive it
+// and let another replica publish the same events.
+func (r *Relay) renew(ctx context.Context) (bool, error) {
+	if time.Since(r.leasedAt) < relayLeaseTTL/3 {
+		return true, nil
+	}
+
+	return r.lease(ctx)
+}
+
+// relay publishes the oldest events in the outbox until it is empty or a whole batch failed. A
+// user whose event failed is skipped for the rest of the pass, so its later events cannot
+// overtake the failed one.
+func (r *Relay) relay(ctx context.Context) error {
+	blocked := map[userKey]bool{}
+
+	for {
+		if held, err := r.lease(ctx); err != nil || !held {
+			return err
+		}
+
+		filter := bson.M{}
+		if len(blocked) > 0 {
+			skip := make([]bson.M, 0, len(blocked))
+			for key := range blocked {
+				skip = append(skip, bson.M{"tenantId": key.tenantId, "userId": key.userId})
+			}
+			filter["$nor"] = skip
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(relayBatchSize)
+		cursor, err := outbox.Find(ctx, filter, opts)
+		if err != nil {
+			return err
+		}
+
+		var batch []Event
+		if err := cursor.All(ctx, &batch); err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		published := false
+		for _, event := range batch {
+			key := userKey{tenantId: event.TenantId, userId: event.UserId}
+			if blocked[key] {
+				continue
+			}
+			if held, err := r.renew(ctx); err != nil || !held {
+				return err
+			}
+
+			if err := r.publish(ctx, event); err != nil {
+				metrics.EventsPublished.WithLabelValues("error").Inc()
+				slog.Warn("publish event failed", slog.String("event", event.Id.Hex()), slog.String("type", event.Type),
+					slog.Int("attempts", event.Attempts+1), slog.Any("error", err))
+				if event.Attempts+1 >= relayMaxAttempts {
+					if err := deadLetter(ctx, event); err != nil {
+						return err
+					}
+					continue
+				}
+
+				blocked[key] = true
+				if _, err := outbox.UpdateByID(ctx, event.Id, bson.M{"$inc": bson.M{"attempts": 1}}); err != nil {
+					return err
+				}
+				continue
+			}
+
+			published = true
+			metrics.EventsPublished.WithLabelValues("ok").Inc()
+			if _, err := outbox.DeleteOne(ctx, bson.M{"_id": event.Id}); err != nil {
+				return err
+			}
+		}
+
+		if !published {
+			return nil
+		}
+	}
+}
+
+func (r *Relay) publish(ctx context.Context, event Event) error {
+	ctx, cancel := context.WithTimeout(ctx, relayPublishTimeout)
+	defer cancel()
+
+	return r.publisher.Publish(ctx, event)
+}
+
+// deadLetter moves an event that keeps failing out of the outbox, keeping it for inspection.
+func deadLetter(ctx context.Context, event Event) error {
+	event.Attempts++
+	if _, err := deadLetters().InsertOne(ctx, event); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	metrics.EventsPublished.WithLabelValues("dead").Inc()
+	slog.Error("event dead lettered", slog.String("event", event.Id.Hex()), slog.String("type", event.Type),
+		slog.String("tenant", event.TenantId), slog.Int64("userId", event.UserId))
+
+	_, err := outbox.DeleteOne(ctx, bson.M{"_id": event.Id})
+
+	return err
+}
@@ -0,0 +1,193 @@
+package events_test
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sync"
+	"testing"
+	"time"
+	"userService/internal/events"
+	"userService/internal/tenant"
+	"userService/internal/testdb"
+	"userService/internal/user"
+)
+
+// recorder counts publishes per event and fails them all while err is set.
+type recorder struct {
+	mu    sync.Mutex
+	calls map[primitive.ObjectID]int
+	err   error
+}
+
+func (r *recorder) Publish(_ context.Context, event events.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.calls == nil {
+		r.calls = map[primitive.ObjectID]int{}
+	}
+	r.calls[event.Id]++
+
+	return r.err
+}
+
+func (r *recorder) Close() error {
+	return nil
+}
+
+func (r *recorder) count(id primitive.ObjectID) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.calls[id]
+}
+
+// relayTenant returns a test tenant with the relay lease released, and removes the tenant's
+// events when the test ends.
+func relayTenant(t *testing.T) context.Context {
+	t.Helper()
+
+	ctx := testdb.Tenant(t)
+	tenantId, _ := tenant.FromContext(ctx)
+	database := user.Database()
+
+	release := func() {
+		if _, err := database.Collection("outbox.lock").DeleteOne(context.Background(), bson.M{"_id": "relay"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	release()
+	t.Cleanup(func() {
+		release()
+		for _, name := range []string{"outbox", "outbox.dead"} {
+			if _, err := database.Collection(name).DeleteMany(context.Background(), bson.M{"tenantId": tenantId}); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+
+	return ctx
+}
+
+func tenantEvents(t *testing.T, ctx context.Context, collection string) map[int64]events.Event {
+	t.Helper()
+
+	tenantId, _ := tenant.FromContext(ctx)
+	cursor, err := user.Database().Collection(collection).Find(ctx, bson.M{"tenantId": tenantId})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found []events.Event
+	if err := cursor.All(ctx, &found); err != nil {
+		t.Fatal(err)
+	}
+
+	byVersion := map[int64]events.Event{}
+	for _, event := range found {
+		byVersion[event.Version] = event
+	}
+
+	return byVersion
+}
+
+func TestRelayDeadLettersEventsThatKeepFailing(t *testing.T) {
+	ctx := relayTenant(t)
+	publisher := &recorder{err: errors.New("broker down")}
+	relay := events.NewRelayFor(publisher, "relay-test")
+
+	if err := events.Add(ctx,
+		events.Event{Type: events.UserCreated, UserId: 1, Version: 1},
+		events.Event{Type: events.UserUpdated, UserId: 1, Version: 2},
+	); err != nil {
+		t.Fatal(err)
+	}
+	pending := tenantEvents(t, ctx, "outbox")
+	first, second := pending[1].Id, pending[2].Id
+
+	for pass := 1; pass < 10; pass++ {
+		if err := relay.Relay(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pending = tenantEvents(t, ctx, "outbox")
+	if pending[1].Attempts != 9 || publisher.count(first) != 9 {
+		t.Fatalf("first event: %d attempts, %d publishes, want 9", pending[1].Attempts, publisher.count(first))
+	}
+	// The later event of the user waits behind the failing one.
+	if pending[2].Attempts != 0 || publisher.count(second) != 0 {
+		t.Fatalf("second event overtook the first: %d attempts, %d publishes", pending[2].Attempts, publisher.count(second))
+	}
+
+	if err := relay.Relay(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	dead := tenantEvents(t, ctx, "outbox.dead")
+	if len(dead) != 1 || dead[1].Id != first || dead[1].Attempts != 10 {
+		t.Fatalf("dead letters %+v, want the first event after 10 attempts", dead)
+	}
+	pending = tenantEvents(t, ctx, "outbox")
+	if _, ok := pending[1]; ok || len(pending) != 1 {
+		t.Fatalf("outbox %+v, want only the second event", pending)
+	}
+	// Once the first event is out of the way, the second one is tried.
+	if pending[2].Attempts != 1 || publisher.count(second) != 1 {
+		t.Errorf("second event: %d attempts, %d publishes, want 1", pending[2].Attempts, publisher.count(second))
+	}
+}
+
+func TestRelayLease(t *testing.T) {
+	ctx := relayTenant(t)
+	publisher := &recorder{}
+	first := events.NewRelayFor(publisher, "relay-first")
+	second := events.NewRelayFor(publisher, "relay-second")
+
+	lease := func(relay *events.Relay, want bool) {
+		t.Helper()
+
+		held, err := relay.Lease(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if held != want {
+			t.Fatalf("lease held %v, want %v", held, want)
+		}
+	}
+
+	lease(first, true)
+	for i := 0; i < 3; i++ {
+		lease(second, false)
+		lease(first, true)
+	}
+
+	if err := events.Add(ctx, events.Event{Type: events.UserCreated, UserId: 1, Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	event := tenantEvents(t, ctx, "outbox")[1]
+
+	if err := second.Relay(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if publisher.count(event.Id) != 0 {
+		t.Fatal("a relay without the lease published")
+	}
+
+	if err := first.Relay(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if publisher.count(event.Id) != 1 || len(tenantEvents(t, ctx, "outbox")) != 0 {
+		t.Fatalf("event published %d times", publisher.count(event.Id))
+	}
+
+	// A lease the first relay stopped renewing expires and can be taken over.
+	expired := bson.M{"$set": bson.M{"expiresAt": time.Now().UTC().Add(-time.Second)}}
+	if _, err := user.Database().Collection("outbox.lock").UpdateByID(ctx, "relay", expired); err != nil {
+		t.Fatal(err)
+	}
+	lease(second, true)
+	lease(first, false)
+}
@@ -0,0 +1,103 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"slices"
+)
+
+const (
+	codeBadValue                = 2
+	codeInvalidResumeToken      = 260
+	codeChangeStreamFatalError  = 280
+	codeChangeStreamHistoryLost = 286
+)
+
+var (
+	ErrInvalidResumeToken = errors.New("invalid resume token")
+	// ErrResumeTokenExpired means the events after the token are no longer available; the
+	// watcher has to reload the users and watch from now.
+	ErrResumeTokenExpired = errors.New("resume token is too old to resume from")
+	// ErrLagging ends a watch that fell too far behind; it can resume from its last token.
+	ErrLagging = errors.New("watcher fell too far behind")
+)
+
+// Filter selects the events of one tenant, optionally only those of some users. AllTenants
+// selects the events of every tenant instead, for internal consumers only.
+type Filter struct {
+	TenantId   string
+	AllTenants bool
+	UserIds    []int64
+}
+
+func (f Filter) matches(event Event) bool {
+	return (f.AllTenants || event.TenantId == f.TenantId) && (len(f.UserIds) == 0 || slices.Contains(f.UserIds, event.UserId))
+}
+
+// Source follows events as they are written. Watch calls fn with each event matching filter
+// and a token to resume after it, starting after resumeToken or from now when it is empty, and
+// returns when ctx is done or fn fails.
+type Source interface {
+	Watch(ctx context.Context, filter Filter, resumeToken string, fn func(event Event, token string) error) error
+}
+
+// ChangeStreamSource watches inserts into the outbox with a MongoDB change stream, so it sees
+// events of every replica and resumes from the oplog.
+type ChangeStreamSource struct{}
+
+func (ChangeStreamSource) Watch(ctx context.Context, filter Filter, resumeToken string, fn func(event Event, token string) error) error {
+	match := bson.M{"operationType": "insert"}
+	if !filter.AllTenants {
+		match["fullDocument.tenantId"] = filter.TenantId
+	}
+	if len(filter.UserIds) > 0 {
+		match["fullDocument.userId"] = bson.M{"$in": filter.UserIds}
+	}
+
+	opts := options.ChangeStream()
+	if resumeToken != "" {
+		opts.SetStartAfter(bson.M{"_data": resumeToken})
+	}
+
+	stream, err := outbox.Watch(ctx, mongo.Pipeline{{{Key: "$match", Value: match}}}, opts)
+	if err != nil {
+		return changeStreamError(err, resumeToken)
+	}
+	defer stream.Close(context.WithoutCancel(ctx))
+
+	for stream.Next(ctx) {
+		var change struct {
+			Token struct {
+				Data string `bson:"_data"`
+			} `bson:"_id"`
+			Event Event `bson:"fullDocument"`
+		}
+		if err := stream.Decode(&change); err != nil {
+			return err
+		}
+		if err := fn(change.Event, change.Token.Data); err != nil {
+			return err
+		}
+	}
+
+	return changeStreamError(stream.Err(), resumeToken)
+}
+
+func changeStreamError(err error, resumeToken string) error {
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		return err
+	}
+
+	switch {
+	case serverErr.HasErrorCode(codeChangeStreamHistoryLost), serverErr.HasErrorCode(codeChangeStreamFatalError):
+		return ErrResumeTokenExpired
+	case resumeToken != "" && (serverErr.HasErrorCode(codeInvalidResumeToken) || serverErr.HasErrorCode(codeBadValue)):
+		return ErrInvalidResumeToken
+	}
+
+	return err
+}
@@ -0,0 +1,71 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WebhookPublisher posts every event as JSON to one URL. With a secret, the X-Signature header
+// carries sha256=<hex HMAC-SHA256 of the body> so the receiver can check where it came from.
+type WebhookPublisher struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+func NewWebhookPublisher(url, secret string) *WebhookPublisher {
+	return &WebhookPublisher{url: url, secret: []byte(secret), client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (p *WebhookPublisher) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Event-Id", event.Id.Hex())
+	request.Header.Set("X-Event-Type", event.Type)
+	if len(p.secret) > 0 {
+		request.Header.Set("X-Signature", Sign(p.secret, body))
+	}
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", response.Status)
+	}
+
+	return nil
+}
+
+func (p *WebhookPublisher) Close() error {
+	p.client.CloseIdleConnections()
+
+	return nil
+}
+
+// Sign returns the X-Signature value for body.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
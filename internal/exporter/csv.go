@@ -0,0 +1,48 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"userService/internal/user"
+)
+
+// csvWriter writes the same columns the importer reads, with roles joined by semicolons.
+type csvWriter struct {
+	writer *csv.Writer
+	fields []string
+	record []string
+}
+
+func newCSVWriter(w io.Writer, fields []string) (*csvWriter, error) {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(fields); err != nil {
+		return nil, err
+	}
+
+	return &csvWriter{writer: writer, fields: fields, record: make([]string, len(fields))}, nil
+}
+
+func (c *csvWriter) write(data user.Data) error {
+	for i, field := range c.fields {
+		switch field {
+		case "userId":
+			c.record[i] = strconv.FormatInt(data.UserId, 10)
+		case "disabled":
+			c.record[i] = strconv.FormatBool(data.Disabled)
+		case "roles":
+			c.record[i] = strings.Join(data.Roles, ";")
+		default:
+			c.record[i], _ = value(data, field).(string)
+		}
+	}
+
+	return c.writer.Write(c.record)
+}
+
+func (c *csvWriter) close() error {
+	c.writer.Flush()
+
+	return c.writer.Error()
+}
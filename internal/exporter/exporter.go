@@ -0,0 +1,219 @@
+package exporter
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"io"
+	"regexp"
+	"strings"
+	"userService/internal/user"
+)
+
+const (
+	FormatCSV     = "csv"
+	FormatNDJSON  = "ndjson"
+	FormatParquet = "parquet"
+)
+
+var (
+	ErrUnknownFormat = errors.New("format must be csv, ndjson or parquet")
+	ErrInvalidField  = errors.New("invalid field selection")
+)
+
+// Fields lists what can be exported, in the order used when no fields are selected.
+var Fields = []string{"userId", "tenantId", "name", "email", "externalId", "disabled", "roles"}
+
+type Filter struct {
+	Disabled *bool
+	Role     string
+	// Email and Name match case-insensitive substrings.
+	Email string
+	Name  string
+}
+
+type Options struct {
+	Format string
+	// Fields selects and orders the exported fields; empty means all of them.
+	Fields []string
+	Filter Filter
+	Gzip   bool
+}
+
+type rowWriter interface {
+	write(data user.Data) error
+	close() error
+}
+
+// Export streams the users of the tenant in ctx to w as they are read from the database and
+// returns how many were written.
+func Export(ctx context.Context, w io.Writer, opts Options) (int, error) {
+	fields := opts.Fields
+	if len(fields) == 0 {
+		fields = Fields
+	}
+	if err := validateFields(fields); err != nil {
+		return 0, err
+	}
+
+	if opts.Format != FormatCSV && opts.Format != FormatNDJSON && opts.Format != FormatParquet {
+		return 0, ErrUnknownFormat
+	}
+
+	var gz *gzip.Writer
+	if opts.Gzip {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+
+	// The writer is opened with the first user, so a query that fails up front leaves w
+	// untouched and the caller can still report the error properly.
+	var rows rowWriter
+	open := func() error {
+		if rows != nil {
+			return nil
+		}
+
+		var err error
+		rows, err = newRowWriter(w, opts.Format, fields)
+		return err
+	}
+
+	exported := 0
+	err := user.StreamUsers(ctx, opts.Filter.query(), func(data user.Data) error {
+		if err := open(); err != nil {
+			return err
+		}
+		exported++
+		return rows.write(data)
+	})
+	if err != nil {
+		return exported, err
+	}
+
+	if err := open(); err != nil {
+		return exported, err
+	}
+	if err := rows.close(); err != nil {
+		return exported, err
+	}
+	if gz != nil {
+		return exported, gz.Close()
+	}
+
+	return exported, nil
+}
+
+func newRowWriter(w io.Writer, format string, fields []string) (rowWriter, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, fields)
+	case FormatParquet:
+		return newParquetWriter(w, fields)
+	}
+
+	return newNDJSONWriter(w, fields), nil
+}
+
+// ParseFields splits a comma separated field list, as taken by the HTTP endpoint and the CLI.
+func ParseFields(list string) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+
+	fields := strings.Split(list, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+
+	return fields, validateFields(fields)
+}
+
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	}
+
+	return "application/vnd.apache.parquet"
+}
+
+func validateFields(fields []string) error {
+	seen := map[string]bool{}
+	for _, field := range fields {
+		if !isField(field) {
+			return fmt.Errorf("%w: unknown field %q", ErrInvalidField, field)
+		}
+		if seen[field] {
+			return fmt.Errorf("%w: %q is selected twice", ErrInvalidField, field)
+		}
+		seen[field] = true
+	}
+
+	return nil
+}
+
+func isField(name string) bool {
+	for _, field := range Fields {
+		if field == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f Filter) query() bson.M {
+	query := bson.M{}
+	if f.Disabled != nil {
+		if *f.Disabled {
+			query["disabled"] = true
+		} else {
+			query["disabled"] = bson.M{"$ne": true}
+		}
+	}
+	if f.Role != "" {
+		query["roles"] = f.Role
+	}
+	if f.Email != "" {
+		query["email"] = contains(f.Email)
+	}
+	if f.Name != "" {
+		query["name"] = contains(f.Name)
+	}
+
+	return query
+}
+
+func contains(text string) bson.M {
+	return bson.M{"$regex": regexp.QuoteMeta(text), "$options": "i"}
+}
+
+// value returns the field of data as it is written by the NDJSON and Parquet writers.
+func value(data user.Data, field string) any {
+	switch field {
+	case "userId":
+		return data.UserId
+	case "tenantId":
+		return data.TenantId
+	case "name":
+		return data.Name
+	case "email":
+		return data.Email
+	case "externalId":
+		return data.ExternalId
+	case "disabled":
+		return data.Disabled
+	case "roles":
+		if data.Roles == nil {
+			return []string{}
+		}
+		return data.Roles
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package exporter
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"userService/internal/user"
+)
+
+type ndjsonWriter struct {
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+	fields   []string
+}
+
+func newNDJSONWriter(w io.Writer, fields []string) *ndjsonWriter {
+	buffered := bufio.NewWriter(w)
+
+	return &ndjsonWriter{buffered: buffered, encoder: json.NewEncoder(buffered), fields: fields}
+}
+
+func (n *ndjsonWriter) write(data user.Data) error {
+	return n.encoder.Encode(record(data, n.fields))
+}
+
+func (n *ndjsonWriter) close() error {
+	return n.buffered.Flush()
+}
+
+func record(data user.Data, fields []string) map[string]any {
+	result := make(map[string]any, len(fields))
+	for _, field := range fields {
+		result[field] = value(data, field)
+	}
+
+	return result
+}
@@ -0,0 +1,88 @@
+package exporter
+
+import (
+	"encoding/json"
+	"github.com/xitongsys/parquet-go/writer"
+	"io"
+	"userService/internal/user"
+)
+
+// rowGroupSize keeps the rows buffered before a flush small, since the writer holds a whole
+// row group in memory.
+const rowGroupSize = 8 << 20
+
+var parquetColumns = map[string]string{
+	"userId":     "type=INT64, repetitiontype=REQUIRED",
+	"tenantId":   "type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=REQUIRED",
+	"name":       "type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=REQUIRED",
+	"email":      "type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL",
+	"externalId": "type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL",
+	"disabled":   "type=BOOLEAN, repetitiontype=REQUIRED",
+	"roles":      "type=LIST, repetitiontype=REQUIRED",
+}
+
+type parquetWriter struct {
+	writer *writer.JSONWriter
+	fields []string
+}
+
+type parquetField struct {
+	Tag    string
+	Fields []parquetField `json:",omitempty"`
+}
+
+func newParquetWriter(w io.Writer, fields []string) (*parquetWriter, error) {
+	schema, err := parquetSchema(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	pw, err := writer.NewJSONWriterFromWriter(schema, w, 1)
+	if err != nil {
+		return nil, err
+	}
+	pw.RowGroupSize = rowGroupSize
+
+	return &parquetWriter{writer: pw, fields: fields}, nil
+}
+
+func (p *parquetWriter) write(data user.Data) error {
+	row := record(data, p.fields)
+	// Empty optional strings are written as nulls rather than empty values.
+	for _, field := range []string{"email", "externalId"} {
+		if text, ok := row[field].(string); ok && text == "" {
+			delete(row, field)
+		}
+	}
+
+	line, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	return p.writer.Write(string(line))
+}
+
+func (p *parquetWriter) close() error {
+	return p.writer.WriteStop()
+}
+
+func parquetSchema(fields []string) (string, error) {
+	root := parquetField{Tag: "name=user, repetitiontype=REQUIRED"}
+	for _, field := range fields {
+		column := parquetField{Tag: "name=" + field + ", inname=" + inName(field) + ", " + parquetColumns[field]}
+		if field == "roles" {
+			column.Fields = []parquetField{{Tag: "name=element, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=REQUIRED"}}
+		}
+		root.Fields = append(root.Fields, column)
+	}
+
+	schema, err := json.Marshal(root)
+
+	return string(schema), err
+}
+
+// inName is the name the writer uses to match JSON keys to columns.
+func inName(field string) string {
+	return string(field[0]-'a'+'A') + field[1:]
+}
@@ -0,0 +1,307 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"slices"
+	"strconv"
+	"time"
+	"userService/internal/tenant"
+	"userService/internal/user"
+)
+
+const (
+	MemberTypeUser  = "User"
+	MemberTypeGroup = "Group"
+)
+
+var (
+	ErrNotFound    = errors.New("group not found")
+	ErrCycle       = errors.New("group membership would create a cycle")
+	ErrInvalidType = errors.New("unknown member type")
+)
+
+type Member struct {
+	Type  string `json:"type" bson:"type"`
+	Value string `json:"value" bson:"value"`
+}
+
+type Group struct {
+	Id         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	OrgId      primitive.ObjectID `json:"orgId,omitempty" bson:"orgId,omitempty"`
+	TenantId   string             `json:"tenantId" bson:"tenantId"`
+	Name       string             `json:"name" bson:"name"`
+	ExternalId string             `json:"externalId,omitempty" bson:"externalId,omitempty"`
+	Members    []Member           `json:"members" bson:"members"`
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt  time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+func UserMember(userId int64) Member {
+	return Member{Type: MemberTypeUser, Value: strconv.FormatInt(userId, 10)}
+}
+
+func GroupMember(groupId primitive.ObjectID) Member {
+	return Member{Type: MemberTypeGroup, Value: groupId.Hex()}
+}
+
+func collection() *mongo.Collection {
+	return user.Database().Collection("group")
+}
+
+func CreateGroup(ctx context.Context, group Group) (Group, error) {
+	tenantId, ok := tenant.FromContext(ctx)
+	if !ok {
+		return Group{}, tenant.ErrMissingTenant
+	}
+
+	now := time.Now().UTC()
+	group.Id = primitive.NewObjectID()
+	group.TenantId = tenantId
+	group.CreatedAt = now
+	group.UpdatedAt = now
+	if group.Members == nil {
+		group.Members = []Member{}
+	}
+
+	if _, err := collection().InsertOne(ctx, group); err != nil {
+		return Group{}, err
+	}
+
+	return group, nil
+}
+
+func GetGroup(ctx context.Context, id string) (Group, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return Group{}, ErrNotFound
+	}
+
+	filter, err := tenant.Scope(ctx, bson.M{"_id": objectId})
+	if err != nil {
+		return Group{}, err
+	}
+
+	result := Group{}
+	err = collection().FindOne(ctx, filter).Decode(&result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Group{}, ErrNotFound
+	}
+	if err != nil {
+		return Group{}, err
+	}
+
+	groups := []Group{result}
+	if err := hideDeleted(ctx, groups); err != nil {
+		return Group{}, err
+	}
+
+	return groups[0], nil
+}
+
+func FindGroups(ctx context.Context, filter bson.M, skip, limit int64) ([]Group, int64, error) {
+	groups, total, err := findGroups(ctx, filter, skip, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return groups, total, hideDeleted(ctx, groups)
+}
+
+// CountGroups returns how many groups match filter without reading them.
+func CountGroups(ctx context.Context, filter bson.M) (int64, error) {
+	filter, err := tenant.Scope(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	return collection().CountDocuments(ctx, filter)
+}
+
+// findGroups is FindGroups including soft deleted users in the members.
+func findGroups(ctx context.Context, filter bson.M, skip, limit int64) ([]Group, int64, error) {
+	filter, err := tenant.Scope(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := collection().CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetSkip(skip)
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	result := []Group{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, 0, err
+	}
+
+	return result, total, nil
+}
+
+// ReplaceGroup replaces the name, external id and members of a group. Soft deleted users are
+// not shown as members, so their memberships are kept whatever group.Members holds.
+func ReplaceGroup(ctx context.Context, group Group) (Group, error) {
+	group.UpdatedAt = time.Now().UTC()
+	if group.Members == nil {
+		group.Members = []Member{}
+	}
+
+	filter, err := tenant.Scope(ctx, bson.M{"_id": group.Id})
+	if err != nil {
+		return Group{}, err
+	}
+
+	var stored Group
+	err = collection().FindOne(ctx, filter).Decode(&stored)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Group{}, ErrNotFound
+	}
+	if err != nil {
+		return Group{}, err
+	}
+	hidden, err := deletedMembers(ctx, stored.Members)
+	if err != nil {
+		return Group{}, err
+	}
+	for member := range hidden {
+		if !slices.Contains(group.Members, member) {
+			group.Members = append(group.Members, member)
+		}
+	}
+
+	update := bson.M{"$set": bson.M{
+		"name":       group.Name,
+		"externalId": group.ExternalId,
+		"members":    group.Members,
+		"updatedAt":  group.UpdatedAt,
+	}}
+
+	result, err := collection().UpdateOne(ctx, filter, update)
+	if err != nil {
+		return Group{}, err
+	}
+
+	if result.MatchedCount == 0 {
+		return Group{}, ErrNotFound
+	}
+
+	return GetGroup(ctx, group.Id.Hex())
+}
+
+// DeleteGroup deletes a group other than the members and admins groups of an organization.
+func DeleteGroup(ctx context.Context, id string) error {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	owned, err := tenant.Scope(ctx, bson.M{"$or": []bson.M{{"membersGroupId": objectId}, {"adminsGroupId": objectId}}})
+	if err != nil {
+		return err
+	}
+	if count, err := organizations().CountDocuments(ctx, owned); err != nil {
+		return err
+	} else if count > 0 {
+		return ErrOrganizationGroup
+	}
+
+	return deleteGroup(ctx, objectId)
+}
+
+func deleteGroup(ctx context.Context, objectId primitive.ObjectID) error {
+	filter, err := tenant.Scope(ctx, bson.M{"_id": objectId})
+	if err != nil {
+		return err
+	}
+
+	result, err := collection().DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return pullMember(ctx, GroupMember(objectId))
+}
+
+// RemoveUser drops a purged or erased user from every group it belonged to.
+func RemoveUser(ctx context.Context, userId int64) error {
+	return pullMember(ctx, UserMember(userId))
+}
+
+func pullMember(ctx context.Context, member Member) error {
+	filter, err := tenant.Scope(ctx, bson.M{"members": member})
+	if err != nil {
+		return err
+	}
+
+	_, err = collection().UpdateMany(ctx,
+		filter,
+		bson.M{"$pull": bson.M{"members": member}, "$set": bson.M{"updatedAt": time.Now().UTC()}},
+	)
+
+	return err
+}
+
+// hideDeleted leaves soft deleted users out of the members of groups. They keep their
+// memberships until they are purged, so that a restore brings them back.
+func hideDeleted(ctx context.Context, groups []Group) error {
+	var members []Member
+	for _, group := range groups {
+		members = append(members, group.Members...)
+	}
+	deleted, err := deletedMembers(ctx, members)
+	if err != nil || len(deleted) == 0 {
+		return err
+	}
+
+	for i := range groups {
+		groups[i].Members = slices.DeleteFunc(slices.Clone(groups[i].Members), func(member Member) bool {
+			return deleted[member]
+		})
+	}
+
+	return nil
+}
+
+// deletedMembers returns which of members are soft deleted users.
+func deletedMembers(ctx context.Context, members []Member) (map[Member]bool, error) {
+	var ids []int64
+	for _, member := range members {
+		if member.Type != MemberTypeUser {
+			continue
+		}
+		if id, err := strconv.ParseInt(member.Value, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	deletedIds, err := user.DeletedIds(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := map[Member]bool{}
+	for id := range deletedIds {
+		deleted[UserMember(id)] = true
+	}
+
+	return deleted, nil
+}
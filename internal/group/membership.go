@@ -0,0 +1,252 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"math"
+	"strconv"
+	"time"
+	"userService/internal/tenant"
+	"userService/internal/user"
+)
+
+func RenameGroup(ctx context.Context, id, name string) (Group, error) {
+	group, err := GetGroup(ctx, id)
+	if err != nil {
+		return Group{}, err
+	}
+
+	group.Name = name
+
+	return ReplaceGroup(ctx, group)
+}
+
+func AddMember(ctx context.Context, groupId string, member Member) (Group, error) {
+	group, err := GetGroup(ctx, groupId)
+	if err != nil {
+		return Group{}, err
+	}
+
+	switch member.Type {
+	case MemberTypeUser:
+		id, err := strconv.ParseInt(member.Value, 10, 64)
+		if err != nil {
+			return Group{}, mongo.ErrNoDocuments
+		}
+		if _, err := user.GetUser(ctx, id); err != nil {
+			return Group{}, err
+		}
+	case MemberTypeGroup:
+		child, err := GetGroup(ctx, member.Value)
+		if err != nil {
+			return Group{}, err
+		}
+
+		ancestors, err := ancestorIds(ctx, group.Id)
+		if err != nil {
+			return Group{}, err
+		}
+		if child.Id == group.Id || ancestors[child.Id] {
+			return Group{}, ErrCycle
+		}
+	default:
+		return Group{}, ErrInvalidType
+	}
+
+	filter, err := tenant.Scope(ctx, bson.M{"_id": group.Id})
+	if err != nil {
+		return Group{}, err
+	}
+
+	_, err = collection().UpdateOne(ctx,
+		filter,
+		bson.M{"$addToSet": bson.M{"members": member}, "$set": bson.M{"updatedAt": time.Now().UTC()}},
+	)
+	if err != nil {
+		return Group{}, err
+	}
+
+	return GetGroup(ctx, groupId)
+}
+
+func RemoveMember(ctx context.Context, groupId string, member Member) (Group, error) {
+	group, err := GetGroup(ctx, groupId)
+	if err != nil {
+		return Group{}, err
+	}
+
+	filter, err := tenant.Scope(ctx, bson.M{"_id": group.Id})
+	if err != nil {
+		return Group{}, err
+	}
+
+	_, err = collection().UpdateOne(ctx,
+		filter,
+		bson.M{"$pull": bson.M{"members": member}, "$set": bson.M{"updatedAt": time.Now().UTC()}},
+	)
+	if err != nil {
+		return Group{}, err
+	}
+
+	return GetGroup(ctx, groupId)
+}
+
+// ListMembers returns one page of the direct members of a group. Only that page is read from
+// the database, since large groups have many members. Soft deleted users keep their memberships
+// until they are purged, so that a restore brings them back, but are left out.
+func ListMembers(ctx context.Context, groupId string, skip, limit int64) ([]Member, int64, error) {
+	objectId, err := primitive.ObjectIDFromHex(groupId)
+	if err != nil {
+		return nil, 0, ErrNotFound
+	}
+	filter, err := tenant.Scope(ctx, bson.M{"_id": objectId})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	skip = max(skip, 0)
+	if limit <= 0 {
+		limit = math.MaxInt32
+	}
+	members := bson.M{"$ifNull": bson.A{"$members", bson.A{}}}
+	isUser := bson.M{"$eq": bson.A{"$$this.type", MemberTypeUser}}
+	userIds := bson.M{"$map": bson.M{
+		"input": bson.M{"$filter": bson.M{"input": members, "cond": isUser}},
+		"in":    bson.M{"$convert": bson.M{"input": "$$this.value", "to": "long", "onError": nil}},
+	}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$lookup", Value: bson.M{
+			"from": "user",
+			"let":  bson.M{"tenantId": "$tenantId", "userIds": userIds},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{
+					"deletedAt": bson.M{"$exists": true},
+					"$expr": bson.M{"$and": bson.A{
+						bson.M{"$eq": bson.A{"$tenantId", "$$tenantId"}},
+						bson.M{"$in": bson.A{"$userId", "$$userIds"}},
+					}},
+				}},
+				bson.M{"$project": bson.M{"_id": 0, "value": bson.M{"$toString": "$userId"}}},
+			},
+			"as": "deleted",
+		}}},
+		{{Key: "$set", Value: bson.M{"members": bson.M{"$filter": bson.M{
+			"input": members,
+			"cond":  bson.M{"$not": bson.A{bson.M{"$and": bson.A{isUser, bson.M{"$in": bson.A{"$$this.value", "$deleted.value"}}}}}},
+		}}}}},
+		{{Key: "$project", Value: bson.M{
+			"members": bson.M{"$slice": bson.A{"$members", skip, limit}},
+			"total":   bson.M{"$size": "$members"},
+		}}},
+	}
+
+	cursor, err := collection().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	if !cursor.Next(ctx) {
+		if err := cursor.Err(); err != nil {
+			return nil, 0, err
+		}
+		return nil, 0, ErrNotFound
+	}
+
+	var page struct {
+		Members []Member `bson:"members"`
+		Total   int64    `bson:"total"`
+	}
+	if err := cursor.Decode(&page); err != nil {
+		return nil, 0, err
+	}
+	if page.Members == nil {
+		page.Members = []Member{}
+	}
+
+	return page.Members, page.Total, nil
+}
+
+// UserGroups returns every group the user belongs to, directly or through nested groups. Soft
+// deleted users belong to none unless ctx comes from user.WithDeleted.
+func UserGroups(ctx context.Context, userId int64) ([]Group, error) {
+	_, err := user.GetUser(ctx, userId)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return []Group{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	direct, _, err := findGroups(ctx, bson.M{"members": UserMember(userId)}, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[primitive.ObjectID]bool{}
+	result := []Group{}
+	queue := direct
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		if seen[current.Id] {
+			continue
+		}
+		seen[current.Id] = true
+		result = append(result, current)
+
+		parents, _, err := findGroups(ctx, bson.M{"members": GroupMember(current.Id)}, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, parents...)
+	}
+
+	return result, nil
+}
+
+// IsMember reports whether the user belongs to the group, directly or through nested groups.
+func IsMember(ctx context.Context, userId int64, groupId string) (bool, error) {
+	groups, err := UserGroups(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+
+	for _, group := range groups {
+		if group.Id.Hex() == groupId {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func ancestorIds(ctx context.Context, id primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	ancestors := map[primitive.ObjectID]bool{}
+	queue := []primitive.ObjectID{id}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		parents, _, err := findGroups(ctx, bson.M{"members": GroupMember(current)}, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, parent := range parents {
+			if !ancestors[parent.Id] {
+				ancestors[parent.Id] = true
+				queue = append(queue, parent.Id)
+			}
+		}
+	}
+
+	return ancestors, nil
+}
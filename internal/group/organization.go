@@ -0,0 +1,199 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+	"userService/internal/tenant"
+	"userService/internal/user"
+)
+
+var (
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrOrganizationGroup    = errors.New("the members and admins groups are deleted with their organization")
+)
+
+// Organization owns groups. Every organization has a members group, which invited users join,
+// and an admins group, whose members manage the organization.
+type Organization struct {
+	Id             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TenantId       string             `json:"tenantId" bson:"tenantId"`
+	Name           string             `json:"name" bson:"name"`
+	MembersGroupId primitive.ObjectID `json:"membersGroupId" bson:"membersGroupId,omitempty"`
+	AdminsGroupId  primitive.ObjectID `json:"adminsGroupId" bson:"adminsGroupId,omitempty"`
+	CreatedAt      time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt      time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+func organizations() *mongo.Collection {
+	return user.Database().Collection("organization")
+}
+
+func CreateOrganization(ctx context.Context, name string) (Organization, error) {
+	tenantId, ok := tenant.FromContext(ctx)
+	if !ok {
+		return Organization{}, tenant.ErrMissingTenant
+	}
+
+	now := time.Now().UTC()
+	org := Organization{Id: primitive.NewObjectID(), TenantId: tenantId, Name: name, CreatedAt: now, UpdatedAt: now}
+
+	members, err := CreateGroup(ctx, Group{OrgId: org.Id, Name: "Members"})
+	if err != nil {
+		return Organization{}, err
+	}
+	admins, err := CreateGroup(ctx, Group{OrgId: org.Id, Name: "Admins"})
+	if err != nil {
+		return Organization{}, err
+	}
+	org.MembersGroupId, org.AdminsGroupId = members.Id, admins.Id
+
+	if _, err := organizations().InsertOne(ctx, org); err != nil {
+		return Organization{}, err
+	}
+
+	return org, nil
+}
+
+func getOrganization(ctx context.Context, id primitive.ObjectID) (Organization, error) {
+	filter, err := tenant.Scope(ctx, bson.M{"_id": id})
+	if err != nil {
+		return Organization{}, err
+	}
+
+	result := Organization{}
+	err = organizations().FindOne(ctx, filter).Decode(&result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Organization{}, ErrOrganizationNotFound
+	}
+
+	return result, err
+}
+
+// IsOrganizationAdmin reports whether the user belongs to the admins group of the organization.
+func IsOrganizationAdmin(ctx context.Context, orgId primitive.ObjectID, userId int64) (bool, error) {
+	org, err := getOrganization(ctx, orgId)
+	if err != nil {
+		return false, err
+	}
+
+	return IsMember(ctx, userId, org.AdminsGroupId.Hex())
+}
+
+// AddOrganizationMember adds the user to the members group of the organization. Unlike
+// AddMember it does not look the user up, so it can be called in the transaction that creates
+// the user.
+func AddOrganizationMember(ctx context.Context, orgId primitive.ObjectID, userId int64) error {
+	org, err := getOrganization(ctx, orgId)
+	if err != nil {
+		return err
+	}
+
+	filter, err := tenant.Scope(ctx, bson.M{"_id": org.MembersGroupId})
+	if err != nil {
+		return err
+	}
+
+	result, err := collection().UpdateOne(ctx,
+		filter,
+		bson.M{"$addToSet": bson.M{"members": UserMember(userId)}, "$set": bson.M{"updatedAt": time.Now().UTC()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func GetOrganization(ctx context.Context, id string) (Organization, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return Organization{}, ErrOrganizationNotFound
+	}
+
+	return getOrganization(ctx, objectId)
+}
+
+func ListOrganizations(ctx context.Context, skip, limit int64) ([]Organization, int64, error) {
+	filter, err := tenant.Scope(ctx, bson.M{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := organizations().CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetSkip(skip)
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := organizations().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	result := []Organization{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, 0, err
+	}
+
+	return result, total, nil
+}
+
+func RenameOrganization(ctx context.Context, id, name string) (Organization, error) {
+	org, err := GetOrganization(ctx, id)
+	if err != nil {
+		return Organization{}, err
+	}
+
+	org.Name = name
+	org.UpdatedAt = time.Now().UTC()
+
+	filter, err := tenant.Scope(ctx, bson.M{"_id": org.Id})
+	if err != nil {
+		return Organization{}, err
+	}
+
+	_, err = organizations().UpdateOne(ctx, filter, bson.M{"$set": bson.M{"name": org.Name, "updatedAt": org.UpdatedAt}})
+
+	return org, err
+}
+
+// DeleteOrganization removes the organization together with all of its groups.
+func DeleteOrganization(ctx context.Context, id string) error {
+	org, err := GetOrganization(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	groups, _, err := findGroups(ctx, bson.M{"orgId": org.Id}, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		if err := deleteGroup(ctx, group.Id); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+
+	filter, err := tenant.Scope(ctx, bson.M{"_id": org.Id})
+	if err != nil {
+		return err
+	}
+
+	_, err = organizations().DeleteOne(ctx, filter)
+
+	return err
+}
@@ -0,0 +1,174 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+	"userService/internal/tenant"
+	"userService/internal/user"
+)
+
+const MaxKeyLength = 255
+
+var (
+	ErrInvalidKey = errors.New("idempotency key must be 1 to 255 characters")
+	// ErrKeyReused means the key was already used for a request with another payload.
+	ErrKeyReused = errors.New("idempotency key was used with a different request")
+	// ErrInProgress means the first request with the key has not finished yet.
+	ErrInProgress = errors.New("a request with this idempotency key is in progress")
+)
+
+// TTL is how long a key and its response are kept; a key can be used again once it expired.
+var TTL = 24 * time.Hour
+
+// pendingTimeout lets a key be taken over when the request holding it never completed, for
+// instance because the process died.
+var pendingTimeout = time.Minute
+
+// Record is a key together with the response of the request that first used it.
+type Record struct {
+	TenantId    string `bson:"tenantId"`
+	Scope       string `bson:"scope"`
+	Key         string `bson:"key"`
+	RequestHash string `bson:"requestHash"`
+	Completed   bool   `bson:"completed"`
+	// UserId is the user the stored response describes, so that erasing it drops the response.
+	UserId      int64     `bson:"userId,omitempty"`
+	Status      int       `bson:"status,omitempty"`
+	ContentType string    `bson:"contentType,omitempty"`
+	Response    []byte    `bson:"response,omitempty"`
+	CreatedAt   time.Time `bson:"createdAt"`
+	ExpiresAt   time.Time `bson:"expiresAt"`
+}
+
+func collection() *mongo.Collection {
+	return user.Database().Collection("idempotency")
+}
+
+// Hash fingerprints a request payload, so a reused key can be told apart from a retry.
+func Hash(parts ...[]byte) string {
+	hash := sha256.New()
+	for _, part := range parts {
+		hash.Write(part)
+		hash.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func owner(ctx context.Context, scope, key string) (bson.M, error) {
+	if key == "" || len(key) > MaxKeyLength {
+		return nil, ErrInvalidKey
+	}
+
+	return tenant.Scope(ctx, bson.M{"scope": scope, "key": key})
+}
+
+// Begin claims key for a request with the given hash. It returns nil when the caller holds the
+// key and must run the request, then Complete or Release it. For a retry of a completed request
+// it returns the stored record to replay instead.
+func Begin(ctx context.Context, scope, key, hash string) (*Record, error) {
+	filter, err := owner(ctx, scope, key)
+	if err != nil {
+		return nil, err
+	}
+	tenantId, _ := tenant.FromContext(ctx)
+
+	for {
+		now := time.Now().UTC()
+		_, err := collection().InsertOne(ctx, Record{
+			TenantId:    tenantId,
+			Scope:       scope,
+			Key:         key,
+			RequestHash: hash,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(TTL),
+		})
+		if err == nil {
+			return nil, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+
+		var existing Record
+		err = collection().FindOne(ctx, filter).Decode(&existing)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// It expired or was released in the meantime.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if !existing.ExpiresAt.After(now) {
+			// The TTL monitor only runs once a minute, so expired keys can still be around.
+			expired := bson.M{"$and": []bson.M{filter, {"expiresAt": existing.ExpiresAt}}}
+			if _, err := collection().DeleteOne(ctx, expired); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		switch {
+		case existing.RequestHash != hash:
+			return nil, ErrKeyReused
+		case existing.Completed:
+			return &existing, nil
+		case now.Sub(existing.CreatedAt) < pendingTimeout:
+			return nil, ErrInProgress
+		}
+
+		stale := bson.M{"$and": []bson.M{filter, {"completed": false, "createdAt": existing.CreatedAt}}}
+		result, err := collection().UpdateOne(ctx, stale, bson.M{"$set": bson.M{"createdAt": now, "expiresAt": now.Add(TTL)}})
+		if err != nil {
+			return nil, err
+		}
+		if result.ModifiedCount == 1 {
+			return nil, nil
+		}
+	}
+}
+
+// Complete stores the response of the request that holds key, to be replayed for retries.
+// userId is the user the response describes, zero if none.
+func Complete(ctx context.Context, scope, key string, userId int64, status int, contentType string, response []byte) error {
+	filter, err := owner(ctx, scope, key)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$set": bson.M{"completed": true, "userId": userId, "status": status, "contentType": contentType, "response": response}}
+	_, err = collection().UpdateOne(ctx, filter, update)
+
+	return err
+}
+
+// Release gives up key after a failure that a retry might not hit, so the retry runs again.
+func Release(ctx context.Context, scope, key string) error {
+	filter, err := owner(ctx, scope, key)
+	if err != nil {
+		return err
+	}
+
+	_, err = collection().DeleteOne(ctx, bson.M{"$and": []bson.M{filter, {"completed": false}}})
+
+	return err
+}
+
+// EraseUser removes the stored responses about a user of the tenant in ctx, which hold its
+// personal data until they expire. Retries of those requests then run again.
+func EraseUser(ctx context.Context, userId int64) error {
+	filter, err := tenant.Scope(ctx, bson.M{"userId": userId})
+	if err != nil {
+		return err
+	}
+
+	_, err = collection().DeleteMany(ctx, filter)
+
+	return err
+}
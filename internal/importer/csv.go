@@ -0,0 +1,96 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"userService/internal/user"
+)
+
+type csvReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+var csvColumns = []string{"name", "email", "externalId", "roles", "disabled"}
+
+// newCSVReader expects a header row naming the columns; name is required, the others
+// (email, externalId, roles separated by semicolons, disabled) are optional.
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("csv input is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+
+		known := false
+		for _, column := range csvColumns {
+			if strings.EqualFold(name, column) {
+				columns[column] = i
+				known = true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown csv column %q", name)
+		}
+	}
+
+	if _, ok := columns["name"]; !ok {
+		return nil, errors.New("csv header must contain a name column")
+	}
+
+	return &csvReader{reader: reader, columns: columns}, nil
+}
+
+func (c *csvReader) next() (row, error) {
+	record, err := c.reader.Read()
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return row{line: parseErr.StartLine, err: parseErr.Err}, nil
+	}
+	if err != nil {
+		return row{}, err
+	}
+	line, _ := c.reader.FieldPos(0)
+
+	field := func(name string) string {
+		if i, ok := c.columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+
+		return ""
+	}
+
+	current := row{line: line, data: user.Data{
+		Name:       field("name"),
+		Email:      field("email"),
+		ExternalId: field("externalId"),
+	}}
+
+	if roles := field("roles"); roles != "" {
+		current.data.Roles = strings.Split(roles, ";")
+	}
+
+	if disabled := strings.TrimSpace(field("disabled")); disabled != "" {
+		current.data.Disabled, current.err = strconv.ParseBool(disabled)
+		if current.err != nil {
+			current.err = fmt.Errorf("invalid disabled value %q", disabled)
+		}
+	}
+
+	return current, nil
+}
@@ -0,0 +1,290 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"slices"
+	"strings"
+	"userService/internal/user"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+
+	StatusCreated = "created"
+	StatusSkipped = "skipped"
+	StatusFailed  = "failed"
+
+	DefaultBatchSize = 500
+)
+
+var (
+	ErrUnknownFormat = errors.New("format must be csv or ndjson")
+	// ErrInvalidInput wraps errors caused by the input as a whole rather than a single row.
+	ErrInvalidInput = errors.New("invalid import input")
+	ErrTooManyRows  = errors.New("too many rows")
+)
+
+type Options struct {
+	Format string
+	// DryRun validates every row and checks for existing users without writing anything.
+	DryRun    bool
+	BatchSize int
+	// MaxRows fails the import once exceeded; zero means unlimited. A limited input is read and
+	// counted in full before any user is created.
+	MaxRows int
+	// GrantableRoles, unless nil, are the only roles rows may give; rows with others fail.
+	GrantableRoles []string
+}
+
+type RowResult struct {
+	Line   int    `json:"line"`
+	Status string `json:"status"`
+	UserId int64  `json:"userId,omitempty"`
+	Email  string `json:"email,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Report struct {
+	DryRun  bool `json:"dryRun"`
+	Total   int  `json:"total"`
+	Created int  `json:"created"`
+	Skipped int  `json:"skipped"`
+	Failed  int  `json:"failed"`
+	// StoppedAtLine is the first line that was not imported when an error stopped the import;
+	// the rows before it are in Rows.
+	StoppedAtLine int         `json:"stoppedAtLine,omitempty"`
+	Rows          []RowResult `json:"rows"`
+}
+
+type row struct {
+	line int
+	data user.Data
+	err  error
+}
+
+func (r *Report) add(result RowResult) {
+	r.Total++
+	switch result.Status {
+	case StatusCreated:
+		r.Created++
+	case StatusSkipped:
+		r.Skipped++
+	case StatusFailed:
+		r.Failed++
+	}
+	r.Rows = append(r.Rows, result)
+}
+
+// Import reads users from r and creates them in the tenant of ctx in batches. Rows whose email
+// already exists, in the tenant or earlier in the input, are skipped; invalid rows fail without
+// affecting the others. When an error stops the import, the report of the rows written so far is
+// returned with it.
+func Import(ctx context.Context, r io.Reader, opts Options) (Report, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	var next func() (row, error)
+	switch opts.Format {
+	case FormatCSV:
+		reader, err := newCSVReader(r)
+		if err != nil {
+			return Report{}, fmt.Errorf("%w: %w", ErrInvalidInput, err)
+		}
+		next = reader.next
+	case FormatNDJSON:
+		next = newNDJSONReader(r).next
+	default:
+		return Report{}, ErrUnknownFormat
+	}
+
+	report := Report{DryRun: opts.DryRun, Rows: []RowResult{}}
+	if opts.MaxRows > 0 {
+		rows, err := readAll(next, opts.MaxRows)
+		if err != nil {
+			return report, err
+		}
+		next = replay(rows)
+	}
+
+	seen := map[string]bool{}
+	batch := make([]row, 0, opts.BatchSize)
+	nextLine := 1
+
+	for {
+		current, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			report.StoppedAtLine = nextLine
+			if len(batch) > 0 {
+				report.StoppedAtLine = batch[0].line
+			}
+			return report, fmt.Errorf("%w: %w", ErrInvalidInput, err)
+		}
+		nextLine = current.line + 1
+
+		batch = append(batch, current)
+		if len(batch) == opts.BatchSize {
+			if err := importBatch(ctx, batch, seen, opts, &report); err != nil {
+				report.StoppedAtLine = batch[0].line
+				return report, err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if err := importBatch(ctx, batch, seen, opts, &report); err != nil {
+		report.StoppedAtLine = batch[0].line
+		return report, err
+	}
+
+	return report, nil
+}
+
+// readAll reads every row up front, so that unreadable input and too many rows fail before
+// anything is written.
+func readAll(next func() (row, error), maxRows int) ([]row, error) {
+	var rows []row
+	for {
+		current, err := next()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidInput, err)
+		}
+
+		if len(rows) >= maxRows {
+			return nil, fmt.Errorf("%w: import is limited to %d rows", ErrTooManyRows, maxRows)
+		}
+		rows = append(rows, current)
+	}
+}
+
+func replay(rows []row) func() (row, error) {
+	return func() (row, error) {
+		if len(rows) == 0 {
+			return row{}, io.EOF
+		}
+		current := rows[0]
+		rows = rows[1:]
+
+		return current, nil
+	}
+}
+
+func importBatch(ctx context.Context, batch []row, seen map[string]bool, opts Options, report *Report) error {
+	var emails []string
+	for i := range batch {
+		if batch[i].err == nil {
+			batch[i].err = normalize(&batch[i].data)
+		}
+		if batch[i].err == nil && opts.GrantableRoles != nil {
+			batch[i].err = checkRoles(batch[i].data.Roles, opts.GrantableRoles)
+		}
+		if batch[i].err == nil && batch[i].data.Email != "" {
+			emails = append(emails, batch[i].data.Email)
+		}
+	}
+
+	existing, err := user.ExistingEmails(ctx, emails)
+	if err != nil {
+		return err
+	}
+
+	results := make([]RowResult, len(batch))
+	var pending []user.Data
+	var pendingRows []int
+
+	for i, current := range batch {
+		results[i] = RowResult{Line: current.line, Email: current.data.Email}
+		email := current.data.Email
+
+		switch {
+		case current.err != nil:
+			results[i].Status = StatusFailed
+			results[i].Error = current.err.Error()
+		case email != "" && existing[email]:
+			results[i].Status = StatusSkipped
+			results[i].Error = "a user with this email already exists"
+		case email != "" && seen[email]:
+			results[i].Status = StatusSkipped
+			results[i].Error = "duplicate email in input"
+		default:
+			results[i].Status = StatusCreated
+			pending = append(pending, current.data)
+			pendingRows = append(pendingRows, i)
+		}
+
+		if email != "" {
+			seen[email] = true
+		}
+	}
+
+	if !opts.DryRun {
+		failures, err := user.InsertUsers(ctx, pending)
+		if err != nil {
+			return err
+		}
+
+		for j, i := range pendingRows {
+			if failure, ok := failures[j]; ok {
+				results[i].Status = StatusFailed
+				results[i].Error = failure.Error()
+				continue
+			}
+			results[i].UserId = pending[j].UserId
+		}
+	}
+
+	for _, result := range results {
+		report.add(result)
+	}
+
+	return nil
+}
+
+func checkRoles(roles, grantable []string) error {
+	for _, role := range roles {
+		if !slices.Contains(grantable, role) {
+			return fmt.Errorf("role %q cannot be granted", role)
+		}
+	}
+
+	return nil
+}
+
+func normalize(data *user.Data) error {
+	data.UserId = 0
+	data.TenantId = ""
+	data.Name = strings.TrimSpace(data.Name)
+	data.ExternalId = strings.TrimSpace(data.ExternalId)
+
+	if data.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if email := strings.TrimSpace(data.Email); email != "" {
+		address, err := mail.ParseAddress(email)
+		if err != nil || address.Address != email {
+			return fmt.Errorf("invalid email %q", email)
+		}
+		data.Email = strings.ToLower(email)
+	}
+
+	for i, role := range data.Roles {
+		data.Roles[i] = strings.TrimSpace(role)
+		if data.Roles[i] == "" {
+			return errors.New("roles must not be empty")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,287 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"userService/internal/testdb"
+	"userService/internal/user"
+)
+
+// readRows reads every row of input in format, as Import does before validating them.
+func readRows(t *testing.T, format, input string) ([]row, error) {
+	t.Helper()
+
+	var next func() (row, error)
+	switch format {
+	case FormatCSV:
+		reader, err := newCSVReader(strings.NewReader(input))
+		if err != nil {
+			return nil, err
+		}
+		next = reader.next
+	case FormatNDJSON:
+		next = newNDJSONReader(strings.NewReader(input)).next
+	}
+
+	var rows []row
+	for {
+		current, err := next()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, err
+		}
+		rows = append(rows, current)
+	}
+}
+
+func TestReaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		input   string
+		want    []user.Data
+		lines   []int
+		rowErrs []bool
+		wantErr bool
+	}{
+		{
+			name:   "csv with every column",
+			format: FormatCSV,
+			input:  "name,email,externalId,roles,disabled\nAda,ada@example.com,ext-1,admin;member,true\n",
+			want:   []user.Data{{Name: "Ada", Email: "ada@example.com", ExternalId: "ext-1", Roles: []string{"admin", "member"}, Disabled: true}},
+			lines:  []int{2},
+		},
+		{
+			name:   "csv header with byte order mark, other case and order",
+			format: FormatCSV,
+			input:  "\ufeffEMAIL, Name\nbob@example.com,Bob\n",
+			want:   []user.Data{{Name: "Bob", Email: "bob@example.com"}},
+			lines:  []int{2},
+		},
+		{
+			name:   "csv short row leaves missing columns empty",
+			format: FormatCSV,
+			input:  "name,email\nCarol\n",
+			want:   []user.Data{{Name: "Carol"}},
+			lines:  []int{2},
+		},
+		{
+			name:    "csv invalid disabled fails the row",
+			format:  FormatCSV,
+			input:   "name,disabled\nDan,maybe\nEve,false\n",
+			want:    []user.Data{{Name: "Dan"}, {Name: "Eve"}},
+			lines:   []int{2, 3},
+			rowErrs: []bool{true, false},
+		},
+		{
+			name:    "csv parse error fails the row",
+			format:  FormatCSV,
+			input:   "name\n\"unterminated\n",
+			want:    []user.Data{{}},
+			lines:   []int{2},
+			rowErrs: []bool{true},
+		},
+		{
+			name:    "csv without name column",
+			format:  FormatCSV,
+			input:   "email\nada@example.com\n",
+			wantErr: true,
+		},
+		{
+			name:    "csv unknown column",
+			format:  FormatCSV,
+			input:   "name,password\nAda,secret\n",
+			wantErr: true,
+		},
+		{
+			name:    "csv empty input",
+			format:  FormatCSV,
+			input:   "",
+			wantErr: true,
+		},
+		{
+			name:   "ndjson skips blank lines but counts them",
+			format: FormatNDJSON,
+			input:  "{\"name\":\"Ada\",\"roles\":[\"member\"]}\n\n  \n{\"name\":\"Bob\",\"email\":\"bob@example.com\"}\n",
+			want:   []user.Data{{Name: "Ada", Roles: []string{"member"}}, {Name: "Bob", Email: "bob@example.com"}},
+			lines:  []int{1, 4},
+		},
+		{
+			name:    "ndjson invalid line fails the row",
+			format:  FormatNDJSON,
+			input:   "{\"name\":\"Ada\"}\nnot json\n",
+			want:    []user.Data{{Name: "Ada"}, {}},
+			lines:   []int{1, 2},
+			rowErrs: []bool{false, true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rows, err := readRows(t, test.format, test.input)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != len(test.want) {
+				t.Fatalf("got %d rows, want %d", len(rows), len(test.want))
+			}
+
+			for i, current := range rows {
+				if current.line != test.lines[i] {
+					t.Errorf("row %d: line %d, want %d", i, current.line, test.lines[i])
+				}
+				wantErr := test.rowErrs != nil && test.rowErrs[i]
+				if (current.err != nil) != wantErr {
+					t.Errorf("row %d: error %v, want error %v", i, current.err, wantErr)
+				}
+				if !wantErr && !reflect.DeepEqual(current.data, test.want[i]) {
+					t.Errorf("row %d: got %+v, want %+v", i, current.data, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    user.Data
+		want    user.Data
+		wantErr bool
+	}{
+		{
+			name: "trims and lowercases",
+			data: user.Data{UserId: 9, TenantId: "other", Name: " Ada ", Email: " Ada@Example.com ", ExternalId: " x ", Roles: []string{" member "}},
+			want: user.Data{Name: "Ada", Email: "ada@example.com", ExternalId: "x", Roles: []string{"member"}},
+		},
+		{name: "name is required", data: user.Data{Name: "  "}, wantErr: true},
+		{name: "invalid email", data: user.Data{Name: "Ada", Email: "not an email"}, wantErr: true},
+		{name: "email with display name", data: user.Data{Name: "Ada", Email: "Ada <ada@example.com>"}, wantErr: true},
+		{name: "empty role", data: user.Data{Name: "Ada", Roles: []string{"member", " "}}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := normalize(&test.data)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error %v, want error %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(test.data, test.want) {
+				t.Errorf("got %+v, want %+v", test.data, test.want)
+			}
+		})
+	}
+}
+
+// Rows without an email never reach the database, so a dry run of them needs none.
+func TestImportDryRun(t *testing.T) {
+	input := "name,roles,disabled\nAda,member,false\n,member,false\nBob,admin,false\nCarol,,nope\n"
+
+	report, err := Import(context.Background(), strings.NewReader(input), Options{
+		Format:         FormatCSV,
+		DryRun:         true,
+		BatchSize:      2,
+		GrantableRoles: []string{"member"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []RowResult{
+		{Line: 2, Status: StatusCreated},
+		{Line: 3, Status: StatusFailed, Error: "name is required"},
+		{Line: 4, Status: StatusFailed, Error: `role "admin" cannot be granted`},
+		{Line: 5, Status: StatusFailed, Error: `invalid disabled value "nope"`},
+	}
+	if !reflect.DeepEqual(report.Rows, want) {
+		t.Errorf("rows %+v, want %+v", report.Rows, want)
+	}
+	if !report.DryRun || report.Total != 4 || report.Created != 1 || report.Failed != 3 || report.Skipped != 0 {
+		t.Errorf("unexpected totals %+v", report)
+	}
+}
+
+func TestImportRejectsInputBeforeWriting(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		opts  Options
+		want  error
+	}{
+		{name: "unknown format", input: "name\nAda\n", opts: Options{Format: "xml"}, want: ErrUnknownFormat},
+		{name: "bad header", input: "nickname\nAda\n", opts: Options{Format: FormatCSV}, want: ErrInvalidInput},
+		{name: "too many rows", input: "name\nAda\nBob\nCarol\n", opts: Options{Format: FormatCSV, MaxRows: 2}, want: ErrTooManyRows},
+		{name: "line too long", input: "{\"name\":\"" + strings.Repeat("a", maxLineSize) + "\"}\n", opts: Options{Format: FormatNDJSON, MaxRows: 10}, want: ErrInvalidInput},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// No database is connected, so reaching a write would panic rather than pass.
+			report, err := Import(context.Background(), strings.NewReader(test.input), test.opts)
+			if !errors.Is(err, test.want) {
+				t.Fatalf("error %v, want %v", err, test.want)
+			}
+			if report.Total != 0 {
+				t.Errorf("%d rows were imported", report.Total)
+			}
+		})
+	}
+}
+
+func TestImport(t *testing.T) {
+	ctx := testdb.Tenant(t)
+
+	if _, err := user.InsertUser(ctx, user.Data{Name: "Existing", Email: "existing@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	input := strings.Join([]string{
+		`{"name":"Ada","email":"ada@example.com","roles":["member"]}`,
+		`{"name":"Again","email":"ADA@example.com"}`,
+		`{"name":"Existing","email":"existing@example.com"}`,
+		`{"email":"nameless@example.com"}`,
+	}, "\n")
+
+	dryRun, err := Import(ctx, strings.NewReader(input), Options{Format: FormatNDJSON, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := user.CountUsers(ctx, nil); err != nil || count != 1 {
+		t.Fatalf("dry run wrote users: %d, %v", count, err)
+	}
+
+	report, err := Import(ctx, strings.NewReader(input), Options{Format: FormatNDJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := []string{StatusCreated, StatusSkipped, StatusSkipped, StatusFailed}
+	for i, result := range report.Rows {
+		if result.Status != statuses[i] || dryRun.Rows[i].Status != statuses[i] {
+			t.Errorf("line %d: %s, dry run %s, want %s", result.Line, result.Status, dryRun.Rows[i].Status, statuses[i])
+		}
+	}
+
+	created, err := user.GetUser(ctx, report.Rows[0].UserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Name != "Ada" || created.Email != "ada@example.com" || !reflect.DeepEqual(created.Roles, []string{"member"}) {
+		t.Errorf("created %+v", created)
+	}
+	if count, err := user.CountUsers(ctx, nil); err != nil || count != 2 {
+		t.Errorf("%d users after import, %v", count, err)
+	}
+}
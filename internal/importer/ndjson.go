@@ -0,0 +1,44 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+const maxLineSize = 1024 * 1024
+
+type ndjsonReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONReader(r io.Reader) *ndjsonReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	return &ndjsonReader{scanner: scanner}
+}
+
+func (n *ndjsonReader) next() (row, error) {
+	for n.scanner.Scan() {
+		n.line++
+
+		text := bytes.TrimSpace(n.scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		current := row{line: n.line}
+		current.err = json.Unmarshal(text, &current.data)
+
+		return current, nil
+	}
+
+	if err := n.scanner.Err(); err != nil {
+		return row{}, err
+	}
+
+	return row{}, io.EOF
+}
@@ -0,0 +1,329 @@
+package invitation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+	"userService/internal/group"
+	"userService/internal/tenant"
+	"userService/internal/user"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusAccepted = "accepted"
+	StatusRevoked  = "revoked"
+)
+
+var (
+	ErrNotFound       = errors.New("invitation not found")
+	ErrAlreadyInvited = errors.New("a pending invitation for this email already exists")
+	ErrExpired        = errors.New("invitation has expired")
+	ErrNotPending     = errors.New("invitation is no longer pending")
+	ErrUserExists     = errors.New("a user with this email already exists")
+)
+
+var DefaultRoles = []string{"member"}
+
+type Invitation struct {
+	Id             primitive.ObjectID `json:"id" bson:"_id"`
+	TenantId       string             `json:"tenantId" bson:"tenantId"`
+	OrgId          primitive.ObjectID `json:"orgId" bson:"orgId"`
+	Email          string             `json:"email" bson:"email"`
+	Name           string             `json:"name,omitempty" bson:"name,omitempty"`
+	Roles          []string           `json:"roles" bson:"roles"`
+	Status         string             `json:"status" bson:"status"`
+	TokenHash      string             `json:"-" bson:"tokenHash"`
+	SendCount      int                `json:"sendCount" bson:"sendCount"`
+	ExpiresAt      time.Time          `json:"expiresAt" bson:"expiresAt"`
+	CreatedAt      time.Time          `json:"createdAt" bson:"createdAt"`
+	SentAt         time.Time          `json:"sentAt" bson:"sentAt"`
+	AcceptedAt     *time.Time         `json:"acceptedAt,omitempty" bson:"acceptedAt,omitempty"`
+	AcceptedUserId int64              `json:"acceptedUserId,omitempty" bson:"acceptedUserId,omitempty"`
+}
+
+func collection() *mongo.Collection {
+	return user.Database().Collection("invitation")
+}
+
+// Create stores a pending invitation and returns it with the plain accept token. Only a hash of
+// the token is persisted.
+func Create(ctx context.Context, invitation Invitation, ttl time.Duration) (Invitation, string, error) {
+	tenantId, ok := tenant.FromContext(ctx)
+	if !ok {
+		return Invitation{}, "", tenant.ErrMissingTenant
+	}
+
+	pending, err := tenant.Scope(ctx, bson.M{"orgId": invitation.OrgId, "email": invitation.Email, "status": StatusPending, "expiresAt": bson.M{"$gt": time.Now().UTC()}})
+	if err != nil {
+		return Invitation{}, "", err
+	}
+	if count, err := collection().CountDocuments(ctx, pending); err != nil {
+		return Invitation{}, "", err
+	} else if count > 0 {
+		return Invitation{}, "", ErrAlreadyInvited
+	}
+
+	token, hash := newToken()
+	now := time.Now().UTC()
+
+	invitation.Id = primitive.NewObjectID()
+	invitation.TenantId = tenantId
+	invitation.Status = StatusPending
+	invitation.TokenHash = hash
+	invitation.SendCount = 1
+	invitation.CreatedAt = now
+	invitation.SentAt = now
+	invitation.ExpiresAt = now.Add(ttl)
+	if len(invitation.Roles) == 0 {
+		invitation.Roles = DefaultRoles
+	}
+
+	if _, err := collection().InsertOne(ctx, invitation); err != nil {
+		return Invitation{}, "", err
+	}
+
+	return invitation, token, nil
+}
+
+func Get(ctx context.Context, id string) (Invitation, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return Invitation{}, ErrNotFound
+	}
+
+	filter, err := tenant.Scope(ctx, bson.M{"_id": objectId})
+	if err != nil {
+		return Invitation{}, err
+	}
+
+	result := Invitation{}
+	err = collection().FindOne(ctx, filter).Decode(&result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Invitation{}, ErrNotFound
+	}
+
+	return result, err
+}
+
+// Resend issues a fresh token for a pending invitation, invalidating the previous one and
+// restarting the expiry window.
+func Resend(ctx context.Context, id string, ttl time.Duration) (Invitation, string, error) {
+	existing, err := Get(ctx, id)
+	if err != nil {
+		return Invitation{}, "", err
+	}
+	if existing.Status != StatusPending {
+		return Invitation{}, "", ErrNotPending
+	}
+
+	filter, err := tenant.Scope(ctx, bson.M{"_id": existing.Id, "status": StatusPending})
+	if err != nil {
+		return Invitation{}, "", err
+	}
+
+	token, hash := newToken()
+	now := time.Now().UTC()
+	update := bson.M{
+		"$set": bson.M{"tokenHash": hash, "sentAt": now, "expiresAt": now.Add(ttl)},
+		"$inc": bson.M{"sendCount": 1},
+	}
+
+	result := Invitation{}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = collection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Invitation{}, "", ErrNotPending
+	}
+
+	return result, token, err
+}
+
+func Revoke(ctx context.Context, id string) error {
+	existing, err := Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	filter, err := tenant.Scope(ctx, bson.M{"_id": existing.Id, "status": StatusPending})
+	if err != nil {
+		return err
+	}
+
+	result, err := collection().UpdateOne(ctx, filter, bson.M{"$set": bson.M{"status": StatusRevoked}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNotPending
+	}
+
+	return nil
+}
+
+// ForUser returns the invitations sent to email or accepted by the user.
+func ForUser(ctx context.Context, userId int64, email string) ([]Invitation, error) {
+	filter, err := userFilter(ctx, userId, email)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := collection().Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	result := []Invitation{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// EraseUser revokes pending invitations for the user and removes the email and name from all of
+// them.
+func EraseUser(ctx context.Context, userId int64, email string) error {
+	filter, err := userFilter(ctx, userId, email)
+	if err != nil {
+		return err
+	}
+
+	pending := bson.M{"$and": []bson.M{filter, {"status": StatusPending}}}
+	if _, err := collection().UpdateMany(ctx, pending, bson.M{"$set": bson.M{"status": StatusRevoked}}); err != nil {
+		return err
+	}
+
+	_, err = collection().UpdateMany(ctx, filter, bson.M{"$set": bson.M{"email": ""}, "$unset": bson.M{"name": ""}})
+
+	return err
+}
+
+func userFilter(ctx context.Context, userId int64, email string) (bson.M, error) {
+	match := []bson.M{{"acceptedUserId": userId}}
+	if email != "" {
+		match = append(match, bson.M{"email": email})
+	}
+
+	return tenant.Scope(ctx, bson.M{"$or": match})
+}
+
+func ListPending(ctx context.Context, orgId primitive.ObjectID, skip, limit int64) ([]Invitation, int64, error) {
+	filter, err := tenant.Scope(ctx, bson.M{"orgId": orgId, "status": StatusPending, "expiresAt": bson.M{"$gt": time.Now().UTC()}})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := collection().CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetSkip(skip)
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	result := []Invitation{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, 0, err
+	}
+
+	return result, total, nil
+}
+
+// Accept redeems a token and creates the invited user in the invitation's tenant, as a member
+// of its organization. The token itself identifies the tenant, so the lookup is deliberately not
+// tenant scoped. The invitation is claimed first, and released again when the user cannot be
+// created.
+func Accept(ctx context.Context, token, name string) (user.Data, error) {
+	existing := Invitation{}
+	err := collection().FindOne(ctx, bson.M{"tokenHash": hashToken(token)}).Decode(&existing)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return user.Data{}, ErrNotFound
+	}
+	if err != nil {
+		return user.Data{}, err
+	}
+
+	if existing.Status != StatusPending {
+		return user.Data{}, ErrNotPending
+	}
+	if time.Now().After(existing.ExpiresAt) {
+		return user.Data{}, ErrExpired
+	}
+
+	ctx = tenant.WithTenant(ctx, existing.TenantId)
+
+	if _, err := user.GetUserByEmail(ctx, existing.Email); err == nil {
+		return user.Data{}, ErrUserExists
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return user.Data{}, err
+	}
+
+	claim := bson.M{"_id": existing.Id, "status": StatusPending, "tokenHash": existing.TokenHash}
+	result, err := collection().UpdateOne(ctx, claim, bson.M{"$set": bson.M{"status": StatusAccepted}})
+	if err != nil {
+		return user.Data{}, err
+	}
+	if result.MatchedCount == 0 {
+		return user.Data{}, ErrNotPending
+	}
+
+	if name == "" {
+		name = existing.Name
+	}
+	if name == "" {
+		name = existing.Email
+	}
+
+	data := user.Data{Name: name, Email: existing.Email, Roles: existing.Roles}
+	created, err := user.InsertUserWith(ctx, data, func(ctx context.Context, created user.Data) error {
+		if err := group.AddOrganizationMember(ctx, existing.OrgId, created.UserId); err != nil {
+			return err
+		}
+
+		accepted := bson.M{"acceptedAt": time.Now().UTC(), "acceptedUserId": created.UserId}
+		_, err := collection().UpdateOne(ctx, bson.M{"_id": existing.Id}, bson.M{"$set": accepted})
+		return err
+	})
+	if err != nil {
+		_, _ = collection().UpdateOne(context.WithoutCancel(ctx), bson.M{"_id": existing.Id}, bson.M{"$set": bson.M{"status": StatusPending}})
+		return user.Data{}, err
+	}
+
+	return created, nil
+}
+
+func newToken() (string, string) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	return token, hashToken(token)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
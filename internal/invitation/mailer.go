@@ -0,0 +1,83 @@
+package invitation
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"userService/internal/logging"
+)
+
+type Mailer interface {
+	SendInvitation(ctx context.Context, invitation Invitation, acceptURL string) error
+}
+
+// LogMailer only logs that an invitation was sent, for deployments without an SMTP relay. The
+// link is left out since it holds the accept token, and so is the address; Delivers reports
+// false for it so callers hand the link to the inviting admin instead.
+type LogMailer struct{}
+
+func (LogMailer) SendInvitation(ctx context.Context, invitation Invitation, _ string) error {
+	logging.FromContext(ctx).Info("invitation sent", slog.String("invitation", invitation.Id.Hex()))
+
+	return nil
+}
+
+// SMTPMailer mails the accept link through an SMTP relay. Username and Password are optional;
+// net/smtp only sends them over TLS or to localhost.
+type SMTPMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m SMTPMailer) SendInvitation(ctx context.Context, invitation Invitation, acceptURL string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	greeting := "Hello,"
+	if name := strings.Join(strings.Fields(invitation.Name), " "); name != "" {
+		greeting = "Hello " + name + ","
+	}
+	message := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: You have been invited\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n"+
+		"%s\r\n\r\nAccept your invitation before %s:\r\n%s\r\n",
+		m.From, invitation.Email, greeting, invitation.ExpiresAt.UTC().Format("2006-01-02 15:04 MST"), acceptURL)
+
+	if err := smtp.SendMail(m.Addr, auth, m.From, []string{invitation.Email}, []byte(message)); err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("invitation sent", slog.String("invitation", invitation.Id.Hex()))
+
+	return nil
+}
+
+// Delivers reports whether mailer gets the accept link to the invitee.
+func Delivers(mailer Mailer) bool {
+	_, logOnly := mailer.(LogMailer)
+
+	return !logOnly
+}
+
+func AcceptURL(base, token string) string {
+	parsed, err := url.Parse(base)
+	if err != nil {
+		return base + "?token=" + url.QueryEscape(token)
+	}
+
+	query := parsed.Query()
+	query.Set("token", token)
+	parsed.RawQuery = query.Encode()
+
+	return parsed.String()
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+func CommandMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			MongoDuration.WithLabelValues(e.CommandName).Observe(e.Duration.Seconds())
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			MongoDuration.WithLabelValues(e.CommandName).Observe(e.Duration.Seconds())
+			MongoErrors.WithLabelValues(e.CommandName).Inc()
+		},
+	}
+}
+
+// PoolMonitor tracks open and checked out connections from the driver's pool events, which is
+// the only way the driver exposes pool state.
+func PoolMonitor() *event.PoolMonitor {
+	open := MongoConnections.WithLabelValues("open")
+	inUse := MongoConnections.WithLabelValues("in_use")
+
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			switch e.Type {
+			case event.ConnectionCreated:
+				open.Inc()
+			case event.ConnectionClosed:
+				open.Dec()
+			case event.GetSucceeded:
+				inUse.Inc()
+			case event.ConnectionReturned:
+				inUse.Dec()
+			case event.GetFailed:
+				MongoCheckoutFailures.Inc()
+			}
+		},
+	}
+}
@@ -0,0 +1,446 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const (
+	codeNamespaceNotFound = 26
+	codeIndexNotFound     = 27
+	codeNamespaceExists   = 48
+)
+
+// migrations must stay sorted by version. Released versions are never edited; schema changes
+// get a new entry.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "assign the default tenant to users and identities created before tenants",
+		Up:          backfillTenant,
+		Down:        noop,
+	},
+	{
+		Version:     2,
+		Description: "unique user id and email per tenant",
+		Up: func(ctx context.Context, env Env) error {
+			return createIndexes(ctx, env.Database.Collection("user"), userIndexes)
+		},
+		Down: func(ctx context.Context, env Env) error {
+			return dropIndexes(ctx, env.Database.Collection("user"), userIndexes)
+		},
+	},
+	{
+		Version:     3,
+		Description: "indexes for identities, organizations, groups and invitations",
+		Up: func(ctx context.Context, env Env) error {
+			for name, indexes := range relatedIndexes {
+				if err := createIndexes(ctx, env.Database.Collection(name), indexes); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+		Down: func(ctx context.Context, env Env) error {
+			for name, indexes := range relatedIndexes {
+				if err := dropIndexes(ctx, env.Database.Collection(name), indexes); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	},
+	{
+		Version:     4,
+		Description: "json schema validator on users",
+		Up: func(ctx context.Context, env Env) error {
+			return setValidator(ctx, env.Database, "user", userSchema)
+		},
+		Down: func(ctx context.Context, env Env) error {
+			return setValidator(ctx, env.Database, "user", bson.M{})
+		},
+	},
+	{
+		Version:     5,
+		Description: "index soft deleted users for the purger",
+		Up: func(ctx context.Context, env Env) error {
+			return createIndexes(ctx, env.Database.Collection("user"), deletedIndexes)
+		},
+		Down: func(ctx context.Context, env Env) error {
+			return dropIndexes(ctx, env.Database.Collection("user"), deletedIndexes)
+		},
+	},
+	{
+		Version:     6,
+		Description: "audit log indexes",
+		Up: func(ctx context.Context, env Env) error {
+			return createIndexes(ctx, env.Database.Collection("audit"), auditIndexes)
+		},
+		Down: func(ctx context.Context, env Env) error {
+			return dropIndexes(ctx, env.Database.Collection("audit"), auditIndexes)
+		},
+	},
+	{
+		Version:     7,
+		Description: "blind indexes of encrypted user fields",
+		Up: func(ctx context.Context, env Env) error {
+			return createIndexes(ctx, env.Database.Collection("user"), blindIndexes)
+		},
+		Down: func(ctx context.Context, env Env) error {
+			return dropIndexes(ctx, env.Database.Collection("user"), blindIndexes)
+		},
+	},
+	{
+		Version:     8,
+		Description: "start existing users at version 1",
+		Up:          backfillVersion,
+		Down:        noop,
+	},
+	{
+		Version:     9,
+		Description: "idempotency keys expiring after their TTL",
+		Up: func(ctx context.Context, env Env) error {
+			return createIndexes(ctx, env.Database.Collection("idempotency"), idempotencyIndexes)
+		},
+		Down: func(ctx context.Context, env Env) error {
+			return dropIndexes(ctx, env.Database.Collection("idempotency"), idempotencyIndexes)
+		},
+	},
+	{
+		Version:     10,
+		Description: "indexes for webhook subscriptions and deliveries",
+		Up: func(ctx context.Context, env Env) error {
+			for name, indexes := range webhookIndexes {
+				if err := createIndexes(ctx, env.Database.Collection(name), indexes); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+		Down: func(ctx context.Context, env Env) error {
+			for name, indexes := range webhookIndexes {
+				if err := dropIndexes(ctx, env.Database.Collection(name), indexes); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	},
+	{
+		Version:     11,
+		Description: "remove user data from events waiting in the outbox",
+		Up: func(ctx context.Context, env Env) error {
+			_, err := env.Database.Collection("outbox").UpdateMany(ctx, bson.M{"data": bson.M{"$exists": true}}, bson.M{"$unset": bson.M{"data": ""}})
+			return err
+		},
+		Down: noop,
+	},
+	{
+		Version:     12,
+		Description: "members and admins groups for existing organizations",
+		Up:          backfillOrganizationGroups,
+		Down:        noop,
+	},
+	{
+		Version:     13,
+		Description: "find idempotent responses by user for erasure",
+		Up: func(ctx context.Context, env Env) error {
+			return createIndexes(ctx, env.Database.Collection("idempotency"), idempotencyUserIndexes)
+		},
+		Down: func(ctx context.Context, env Env) error {
+			return dropIndexes(ctx, env.Database.Collection("idempotency"), idempotencyUserIndexes)
+		},
+	},
+}
+
+var userIndexes = []mongo.IndexModel{
+	{
+		Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "userId", Value: 1}},
+		Options: options.Index().SetName("tenantId_userId").SetUnique(true),
+	},
+	{
+		Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "email", Value: 1}},
+		Options: options.Index().SetName("tenantId_email").SetUnique(true).
+			SetPartialFilterExpression(bson.M{"email": bson.M{"$gt": ""}}),
+	},
+	{
+		Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "externalId", Value: 1}},
+		Options: options.Index().SetName("tenantId_externalId").SetSparse(true),
+	},
+}
+
+var deletedIndexes = []mongo.IndexModel{
+	{
+		Keys: bson.D{{Key: "deletedAt", Value: 1}},
+		Options: options.Index().SetName("deletedAt").
+			SetPartialFilterExpression(bson.M{"deletedAt": bson.M{"$exists": true}}),
+	},
+}
+
+// blindIndexes take over from the email and external id indexes once those fields are
+// encrypted, since ciphertexts are never equal.
+var blindIndexes = []mongo.IndexModel{
+	{
+		Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "emailIndex", Value: 1}},
+		Options: options.Index().SetName("tenantId_emailIndex").SetUnique(true).
+			SetPartialFilterExpression(bson.M{"emailIndex": bson.M{"$gt": ""}}),
+	},
+	{
+		Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "externalIdIndex", Value: 1}},
+		Options: options.Index().SetName("tenantId_externalIdIndex").SetSparse(true),
+	},
+	{
+		Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "nameIndex", Value: 1}},
+		Options: options.Index().SetName("tenantId_nameIndex").SetSparse(true),
+	},
+}
+
+var auditIndexes = []mongo.IndexModel{
+	{
+		Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "timestamp", Value: -1}},
+		Options: options.Index().SetName("tenantId_timestamp"),
+	},
+	{
+		Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "actor", Value: 1}, {Key: "timestamp", Value: -1}},
+		Options: options.Index().SetName("tenantId_actor_timestamp"),
+	},
+	{
+		Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "userId", Value: 1}, {Key: "timestamp", Value: -1}},
+		Options: options.Index().SetName("tenantId_userId_timestamp"),
+	},
+	{
+		Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "seq", Value: 1}},
+		Options: options.Index().SetName("tenantId_seq").SetUnique(true).
+			SetPartialFilterExpression(bson.M{"seq": bson.M{"$gt": 0}}),
+	},
+}
+
+var idempotencyIndexes = []mongo.IndexModel{
+	{
+		Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "scope", Value: 1}, {Key: "key", Value: 1}},
+		Options: options.Index().SetName("tenantId_scope_key").SetUnique(true),
+	},
+	{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetName("expiresAt").SetExpireAfterSeconds(0),
+	},
+}
+
+var idempotencyUserIndexes = []mongo.IndexModel{
+	{
+		Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "userId", Value: 1}},
+		Options: options.Index().SetName("tenantId_userId").
+			SetPartialFilterExpression(bson.M{"userId": bson.M{"$gt": 0}}),
+	},
+}
+
+var webhookIndexes = map[string][]mongo.IndexModel{
+	"webhook": {
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "_id", Value: 1}},
+			Options: options.Index().SetName("tenantId_id"),
+		},
+	},
+	"webhook.deliveries": {
+		{
+			Keys:    bson.D{{Key: "subscriptionId", Value: 1}, {Key: "eventId", Value: 1}},
+			Options: options.Index().SetName("subscriptionId_eventId").SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "nextAttemptAt", Value: 1}},
+			Options: options.Index().SetName("nextAttemptAt_pending").
+				SetPartialFilterExpression(bson.M{"status": "pending"}),
+		},
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "subscriptionId", Value: 1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("tenantId_subscriptionId_id"),
+		},
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "userId", Value: 1}},
+			Options: options.Index().SetName("tenantId_userId"),
+		},
+	},
+}
+
+var relatedIndexes = map[string][]mongo.IndexModel{
+	"user.identities": {
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "issuer", Value: 1}, {Key: "subject", Value: 1}},
+			Options: options.Index().SetName("tenantId_issuer_subject").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "userId", Value: 1}},
+			Options: options.Index().SetName("tenantId_userId"),
+		},
+	},
+	"organization": {
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "name", Value: 1}},
+			Options: options.Index().SetName("tenantId_name"),
+		},
+	},
+	"group": {
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "orgId", Value: 1}},
+			Options: options.Index().SetName("tenantId_orgId"),
+		},
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "members.type", Value: 1}, {Key: "members.value", Value: 1}},
+			Options: options.Index().SetName("tenantId_members"),
+		},
+	},
+	"invitation": {
+		{
+			Keys:    bson.D{{Key: "tokenHash", Value: 1}},
+			Options: options.Index().SetName("tokenHash").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "tenantId", Value: 1}, {Key: "orgId", Value: 1}, {Key: "status", Value: 1}},
+			Options: options.Index().SetName("tenantId_orgId_status"),
+		},
+	},
+}
+
+var userSchema = bson.M{
+	"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": []string{"userId", "tenantId", "name"},
+		"properties": bson.M{
+			"userId":     bson.M{"bsonType": []string{"int", "long"}, "minimum": 1},
+			"tenantId":   bson.M{"bsonType": "string", "minLength": 1},
+			"name":       bson.M{"bsonType": "string"},
+			"email":      bson.M{"bsonType": "string"},
+			"externalId": bson.M{"bsonType": "string"},
+			"disabled":   bson.M{"bsonType": "bool"},
+			"roles":      bson.M{"bsonType": "array", "items": bson.M{"bsonType": "string"}},
+		},
+	},
+}
+
+func noop(context.Context, Env) error {
+	return nil
+}
+
+func backfillTenant(ctx context.Context, env Env) error {
+	missing := bson.M{"tenantId": bson.M{"$exists": false}}
+
+	for _, name := range []string{"user", "user.identities"} {
+		collection := env.Database.Collection(name)
+
+		if env.DefaultTenant == "" {
+			count, err := collection.CountDocuments(ctx, missing)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return errors.New(name + " has documents without a tenant and no default tenant is configured")
+			}
+			continue
+		}
+
+		if _, err := collection.UpdateMany(ctx, missing, bson.M{"$set": bson.M{"tenantId": env.DefaultTenant}}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func backfillVersion(ctx context.Context, env Env) error {
+	missing := bson.M{"version": bson.M{"$exists": false}}
+	_, err := env.Database.Collection("user").UpdateMany(ctx, missing, bson.M{"$set": bson.M{"version": int64(1)}})
+
+	return err
+}
+
+func backfillOrganizationGroups(ctx context.Context, env Env) error {
+	organizations := env.Database.Collection("organization")
+	cursor, err := organizations.Find(ctx, bson.M{"membersGroupId": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var org struct {
+			Id       primitive.ObjectID `bson:"_id"`
+			TenantId string             `bson:"tenantId"`
+		}
+		if err := cursor.Decode(&org); err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		set := bson.M{}
+		for field, name := range map[string]string{"membersGroupId": "Members", "adminsGroupId": "Admins"} {
+			id := primitive.NewObjectID()
+			group := bson.M{"_id": id, "orgId": org.Id, "tenantId": org.TenantId, "name": name, "members": bson.A{}, "createdAt": now, "updatedAt": now}
+			if _, err := env.Database.Collection("group").InsertOne(ctx, group); err != nil {
+				return err
+			}
+			set[field] = id
+		}
+
+		if _, err := organizations.UpdateOne(ctx, bson.M{"_id": org.Id}, bson.M{"$set": set}); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+func createIndexes(ctx context.Context, collection *mongo.Collection, indexes []mongo.IndexModel) error {
+	_, err := collection.Indexes().CreateMany(ctx, indexes)
+
+	return err
+}
+
+func dropIndexes(ctx context.Context, collection *mongo.Collection, indexes []mongo.IndexModel) error {
+	for _, index := range indexes {
+		_, err := collection.Indexes().DropOne(ctx, *index.Options.Name)
+		if err != nil && !hasCode(err, codeIndexNotFound, codeNamespaceNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setValidator installs the validator with moderate validation, so documents that predate it
+// can still be updated without first being fixed.
+func setValidator(ctx context.Context, database *mongo.Database, name string, validator bson.M) error {
+	err := database.CreateCollection(ctx, name, options.CreateCollection().SetValidator(validator).SetValidationLevel("moderate"))
+	if err == nil || !hasCode(err, codeNamespaceExists) {
+		return err
+	}
+
+	return database.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: name},
+		{Key: "validator", Value: validator},
+		{Key: "validationLevel", Value: "moderate"},
+	}).Err()
+}
+
+func hasCode(err error, codes ...int) bool {
+	var commandErr mongo.CommandError
+	if !errors.As(err, &commandErr) {
+		return false
+	}
+
+	for _, code := range codes {
+		if int(commandErr.Code) == code {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,224 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	lockId  = "migrations"
+	lockTTL = 10 * time.Minute
+)
+
+var (
+	ErrLocked         = errors.New("migrations are locked by another process")
+	ErrUnknownVersion = errors.New("unknown migration version")
+)
+
+// Env is what a migration step can work with.
+type Env struct {
+	Database *mongo.Database
+	// DefaultTenant is assigned to documents written before tenants existed.
+	DefaultTenant string
+}
+
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, env Env) error
+	Down        func(ctx context.Context, env Env) error
+}
+
+type State struct {
+	Version     int        `json:"version"`
+	Description string     `json:"description"`
+	AppliedAt   *time.Time `json:"appliedAt,omitempty"`
+}
+
+type record struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"appliedAt"`
+}
+
+type Runner struct {
+	env   Env
+	owner string
+}
+
+func NewRunner(env Env) *Runner {
+	host, _ := os.Hostname()
+
+	return &Runner{env: env, owner: host + ":" + strconv.Itoa(os.Getpid())}
+}
+
+func (r *Runner) applied() *mongo.Collection {
+	return r.env.Database.Collection("migrations")
+}
+
+func (r *Runner) locks() *mongo.Collection {
+	return r.env.Database.Collection("migrations.lock")
+}
+
+// Up applies pending migrations in order up to and including target, or all of them when
+// target is zero.
+func (r *Runner) Up(ctx context.Context, target int) ([]Migration, error) {
+	if target != 0 && find(target) == nil {
+		return nil, ErrUnknownVersion
+	}
+
+	var done []Migration
+	err := r.withLock(ctx, func() error {
+		applied, err := r.appliedVersions(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if target != 0 && m.Version > target {
+				break
+			}
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+
+			slog.Info("applying migration", slog.Int("version", m.Version), slog.String("description", m.Description))
+			if err := m.Up(ctx, r.env); err != nil {
+				return fmt.Errorf("migration %d: %w", m.Version, err)
+			}
+
+			_, err := r.applied().InsertOne(ctx, record{Version: m.Version, Description: m.Description, AppliedAt: time.Now().UTC()})
+			if err != nil {
+				return err
+			}
+			done = append(done, m)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Down reverts the most recently applied migrations, newest first.
+func (r *Runner) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := r.withLock(ctx, func() error {
+		applied, err := r.appliedVersions(ctx)
+		if err != nil {
+			return err
+		}
+
+		versions := make([]int, 0, len(applied))
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+		for _, version := range versions {
+			if len(done) == steps {
+				break
+			}
+
+			m := find(version)
+			if m == nil {
+				return fmt.Errorf("migration %d: %w", version, ErrUnknownVersion)
+			}
+
+			slog.Info("reverting migration", slog.Int("version", m.Version), slog.String("description", m.Description))
+			if err := m.Down(ctx, r.env); err != nil {
+				return fmt.Errorf("migration %d: %w", m.Version, err)
+			}
+
+			if _, err := r.applied().DeleteOne(ctx, bson.M{"_id": m.Version}); err != nil {
+				return err
+			}
+			done = append(done, *m)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+func (r *Runner) Status(ctx context.Context) ([]State, error) {
+	applied, err := r.appliedVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]State, 0, len(migrations))
+	for _, m := range migrations {
+		state := State{Version: m.Version, Description: m.Description}
+		if rec, ok := applied[m.Version]; ok {
+			state.AppliedAt = &rec.AppliedAt
+		}
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+func (r *Runner) appliedVersions(ctx context.Context) (map[int]record, error) {
+	cursor, err := r.applied().Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var records []record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	result := make(map[int]record, len(records))
+	for _, rec := range records {
+		result[rec.Version] = rec
+	}
+
+	return result, nil
+}
+
+// withLock runs fn while holding a lease in the lock collection. A lease left behind by a
+// crashed process expires after lockTTL and can then be taken over.
+func (r *Runner) withLock(ctx context.Context, fn func() error) error {
+	now := time.Now().UTC()
+	filter := bson.M{"_id": lockId, "expiresAt": bson.M{"$lt": now}}
+	update := bson.M{"$set": bson.M{"owner": r.owner, "lockedAt": now, "expiresAt": now.Add(lockTTL)}}
+
+	_, err := r.locks().UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrLocked
+	}
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if _, err := r.locks().DeleteOne(context.Background(), bson.M{"_id": lockId, "owner": r.owner}); err != nil {
+			slog.Error("release migration lock failed", slog.Any("error", err))
+		}
+	}()
+
+	return fn()
+}
+
+func find(version int) *Migration {
+	for i := range migrations {
+		if migrations[i].Version == version {
+			return &migrations[i]
+		}
+	}
+
+	return nil
+}
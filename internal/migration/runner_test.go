@@ -0,0 +1,152 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"userService/internal/testdb"
+	"userService/internal/user"
+)
+
+// database returns an empty database of the test's own, so the runner sees no earlier migrations.
+func database(t *testing.T) *mongo.Database {
+	t.Helper()
+
+	testdb.Tenant(t)
+	database := user.Database().Client().Database("migration-test-" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() {
+		if err := database.Drop(context.Background()); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return database
+}
+
+func TestMigrationsAreSorted(t *testing.T) {
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version <= migrations[i-1].Version {
+			t.Errorf("migration %d follows %d", migrations[i].Version, migrations[i-1].Version)
+		}
+	}
+	for _, m := range migrations {
+		if m.Up == nil || m.Down == nil || m.Description == "" {
+			t.Errorf("migration %d is incomplete", m.Version)
+		}
+	}
+}
+
+func TestUpUnknownVersion(t *testing.T) {
+	if _, err := NewRunner(Env{}).Up(context.Background(), migrations[len(migrations)-1].Version+1); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("error %v, want %v", err, ErrUnknownVersion)
+	}
+}
+
+func TestUpIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	runner := NewRunner(Env{Database: database(t), DefaultTenant: "default"})
+
+	done, err := runner.Up(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(migrations) {
+		t.Fatalf("applied %d migrations, want %d", len(done), len(migrations))
+	}
+
+	again, err := runner.Up(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 0 {
+		t.Errorf("second run applied %d migrations", len(again))
+	}
+
+	states, err := runner.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range states {
+		if state.AppliedAt == nil {
+			t.Errorf("migration %d is not applied", state.Version)
+		}
+	}
+}
+
+func TestConcurrentRunnersApplyOnce(t *testing.T) {
+	ctx := context.Background()
+	db := database(t)
+
+	// Counting migrations that take a while keep the lock held long enough for the runners to
+	// collide.
+	counts := make([]atomic.Int32, 5)
+	original := migrations
+	migrations = nil
+	for i := range counts {
+		count := &counts[i]
+		migrations = append(migrations, Migration{
+			Version:     i + 1,
+			Description: "count " + strconv.Itoa(i+1),
+			Up: func(context.Context, Env) error {
+				count.Add(1)
+				time.Sleep(20 * time.Millisecond)
+				return nil
+			},
+			Down: noop,
+		})
+	}
+	t.Cleanup(func() { migrations = original })
+
+	var wg sync.WaitGroup
+	var locked atomic.Int32
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		runner := &Runner{env: Env{Database: db}, owner: "runner-" + strconv.Itoa(i)}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Callers retry on ErrLocked, as a replica starting during a deploy would.
+			for {
+				_, err := runner.Up(ctx, 0)
+				if !errors.Is(err, ErrLocked) {
+					errs <- err
+					return
+				}
+				locked.Add(1)
+				time.Sleep(10 * time.Millisecond)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range counts {
+		if count := counts[i].Load(); count != 1 {
+			t.Errorf("migration %d applied %d times", i+1, count)
+		}
+	}
+	if locked.Load() == 0 {
+		t.Log("the runners never collided")
+	}
+
+	applied, err := db.Collection("migrations").CountDocuments(ctx, bson.M{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != int64(len(counts)) {
+		t.Errorf("%d migrations recorded, want %d", applied, len(counts))
+	}
+}
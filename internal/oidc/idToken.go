@@ -0,0 +1,204 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+type IDToken struct {
+	Issuer        string `json:"iss"`
+	Subject       string `json:"sub"`
+	Audience      any    `json:"aud"`
+	ExpiresAt     int64  `json:"exp"`
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+const keysRefreshInterval = time.Minute
+
+func (p *Provider) Verify(ctx context.Context, raw, nonce string) (IDToken, error) {
+	var token IDToken
+
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return token, ErrInvalidIDToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return token, ErrInvalidIDToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return token, ErrInvalidIDToken
+	}
+
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return token, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !verifySignature(header.Alg, key, digest[:], signature) {
+		return token, ErrInvalidIDToken
+	}
+
+	if err := decodeSegment(parts[1], &token); err != nil {
+		return token, ErrInvalidIDToken
+	}
+
+	switch {
+	case strings.TrimSuffix(token.Issuer, "/") != p.config.Issuer:
+		return token, fmt.Errorf("%w: unexpected issuer", ErrInvalidIDToken)
+	case !token.hasAudience(p.config.ClientID):
+		return token, fmt.Errorf("%w: unexpected audience", ErrInvalidIDToken)
+	case time.Now().Unix() >= token.ExpiresAt:
+		return token, fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	case token.Nonce != nonce:
+		return token, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	case token.Subject == "":
+		return token, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+
+	return token, nil
+}
+
+func (t IDToken) hasAudience(clientID string) bool {
+	switch audience := t.Audience.(type) {
+	case string:
+		return audience == clientID
+	case []any:
+		for _, item := range audience {
+			if item == clientID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func verifySignature(alg string, key any, digest, signature []byte) bool {
+	switch alg {
+	case "RS256":
+		publicKey, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest, signature) == nil
+	case "ES256":
+		publicKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(publicKey, digest, r, s)
+	}
+
+	return false
+}
+
+// key returns the signing key with the given id, refetching the JWKS when the provider has rotated keys.
+func (p *Provider) key(ctx context.Context, kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	if time.Since(p.keysLoaded) < keysRefreshInterval && p.keys != nil {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidIDToken, kid)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.endpoints.JwksURI, &set); err != nil {
+		return nil, fmt.Errorf("oidc jwks: %w", err)
+	}
+
+	p.keys = make(map[string]any, len(set.Keys))
+	p.keysLoaded = time.Now()
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			p.keys[jwk.Kid] = key
+		}
+	}
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidIDToken, kid)
+}
+
+func (k jsonWebKey) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeSegment(segment string, target any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, target)
+}
@@ -0,0 +1,143 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"userService/internal/config"
+)
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+type Provider struct {
+	config     config.OIDC
+	client     *http.Client
+	endpoints  discovery
+	mu         sync.Mutex
+	keys       map[string]any
+	keysLoaded time.Time
+}
+
+func NewProvider(ctx context.Context, cfg config.OIDC, client *http.Client) (*Provider, error) {
+	if !cfg.Enabled() {
+		return nil, errors.New("oidc provider is not configured")
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	p := &Provider{config: cfg, client: client}
+	if err := p.getJSON(ctx, cfg.Issuer+"/.well-known/openid-configuration", &p.endpoints); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+
+	if strings.TrimSuffix(p.endpoints.Issuer, "/") != cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer mismatch %q", p.endpoints.Issuer)
+	}
+
+	return p, nil
+}
+
+func (p *Provider) Issuer() string {
+	return p.config.Issuer
+}
+
+func (p *Provider) AuthCodeURL(state, nonce string) string {
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {p.config.ClientID},
+		"redirect_uri":  {p.config.RedirectURL},
+		"scope":         {strings.Join(p.config.Scopes, " ")},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+
+	separator := "?"
+	if strings.Contains(p.endpoints.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return p.endpoints.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// Exchange trades an authorization code for tokens and returns the verified ID token claims.
+func (p *Provider) Exchange(ctx context.Context, code, nonce string) (IDToken, error) {
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {p.config.RedirectURL},
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoints.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return IDToken{}, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	request.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return IDToken{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return IDToken{}, fmt.Errorf("oidc token endpoint returned %s", response.Status)
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&tokens); err != nil {
+		return IDToken{}, err
+	}
+
+	if tokens.IDToken == "" {
+		return IDToken{}, errors.New("oidc token response has no id_token")
+	}
+
+	return p.Verify(ctx, tokens.IDToken, nonce)
+}
+
+func (p *Provider) getJSON(ctx context.Context, endpoint string, target any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", endpoint, response.Status)
+	}
+
+	return json.NewDecoder(response.Body).Decode(target)
+}
+
+func RandomString() string {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
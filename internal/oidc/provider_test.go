@@ -0,0 +1,268 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"userService/internal/config"
+)
+
+// testIssuer stands in for an OpenID provider with discovery, a JWKS and a token endpoint that
+// returns idToken for the code "valid-code".
+type testIssuer struct {
+	server *httptest.Server
+	key    *ecdsa.PrivateKey
+	// kid is the key id tokens are signed with; the JWKS publishes the key as key-1.
+	kid string
+	// issuer is what discovery reports, the server url unless a test changes it.
+	issuer       string
+	idToken      string
+	jwksRequests atomic.Int32
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &testIssuer{key: key, kid: "key-1"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, request *http.Request) {
+		_ = json.NewEncoder(w).Encode(discovery{
+			Issuer:                issuer.issuer,
+			AuthorizationEndpoint: issuer.server.URL + "/authorize",
+			TokenEndpoint:         issuer.server.URL + "/token",
+			JwksURI:               issuer.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, request *http.Request) {
+		issuer.jwksRequests.Add(1)
+		x, y := make([]byte, 32), make([]byte, 32)
+		issuer.key.X.FillBytes(x)
+		issuer.key.Y.FillBytes(y)
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []jsonWebKey{{
+			Kty: "EC", Kid: "key-1", Use: "sig", Crv: "P-256",
+			X: base64.RawURLEncoding.EncodeToString(x), Y: base64.RawURLEncoding.EncodeToString(y),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, request *http.Request) {
+		clientId, secret, _ := request.BasicAuth()
+		if err := request.ParseForm(); err != nil || request.Form.Get("code") != "valid-code" || clientId != "client" || secret != "secret" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": issuer.idToken})
+	})
+
+	issuer.server = httptest.NewServer(mux)
+	issuer.issuer = issuer.server.URL
+	t.Cleanup(issuer.server.Close)
+
+	return issuer
+}
+
+func (i *testIssuer) config() config.OIDC {
+	return config.OIDC{
+		Issuer:       i.server.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "https://app.example.com/auth/oidc/callback",
+		Scopes:       []string{"openid", "email"},
+	}
+}
+
+func (i *testIssuer) provider(t *testing.T) *Provider {
+	t.Helper()
+
+	p, err := NewProvider(context.Background(), i.config(), i.server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func (i *testIssuer) claims(nonce string) map[string]any {
+	return map[string]any{
+		"iss":            i.server.URL,
+		"sub":            "subject-1",
+		"aud":            "client",
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"nonce":          nonce,
+		"email":          "Ada@Example.com",
+		"email_verified": true,
+		"name":           "Ada",
+	}
+}
+
+func (i *testIssuer) sign(t *testing.T, claims map[string]any) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": i.kid})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, i.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestNewProviderDiscovery(t *testing.T) {
+	issuer := newTestIssuer(t)
+	p := issuer.provider(t)
+
+	if p.Issuer() != issuer.server.URL {
+		t.Errorf("Issuer() = %q, want %q", p.Issuer(), issuer.server.URL)
+	}
+
+	authURL, err := url.Parse(p.AuthCodeURL("the-state", "the-nonce"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := authURL.Scheme + "://" + authURL.Host + authURL.Path; got != issuer.server.URL+"/authorize" {
+		t.Errorf("authorization endpoint = %q", got)
+	}
+	query := authURL.Query()
+	for name, want := range map[string]string{"client_id": "client", "state": "the-state", "nonce": "the-nonce", "scope": "openid email", "response_type": "code"} {
+		if query.Get(name) != want {
+			t.Errorf("%s = %q, want %q", name, query.Get(name), want)
+		}
+	}
+}
+
+func TestNewProviderRejectsIssuerMismatch(t *testing.T) {
+	issuer := newTestIssuer(t)
+	issuer.issuer = "https://other.example.com"
+
+	if _, err := NewProvider(context.Background(), issuer.config(), issuer.server.Client()); err == nil {
+		t.Fatal("NewProvider accepted a discovery document for another issuer")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	issuer := newTestIssuer(t)
+	p := issuer.provider(t)
+
+	tests := []struct {
+		name   string
+		change func(claims map[string]any)
+		nonce  string
+		valid  bool
+	}{
+		{name: "valid", nonce: "nonce-1", valid: true},
+		{name: "nonce mismatch", nonce: "another-nonce"},
+		{name: "expired", nonce: "nonce-1", change: func(claims map[string]any) { claims["exp"] = time.Now().Add(-time.Second).Unix() }},
+		{name: "other audience", nonce: "nonce-1", change: func(claims map[string]any) { claims["aud"] = "other-client" }},
+		{name: "audience list", nonce: "nonce-1", valid: true, change: func(claims map[string]any) { claims["aud"] = []string{"other-client", "client"} }},
+		{name: "other issuer", nonce: "nonce-1", change: func(claims map[string]any) { claims["iss"] = "https://other.example.com" }},
+		{name: "missing subject", nonce: "nonce-1", change: func(claims map[string]any) { delete(claims, "sub") }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := issuer.claims("nonce-1")
+			if test.change != nil {
+				test.change(claims)
+			}
+
+			token, err := p.Verify(context.Background(), issuer.sign(t, claims), test.nonce)
+			if test.valid {
+				if err != nil {
+					t.Fatalf("Verify() error = %v", err)
+				}
+				if token.Subject != "subject-1" || token.Email != "Ada@Example.com" || !token.EmailVerified {
+					t.Errorf("Verify() = %+v", token)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("Verify() error = %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsForgedSignature(t *testing.T) {
+	issuer := newTestIssuer(t)
+	p := issuer.provider(t)
+
+	token := issuer.sign(t, issuer.claims("nonce-1"))
+	parts := strings.Split(token, ".")
+	forged, _ := json.Marshal(map[string]any{"iss": issuer.server.URL, "sub": "admin", "aud": "client", "exp": time.Now().Add(time.Minute).Unix(), "nonce": "nonce-1"})
+	parts[1] = base64.RawURLEncoding.EncodeToString(forged)
+
+	if _, err := p.Verify(context.Background(), strings.Join(parts, "."), "nonce-1"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("Verify() error = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestVerifyCachesKeys(t *testing.T) {
+	issuer := newTestIssuer(t)
+	p := issuer.provider(t)
+
+	for range 3 {
+		if _, err := p.Verify(context.Background(), issuer.sign(t, issuer.claims("nonce-1")), "nonce-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := issuer.jwksRequests.Load(); got != 1 {
+		t.Errorf("JWKS fetched %d times, want once", got)
+	}
+
+	// A token signed with a key the provider does not publish is refused without refetching
+	// the keys on every attempt.
+	issuer.kid = "key-2"
+	for range 2 {
+		if _, err := p.Verify(context.Background(), issuer.sign(t, issuer.claims("nonce-1")), "nonce-1"); !errors.Is(err, ErrInvalidIDToken) {
+			t.Fatalf("Verify() error = %v, want ErrInvalidIDToken", err)
+		}
+	}
+	if got := issuer.jwksRequests.Load(); got != 1 {
+		t.Errorf("JWKS fetched %d times within the refresh interval", got)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	issuer := newTestIssuer(t)
+	p := issuer.provider(t)
+	issuer.idToken = issuer.sign(t, issuer.claims("nonce-1"))
+
+	token, err := p.Exchange(context.Background(), "valid-code", "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	if token.Subject != "subject-1" || token.Name != "Ada" {
+		t.Errorf("Exchange() = %+v", token)
+	}
+
+	if _, err := p.Exchange(context.Background(), "valid-code", "other-nonce"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Exchange() with another nonce error = %v, want ErrInvalidIDToken", err)
+	}
+	if _, err := p.Exchange(context.Background(), "unknown-code", "nonce-1"); err == nil {
+		t.Error("Exchange() accepted an unknown code")
+	}
+}
@@ -0,0 +1,78 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"strings"
+	"userService/internal/user"
+)
+
+var (
+	ErrUserDisabled = errors.New("user is disabled")
+	ErrUserDeleted  = errors.New("user is deleted")
+)
+
+type SignInResult struct {
+	User    user.Data `json:"user"`
+	Created bool      `json:"created"`
+	Linked  bool      `json:"linked"`
+}
+
+// SignIn resolves the internal user for an external identity. Known identities are reused,
+// verified emails are linked to an existing account, and anything else provisions a new user.
+// Disabled users and deleted users whose identity is still linked cannot sign in.
+func SignIn(ctx context.Context, issuer string, token IDToken) (SignInResult, error) {
+	email := strings.ToLower(strings.TrimSpace(token.Email))
+	identity := user.Identity{Issuer: issuer, Subject: token.Subject, Email: email}
+
+	existing, err := user.FindIdentity(ctx, issuer, token.Subject)
+	if err == nil {
+		data, err := user.GetUser(ctx, existing.UserId)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return SignInResult{}, ErrUserDeleted
+		}
+		if err != nil {
+			return SignInResult{}, err
+		}
+		if data.Disabled {
+			return SignInResult{}, ErrUserDisabled
+		}
+
+		identity.UserId = data.UserId
+		return SignInResult{User: data}, user.LinkIdentity(ctx, identity)
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return SignInResult{}, err
+	}
+
+	if email != "" && token.EmailVerified {
+		data, err := user.GetUserByEmail(ctx, email)
+		if err == nil && data.Disabled {
+			return SignInResult{}, ErrUserDisabled
+		}
+		if err == nil {
+			identity.UserId = data.UserId
+			return SignInResult{User: data, Linked: true}, user.LinkIdentity(ctx, identity)
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return SignInResult{}, err
+		}
+	}
+
+	data := user.Data{Name: token.Name}
+	if token.EmailVerified {
+		data.Email = email
+	}
+	if data.Name == "" {
+		data.Name = email
+	}
+
+	data, err = user.InsertUser(ctx, data)
+	if err != nil {
+		return SignInResult{}, err
+	}
+
+	identity.UserId = data.UserId
+	return SignInResult{User: data, Created: true}, user.LinkIdentity(ctx, identity)
+}
@@ -0,0 +1,93 @@
+package oidc
+
+import (
+	"errors"
+	"testing"
+	"userService/internal/testdb"
+	"userService/internal/user"
+)
+
+func idToken(subject, email string, verified bool) IDToken {
+	return IDToken{Subject: subject, Email: email, EmailVerified: verified, Name: "Ada"}
+}
+
+func TestSignInProvisionsUser(t *testing.T) {
+	ctx := testdb.Tenant(t)
+
+	first, err := SignIn(ctx, "https://issuer.example.com", idToken("subject-1", "Ada@Example.com", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.Created || first.Linked || first.User.Email != "ada@example.com" {
+		t.Fatalf("first SignIn() = %+v", first)
+	}
+
+	again, err := SignIn(ctx, "https://issuer.example.com", idToken("subject-1", "ada@example.com", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Created || again.User.UserId != first.User.UserId {
+		t.Errorf("second SignIn() = %+v, want user %d", again, first.User.UserId)
+	}
+}
+
+func TestSignInLinksVerifiedEmail(t *testing.T) {
+	ctx := testdb.Tenant(t)
+
+	existing, err := user.InsertUser(ctx, user.Data{Name: "Ada", Email: "ada@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unverified, err := SignIn(ctx, "https://issuer.example.com", idToken("subject-1", "ada@example.com", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unverified.Linked || unverified.User.UserId == existing.UserId {
+		t.Errorf("an unverified email was linked: %+v", unverified)
+	}
+
+	linked, err := SignIn(ctx, "https://issuer.example.com", idToken("subject-2", "ADA@example.com", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !linked.Linked || linked.Created || linked.User.UserId != existing.UserId {
+		t.Errorf("SignIn() = %+v, want a link to user %d", linked, existing.UserId)
+	}
+
+	identities, err := user.GetIdentities(ctx, existing.UserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 1 || identities[0].Subject != "subject-2" {
+		t.Errorf("identities = %+v", identities)
+	}
+}
+
+func TestSignInRejectsDisabledUser(t *testing.T) {
+	ctx := testdb.Tenant(t)
+
+	if _, err := user.InsertUser(ctx, user.Data{Name: "Ada", Email: "ada@example.com", Disabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := SignIn(ctx, "https://issuer.example.com", idToken("subject-1", "ada@example.com", true)); !errors.Is(err, ErrUserDisabled) {
+		t.Fatalf("SignIn() error = %v, want ErrUserDisabled", err)
+	}
+}
+
+func TestSignInRejectsDeletedUser(t *testing.T) {
+	ctx := testdb.Tenant(t)
+
+	result, err := SignIn(ctx, "https://issuer.example.com", idToken("subject-1", "ada@example.com", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := user.DeleteUser(ctx, result.User.UserId, result.User.Version); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := SignIn(ctx, "https://issuer.example.com", idToken("subject-1", "ada@example.com", true)); !errors.Is(err, ErrUserDeleted) {
+		t.Fatalf("SignIn() error = %v, want ErrUserDeleted", err)
+	}
+}
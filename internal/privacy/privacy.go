@@ -0,0 +1,152 @@
+package privacy
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"time"
+	"userService/internal/audit"
+	"userService/internal/events"
+	"userService/internal/group"
+	"userService/internal/idempotency"
+	"userService/internal/invitation"
+	"userService/internal/logging"
+	"userService/internal/user"
+	"userService/internal/webhook"
+)
+
+// Membership describes a group the user belongs to without listing the other members.
+type Membership struct {
+	GroupId string `json:"groupId"`
+	OrgId   string `json:"orgId,omitempty"`
+	Name    string `json:"name"`
+}
+
+// Archive is everything stored about one user. Sign-in sessions are not persisted, since tokens
+// are stateless; the linked identities with their last login are the closest record of them.
+type Archive struct {
+	ExportedAt  time.Time               `json:"exportedAt"`
+	User        user.Data               `json:"user"`
+	Identities  []user.Identity         `json:"identities"`
+	Groups      []Membership            `json:"groups"`
+	Invitations []invitation.Invitation `json:"invitations"`
+	AuditEvents []audit.Event           `json:"auditEvents"`
+}
+
+// Collect gathers the archive for a user of the tenant in ctx, including a soft deleted one. It
+// returns mongo.ErrNoDocuments when there is no such user.
+func Collect(ctx context.Context, userId int64) (Archive, error) {
+	data, err := user.GetUser(user.WithDeleted(ctx), userId)
+	if err != nil {
+		return Archive{}, err
+	}
+
+	archive := Archive{ExportedAt: time.Now().UTC(), User: data, Groups: []Membership{}}
+
+	if archive.Identities, err = user.GetIdentities(ctx, userId); err != nil {
+		return Archive{}, err
+	}
+	if archive.Identities == nil {
+		archive.Identities = []user.Identity{}
+	}
+
+	groups, err := group.UserGroups(user.WithDeleted(ctx), userId)
+	if err != nil {
+		return Archive{}, err
+	}
+	for _, g := range groups {
+		membership := Membership{GroupId: g.Id.Hex(), Name: g.Name}
+		if !g.OrgId.IsZero() {
+			membership.OrgId = g.OrgId.Hex()
+		}
+		archive.Groups = append(archive.Groups, membership)
+	}
+
+	if archive.Invitations, err = invitation.ForUser(ctx, userId, data.Email); err != nil {
+		return Archive{}, err
+	}
+
+	if archive.AuditEvents, _, err = audit.Find(ctx, audit.Query{UserId: userId}, 0, 0); err != nil {
+		return Archive{}, err
+	}
+
+	return archive, nil
+}
+
+func WriteJSON(w io.Writer, archive Archive) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(archive)
+}
+
+// WriteZip writes the archive as a zip with one JSON file per kind of data.
+func WriteZip(w io.Writer, archive Archive) error {
+	files := []struct {
+		name    string
+		content any
+	}{
+		{"user.json", archive.User},
+		{"identities.json", archive.Identities},
+		{"groups.json", archive.Groups},
+		{"invitations.json", archive.Invitations},
+		{"audit.json", archive.AuditEvents},
+	}
+
+	writer := zip.NewWriter(w)
+	for _, file := range files {
+		entry, err := writer.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: archive.ExportedAt})
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(entry)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.content); err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// Erase removes the personal data of a user of the tenant in ctx from every collection. The user
+// document stays as a tombstone and audit events keep their user id with personal values
+// replaced, so the audit history still adds up. It returns mongo.ErrNoDocuments when there is no
+// such user.
+func Erase(ctx context.Context, userId int64) error {
+	data, err := user.GetUser(user.WithDeleted(ctx), userId)
+	if err != nil {
+		return err
+	}
+
+	if err := group.RemoveUser(ctx, userId); err != nil {
+		return err
+	}
+	if err := invitation.EraseUser(ctx, userId, data.Email); err != nil {
+		return err
+	}
+	if err := webhook.EraseUser(ctx, userId); err != nil {
+		return err
+	}
+	if err := events.EraseUser(ctx, userId); err != nil {
+		return err
+	}
+	if err := idempotency.EraseUser(ctx, userId); err != nil {
+		return err
+	}
+
+	redacted, err := audit.Redact(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	if err := user.EraseUser(ctx, userId); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("user erased", slog.Int64("userId", userId), slog.Int64("audit_events_redacted", redacted))
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package privacy
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"strings"
+	"testing"
+	"userService/internal/audit"
+	"userService/internal/idempotency"
+	"userService/internal/tenant"
+	"userService/internal/testdb"
+	"userService/internal/user"
+)
+
+// personal is what the erased user told us about themselves or what we recorded about them.
+var personal = []string{"Ada Lovelace", "Countess Lovelace", "ada.lovelace@example.com", "ext-lovelace", "203.0.113.7"}
+
+func TestErase(t *testing.T) {
+	ctx := testdb.Tenant(t)
+	audit.HashChain = true
+	t.Cleanup(func() { audit.HashChain = false })
+	tenantId, _ := tenant.FromContext(ctx)
+
+	ada, err := user.InsertUser(ctx, user.Data{Name: "Ada Lovelace", Email: "ada.lovelace@example.com", ExternalId: "ext-lovelace", Roles: []string{"member"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := user.InsertUser(ctx, user.Data{Name: "Bob", Email: "bob@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The user renames their own record, which records their address, and then disables Bob.
+	self := audit.WithSourceIP(audit.WithActor(ctx, audit.UserActor(ada.UserId)), "203.0.113.7")
+	ada.Name = "Countess Lovelace"
+	if _, err := user.UpdateUser(self, ada); err != nil {
+		t.Fatal(err)
+	}
+	bob.Disabled = true
+	if _, err := user.UpdateUser(self, bob); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := user.LinkIdentity(ctx, user.Identity{Issuer: "https://idp.example.com", Subject: "ada", UserId: ada.UserId, Email: "ada.lovelace@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, stored := range []struct {
+		key    string
+		userId int64
+		body   string
+	}{{"create-ada", ada.UserId, `{"email":"ada.lovelace@example.com"}`}, {"create-bob", bob.UserId, `{"email":"bob@example.com"}`}} {
+		if _, err := idempotency.Begin(ctx, "createUser", stored.key, "hash"); err != nil {
+			t.Fatal(err)
+		}
+		if err := idempotency.Complete(ctx, "createUser", stored.key, stored.userId, 201, "application/json", []byte(stored.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := Erase(ctx, ada.UserId); err != nil {
+		t.Fatal(err)
+	}
+
+	database := user.Database()
+	for _, name := range []string{"user", "user.identities", "audit", "idempotency"} {
+		cursor, err := database.Collection(name).Find(ctx, bson.M{"tenantId": tenantId})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var documents []bson.M
+		if err := cursor.All(ctx, &documents); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, document := range documents {
+			text, err := bson.MarshalExtJSON(document, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, value := range personal {
+				if strings.Contains(string(text), value) {
+					t.Errorf("%s still holds %q: %s", name, value, text)
+				}
+			}
+			// Stored responses are binary, so they are matched by user instead.
+			if name == "idempotency" && document["userId"] == ada.UserId {
+				t.Errorf("idempotency still holds a response about the user: %s", text)
+			}
+		}
+	}
+
+	erased, err := user.GetUser(user.WithDeleted(ctx), ada.UserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if erased.Name != "" || erased.Email != "" || erased.ExternalId != "" || len(erased.Roles) != 0 || !erased.Disabled {
+		t.Errorf("erased user %+v", erased)
+	}
+
+	// The other user and the history stay.
+	if kept, err := user.GetUser(ctx, bob.UserId); err != nil || kept.Email != "bob@example.com" {
+		t.Errorf("other user %+v, %v", kept, err)
+	}
+	if replay, err := idempotency.Begin(ctx, "createUser", "create-bob", "hash"); err != nil || replay == nil {
+		t.Errorf("response about the other user is gone: %v", err)
+	}
+	events, _, err := audit.Find(ctx, audit.Query{UserId: ada.UserId}, 0, 0)
+	if err != nil || len(events) != 3 {
+		t.Errorf("%d audit events about the user, want create, update and erase: %v", len(events), err)
+	}
+	if result, err := audit.Verify(ctx); err != nil || !result.Valid {
+		t.Errorf("audit chain after erasure %+v, %v", result, err)
+	}
+}
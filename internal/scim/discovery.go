@@ -0,0 +1,111 @@
+package scim
+
+const (
+	ServiceProviderConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	ResourceTypeSchema          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	SchemaSchema                = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+
+	MaxResults = 200
+)
+
+func supported(value bool) map[string]any {
+	return map[string]any{"supported": value}
+}
+
+func ServiceProviderConfig(baseURL string) map[string]any {
+	return map[string]any{
+		"schemas":          []string{ServiceProviderConfigSchema},
+		"documentationUri": "https://datatracker.ietf.org/doc/html/rfc7644",
+		"patch":            supported(true),
+		"bulk":             map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":           map[string]any{"supported": true, "maxResults": MaxResults},
+		"changePassword":   supported(false),
+		"sort":             supported(false),
+		"etag":             supported(true),
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication with a static bearer token",
+			"primary":     true,
+		}},
+		"meta": map[string]any{"resourceType": "ServiceProviderConfig", "location": baseURL + "/ServiceProviderConfig"},
+	}
+}
+
+func ResourceTypes(baseURL string) []map[string]any {
+	return []map[string]any{
+		resourceType(baseURL, "User", "/Users", UserSchema),
+		resourceType(baseURL, "Group", "/Groups", GroupSchema),
+	}
+}
+
+func resourceType(baseURL, name, endpoint, schema string) map[string]any {
+	return map[string]any{
+		"schemas":  []string{ResourceTypeSchema},
+		"id":       name,
+		"name":     name,
+		"endpoint": endpoint,
+		"schema":   schema,
+		"meta":     map[string]any{"resourceType": "ResourceType", "location": baseURL + "/ResourceTypes/" + name},
+	}
+}
+
+func Schemas(baseURL string) []map[string]any {
+	return []map[string]any{
+		schemaDefinition(baseURL, UserSchema, "User", []map[string]any{
+			stringAttribute("userName", true, false, "server"),
+			stringAttribute("displayName", false, false, "none"),
+			{
+				"name": "name", "type": "complex", "multiValued": false, "required": false,
+				"mutability": "readWrite", "returned": "default",
+				"subAttributes": []map[string]any{stringAttribute("formatted", false, false, "none")},
+			},
+			{
+				"name": "emails", "type": "complex", "multiValued": true, "required": false,
+				"mutability": "readWrite", "returned": "default",
+				"subAttributes": []map[string]any{
+					stringAttribute("value", false, false, "none"),
+					stringAttribute("type", false, false, "none"),
+					{"name": "primary", "type": "boolean", "multiValued": false, "required": false, "mutability": "readWrite", "returned": "default"},
+				},
+			},
+			{"name": "active", "type": "boolean", "multiValued": false, "required": false, "mutability": "readWrite", "returned": "default"},
+			stringAttribute("externalId", false, true, "none"),
+		}),
+		schemaDefinition(baseURL, GroupSchema, "Group", []map[string]any{
+			stringAttribute("displayName", true, false, "none"),
+			{
+				"name": "members", "type": "complex", "multiValued": true, "required": false,
+				"mutability": "readWrite", "returned": "default",
+				"subAttributes": []map[string]any{
+					stringAttribute("value", false, true, "none"),
+					{"name": "type", "type": "string", "multiValued": false, "required": false, "canonicalValues": []string{"User"}, "mutability": "immutable", "returned": "default"},
+				},
+			},
+			stringAttribute("externalId", false, true, "none"),
+		}),
+	}
+}
+
+func schemaDefinition(baseURL, id, name string, attributes []map[string]any) map[string]any {
+	return map[string]any{
+		"schemas":    []string{SchemaSchema},
+		"id":         id,
+		"name":       name,
+		"attributes": attributes,
+		"meta":       map[string]any{"resourceType": "Schema", "location": baseURL + "/Schemas/" + id},
+	}
+}
+
+func stringAttribute(name string, required, caseExact bool, uniqueness string) map[string]any {
+	return map[string]any{
+		"name":        name,
+		"type":        "string",
+		"multiValued": false,
+		"required":    required,
+		"caseExact":   caseExact,
+		"mutability":  "readWrite",
+		"returned":    "default",
+		"uniqueness":  uniqueness,
+	}
+}
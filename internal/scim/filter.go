@@ -0,0 +1,316 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type attributeKind int
+
+const (
+	kindString attributeKind = iota
+	kindCaseExact
+	kindInt
+	kindObjectId
+	kindActive
+)
+
+type attribute struct {
+	field string
+	kind  attributeKind
+}
+
+var userAttributes = map[string]attribute{
+	"id":             {"userId", kindInt},
+	"username":       {"name", kindString},
+	"displayname":    {"name", kindString},
+	"name.formatted": {"name", kindString},
+	"emails":         {"email", kindString},
+	"emails.value":   {"email", kindString},
+	"externalid":     {"externalId", kindCaseExact},
+	"active":         {"disabled", kindActive},
+}
+
+var groupAttributes = map[string]attribute{
+	"id":            {"_id", kindObjectId},
+	"displayname":   {"name", kindString},
+	"externalid":    {"externalId", kindCaseExact},
+	"members":       {"members.value", kindCaseExact},
+	"members.value": {"members.value", kindCaseExact},
+}
+
+type FilterError struct {
+	Detail string
+}
+
+func (e *FilterError) Error() string {
+	return "invalid filter: " + e.Detail
+}
+
+func UserFilter(expression string) (bson.M, error) {
+	return parseFilter(expression, userAttributes, UserSchema)
+}
+
+func GroupFilter(expression string) (bson.M, error) {
+	return parseFilter(expression, groupAttributes, GroupSchema)
+}
+
+type filterParser struct {
+	tokens     []string
+	position   int
+	attributes map[string]attribute
+	schema     string
+}
+
+func parseFilter(expression string, attributes map[string]attribute, schema string) (bson.M, error) {
+	if strings.TrimSpace(expression) == "" {
+		return bson.M{}, nil
+	}
+
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &filterParser{tokens: tokens, attributes: attributes, schema: schema}
+	result, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if parser.position != len(parser.tokens) {
+		return nil, &FilterError{Detail: "unexpected " + parser.tokens[parser.position]}
+	}
+
+	return result, nil
+}
+
+func (p *filterParser) peek() string {
+	if p.position < len(p.tokens) {
+		return p.tokens[p.position]
+	}
+
+	return ""
+}
+
+func (p *filterParser) next() string {
+	token := p.peek()
+	p.position++
+
+	return token
+}
+
+func (p *filterParser) parseOr() (bson.M, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	clauses := []bson.M{left}
+	for strings.EqualFold(p.peek(), "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, right)
+	}
+
+	if len(clauses) == 1 {
+		return left, nil
+	}
+
+	return bson.M{"$or": clauses}, nil
+}
+
+func (p *filterParser) parseAnd() (bson.M, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+
+	clauses := []bson.M{left}
+	for strings.EqualFold(p.peek(), "and") {
+		p.next()
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, right)
+	}
+
+	if len(clauses) == 1 {
+		return left, nil
+	}
+
+	return bson.M{"$and": clauses}, nil
+}
+
+func (p *filterParser) parseFactor() (bson.M, error) {
+	if strings.EqualFold(p.peek(), "not") {
+		p.next()
+		inner, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{"$nor": []bson.M{inner}}, nil
+	}
+
+	if p.peek() == "(" {
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, &FilterError{Detail: "missing )"}
+		}
+		return inner, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (bson.M, error) {
+	path := p.next()
+	if path == "" || path == "(" || path == ")" {
+		return nil, &FilterError{Detail: "expected attribute"}
+	}
+
+	path = strings.TrimPrefix(strings.ToLower(path), strings.ToLower(p.schema)+":")
+	attr, ok := p.attributes[path]
+	if !ok {
+		return nil, &FilterError{Detail: "unsupported attribute " + path}
+	}
+
+	operator := strings.ToLower(p.next())
+	if operator == "pr" {
+		if attr.kind == kindActive {
+			return bson.M{}, nil
+		}
+		return bson.M{attr.field: bson.M{"$exists": true, "$nin": bson.A{"", nil}}}, nil
+	}
+
+	raw := p.next()
+	if raw == "" {
+		return nil, &FilterError{Detail: "expected value"}
+	}
+
+	var value any
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		return nil, &FilterError{Detail: "invalid value " + raw}
+	}
+
+	return attr.condition(operator, value)
+}
+
+func (a attribute) condition(operator string, value any) (bson.M, error) {
+	switch a.kind {
+	case kindActive:
+		active, ok := value.(bool)
+		if !ok || (operator != "eq" && operator != "ne") {
+			return nil, &FilterError{Detail: "active supports only eq/ne with a boolean"}
+		}
+		if operator == "ne" {
+			active = !active
+		}
+		if active {
+			return bson.M{a.field: bson.M{"$ne": true}}, nil
+		}
+		return bson.M{a.field: true}, nil
+	case kindInt:
+		text := fmt.Sprint(value)
+		number, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, &FilterError{Detail: "invalid id " + text}
+		}
+		return comparison(a.field, operator, number)
+	case kindObjectId:
+		id, err := primitive.ObjectIDFromHex(fmt.Sprint(value))
+		if err != nil {
+			return nil, &FilterError{Detail: "invalid id"}
+		}
+		return comparison(a.field, operator, id)
+	}
+
+	text, ok := value.(string)
+	if !ok {
+		return nil, &FilterError{Detail: "expected string value"}
+	}
+
+	options := ""
+	if a.kind == kindString {
+		options = "i"
+	}
+
+	quoted := regexp.QuoteMeta(text)
+	switch operator {
+	case "eq":
+		if options == "" {
+			return bson.M{a.field: text}, nil
+		}
+		return bson.M{a.field: primitive.Regex{Pattern: "^" + quoted + "$", Options: options}}, nil
+	case "ne":
+		return bson.M{a.field: bson.M{"$not": primitive.Regex{Pattern: "^" + quoted + "$", Options: options}}}, nil
+	case "co":
+		return bson.M{a.field: primitive.Regex{Pattern: quoted, Options: options}}, nil
+	case "sw":
+		return bson.M{a.field: primitive.Regex{Pattern: "^" + quoted, Options: options}}, nil
+	case "ew":
+		return bson.M{a.field: primitive.Regex{Pattern: quoted + "$", Options: options}}, nil
+	}
+
+	return comparison(a.field, operator, text)
+}
+
+func comparison(field, operator string, value any) (bson.M, error) {
+	operators := map[string]string{"eq": "$eq", "ne": "$ne", "gt": "$gt", "ge": "$gte", "lt": "$lt", "le": "$lte"}
+
+	mongoOperator, ok := operators[operator]
+	if !ok {
+		return nil, &FilterError{Detail: "unsupported operator " + operator}
+	}
+
+	return bson.M{field: bson.M{mongoOperator: value}}, nil
+}
+
+func tokenize(expression string) ([]string, error) {
+	var tokens []string
+
+	for i := 0; i < len(expression); {
+		switch c := expression[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(expression) && expression[end] != '"' {
+				if expression[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expression) {
+				return nil, &FilterError{Detail: "unterminated string"}
+			}
+			tokens = append(tokens, expression[i:end+1])
+			i = end + 1
+		default:
+			end := i
+			for end < len(expression) && !strings.ContainsRune(" \t()\"", rune(expression[end])) {
+				end++
+			}
+			tokens = append(tokens, expression[i:end])
+			i = end
+		}
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,213 @@
+package scim
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"testing"
+)
+
+func exact(text string) primitive.Regex {
+	return primitive.Regex{Pattern: "^" + text + "$", Options: "i"}
+}
+
+func TestUserFilter(t *testing.T) {
+	adaEq := bson.M{"name": exact("ada")}
+	bobEq := bson.M{"name": exact("bob")}
+	active := bson.M{"disabled": bson.M{"$ne": true}}
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bson.M
+	}{
+		{name: "empty", expression: "  ", want: bson.M{}},
+		{name: "eq is case insensitive", expression: `userName eq "ada"`, want: adaEq},
+		{name: "eq quotes the value", expression: `emails.value eq "a.b+c@example.com"`, want: bson.M{"email": exact(`a\.b\+c@example\.com`)}},
+		{name: "eq with schema prefix", expression: `urn:ietf:params:scim:schemas:core:2.0:User:userName eq "ada"`, want: adaEq},
+		{name: "operator and attribute case", expression: `USERNAME EQ "ada"`, want: adaEq},
+		{name: "eq on case exact attribute", expression: `externalId eq "Ext-1"`, want: bson.M{"externalId": "Ext-1"}},
+		{name: "ne", expression: `displayName ne "ada"`, want: bson.M{"name": bson.M{"$not": exact("ada")}}},
+		{name: "co", expression: `emails co "example.com"`, want: bson.M{"email": primitive.Regex{Pattern: `example\.com`, Options: "i"}}},
+		{name: "sw", expression: `userName sw "a*"`, want: bson.M{"name": primitive.Regex{Pattern: `^a\*`, Options: "i"}}},
+		{name: "ew", expression: `userName ew "da"`, want: bson.M{"name": primitive.Regex{Pattern: `da$`, Options: "i"}}},
+		{name: "co on case exact attribute", expression: `externalId co "x"`, want: bson.M{"externalId": primitive.Regex{Pattern: "x"}}},
+		{name: "pr", expression: `externalId pr`, want: bson.M{"externalId": bson.M{"$exists": true, "$nin": bson.A{"", nil}}}},
+		{name: "pr on active matches everyone", expression: `active pr`, want: bson.M{}},
+		{name: "gt on id", expression: `id gt "5"`, want: bson.M{"userId": bson.M{"$gt": int64(5)}}},
+		{name: "le on id", expression: `id le 7`, want: bson.M{"userId": bson.M{"$lte": int64(7)}}},
+		{name: "gt on string", expression: `userName gt "m"`, want: bson.M{"name": bson.M{"$gt": "m"}}},
+		{name: "active eq true", expression: `active eq true`, want: active},
+		{name: "active ne true", expression: `active ne true`, want: bson.M{"disabled": true}},
+		{name: "active eq false", expression: `active eq false`, want: bson.M{"disabled": true}},
+		{
+			name:       "and binds tighter than or",
+			expression: `userName eq "ada" or userName eq "bob" and active eq true`,
+			want:       bson.M{"$or": []bson.M{adaEq, {"$and": []bson.M{bobEq, active}}}},
+		},
+		{
+			name:       "parentheses override precedence",
+			expression: `(userName eq "ada" or userName eq "bob") and active eq true`,
+			want:       bson.M{"$and": []bson.M{{"$or": []bson.M{adaEq, bobEq}}, active}},
+		},
+		{
+			name:       "not applies to the next factor",
+			expression: `not userName eq "ada" and active eq true`,
+			want:       bson.M{"$and": []bson.M{{"$nor": []bson.M{adaEq}}, active}},
+		},
+		{
+			name:       "not of a group",
+			expression: `not (userName eq "ada" or userName eq "bob")`,
+			want:       bson.M{"$nor": []bson.M{{"$or": []bson.M{adaEq, bobEq}}}},
+		},
+		{
+			name:       "chains flatten",
+			expression: `userName eq "ada" or userName eq "bob" or externalId eq "x"`,
+			want:       bson.M{"$or": []bson.M{adaEq, bobEq, {"externalId": "x"}}},
+		},
+		{name: "escaped quote", expression: `userName eq "a\"b"`, want: bson.M{"name": exact(`a"b`)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := UserFilter(test.expression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGroupFilter(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bson.M
+	}{
+		{name: "id", expression: `id eq "` + id.Hex() + `"`, want: bson.M{"_id": bson.M{"$eq": id}}},
+		{name: "displayName", expression: `displayName eq "Admins"`, want: bson.M{"name": exact("Admins")}},
+		{name: "members", expression: `members eq "42"`, want: bson.M{"members.value": "42"}},
+		{name: "members.value", expression: `members.value eq "42"`, want: bson.M{"members.value": "42"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := GroupFilter(test.expression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		group      bool
+	}{
+		{name: "unknown attribute", expression: `password eq "x"`},
+		{name: "operator injection", expression: `$where eq "1"`},
+		{name: "internal field name", expression: `tenantId eq "other"`},
+		{name: "group attribute on users", expression: `members eq "1"`},
+		{name: "user attribute on groups", expression: `userName eq "ada"`, group: true},
+		{name: "other schema prefix", expression: `urn:ietf:params:scim:schemas:core:2.0:Group:displayName eq "x"`},
+		{name: "unknown operator", expression: `userName like "ada"`},
+		{name: "missing operator", expression: `userName`},
+		{name: "missing value", expression: `userName eq`},
+		{name: "unquoted value", expression: `userName eq ada`},
+		{name: "number for string attribute", expression: `userName eq 5`},
+		{name: "object value", expression: `userName eq {"$ne":""}`},
+		{name: "unterminated string", expression: `userName eq "ada`},
+		{name: "missing close", expression: `(userName eq "ada"`},
+		{name: "extra close", expression: `userName eq "ada")`},
+		{name: "empty group", expression: `()`},
+		{name: "dangling and", expression: `userName eq "ada" and`},
+		{name: "dangling not", expression: `not`},
+		{name: "invalid id", expression: `id eq "abc"`},
+		{name: "invalid group id", expression: `id eq "abc"`, group: true},
+		{name: "active with string", expression: `active eq "true"`},
+		{name: "active with gt", expression: `active gt true`},
+		{name: "unsupported operator on id", expression: `id co "1"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parse := UserFilter
+			if test.group {
+				parse = GroupFilter
+			}
+
+			got, err := parse(test.expression)
+			var filterErr *FilterError
+			if !errors.As(err, &filterErr) {
+				t.Fatalf("got %v, %v, want a filter error", got, err)
+			}
+		})
+	}
+}
+
+// Filters reach the database as they are, so they may only name fields of the attribute tables
+// and operators the parser emits itself.
+func TestFilterFields(t *testing.T) {
+	allowed := map[string]bool{}
+	for _, operator := range []string{"$or", "$and", "$nor", "$not", "$exists", "$nin", "$eq", "$ne", "$gt", "$gte", "$lt", "$lte"} {
+		allowed[operator] = true
+	}
+	for _, table := range []map[string]attribute{userAttributes, groupAttributes} {
+		for _, attr := range table {
+			allowed[attr.field] = true
+		}
+	}
+
+	expressions := []string{
+		`userName eq "$where" or emails co "{\"$gt\":\"\"}"`,
+		`not (externalId pr and id ge 1) or active eq false`,
+		`displayName sw "." and name.formatted ew "$" and emails.value ne "x"`,
+		`(members eq "1" or displayName co "a") and not externalId eq "b"`,
+	}
+	parsed := 0
+	for _, expression := range expressions {
+		for _, parse := range []func(string) (bson.M, error){UserFilter, GroupFilter} {
+			filter, err := parse(expression)
+			if err != nil {
+				continue
+			}
+			parsed++
+			for _, name := range fieldNames(filter) {
+				if !allowed[name] {
+					t.Errorf("%s: produced field %q", expression, name)
+				}
+			}
+		}
+	}
+	if parsed < len(expressions) {
+		t.Errorf("only %d filters parsed", parsed)
+	}
+}
+
+func fieldNames(value any) []string {
+	var names []string
+	switch typed := value.(type) {
+	case bson.M:
+		for key, inner := range typed {
+			names = append(names, key)
+			names = append(names, fieldNames(inner)...)
+		}
+	case []bson.M:
+		for _, inner := range typed {
+			names = append(names, fieldNames(inner)...)
+		}
+	}
+
+	return names
+}
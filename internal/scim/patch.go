@@ -0,0 +1,265 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"userService/internal/group"
+	"userService/internal/user"
+)
+
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type PatchError struct {
+	ScimType string
+	Detail   string
+}
+
+func (e *PatchError) Error() string {
+	return e.Detail
+}
+
+var memberPathPattern = regexp.MustCompile(`(?i)^members\[\s*value\s+eq\s+"([^"]*)"\s*\]$`)
+
+func ApplyUserPatch(data user.Data, request PatchRequest) (user.Data, error) {
+	for _, operation := range request.Operations {
+		op := strings.ToLower(operation.Op)
+		path := strings.ToLower(strings.TrimPrefix(operation.Path, UserSchema+":"))
+
+		if path == "" {
+			if op == "remove" {
+				return data, &PatchError{ScimType: "noTarget", Detail: "remove requires a path"}
+			}
+
+			var attributes map[string]json.RawMessage
+			if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+				return data, &PatchError{ScimType: "invalidValue", Detail: "value must be an object"}
+			}
+			for name, value := range attributes {
+				var err error
+				if data, err = setUserAttribute(data, strings.ToLower(name), value); err != nil {
+					return data, err
+				}
+			}
+			continue
+		}
+
+		switch op {
+		case "add", "replace":
+			var err error
+			if data, err = setUserAttribute(data, path, operation.Value); err != nil {
+				return data, err
+			}
+		case "remove":
+			switch {
+			case path == "externalid":
+				data.ExternalId = ""
+			case strings.HasPrefix(path, "emails"):
+				data.Email = ""
+			default:
+				return data, &PatchError{ScimType: "mutability", Detail: "attribute " + operation.Path + " cannot be removed"}
+			}
+		default:
+			return data, &PatchError{ScimType: "invalidSyntax", Detail: "unsupported op " + operation.Op}
+		}
+	}
+
+	return data, nil
+}
+
+func setUserAttribute(data user.Data, path string, raw json.RawMessage) (user.Data, error) {
+	switch {
+	case path == "username" || path == "displayname" || path == "name.formatted":
+		value, err := stringValue(raw)
+		if err != nil || value == "" {
+			return data, &PatchError{ScimType: "invalidValue", Detail: path + " must be a non-empty string"}
+		}
+		data.Name = value
+	case path == "name":
+		var name Name
+		if err := json.Unmarshal(raw, &name); err != nil {
+			return data, &PatchError{ScimType: "invalidValue", Detail: "name must be an object"}
+		}
+		if name.Formatted != "" {
+			data.Name = name.Formatted
+		}
+	case path == "externalid":
+		value, err := stringValue(raw)
+		if err != nil {
+			return data, &PatchError{ScimType: "invalidValue", Detail: "externalId must be a string"}
+		}
+		data.ExternalId = value
+	case path == "active":
+		active, err := boolValue(raw)
+		if err != nil {
+			return data, &PatchError{ScimType: "invalidValue", Detail: "active must be a boolean"}
+		}
+		data.Disabled = !active
+	case path == "emails":
+		var emails []MultiValue
+		if err := json.Unmarshal(raw, &emails); err != nil {
+			return data, &PatchError{ScimType: "invalidValue", Detail: "emails must be a list"}
+		}
+		data.Email = User{Emails: emails}.primaryEmail()
+	case strings.HasPrefix(path, "emails[") && strings.HasSuffix(path, "].value"):
+		value, err := stringValue(raw)
+		if err != nil {
+			return data, &PatchError{ScimType: "invalidValue", Detail: "email must be a string"}
+		}
+		data.Email = strings.ToLower(value)
+	default:
+		return data, &PatchError{ScimType: "invalidPath", Detail: "unsupported path " + path}
+	}
+
+	return data, nil
+}
+
+func ApplyGroupPatch(model group.Group, request PatchRequest) (group.Group, error) {
+	for _, operation := range request.Operations {
+		op := strings.ToLower(operation.Op)
+		path := strings.TrimPrefix(operation.Path, GroupSchema+":")
+
+		if path == "" {
+			if op == "remove" {
+				return model, &PatchError{ScimType: "noTarget", Detail: "remove requires a path"}
+			}
+
+			var resource Group
+			if err := json.Unmarshal(operation.Value, &resource); err != nil {
+				return model, &PatchError{ScimType: "invalidValue", Detail: "value must be an object"}
+			}
+			if resource.DisplayName != "" {
+				model.Name = resource.DisplayName
+			}
+			if resource.ExternalId != "" {
+				model.ExternalId = resource.ExternalId
+			}
+			if resource.Members != nil {
+				model.Members = mergeMembers(op, model.Members, membersFromValues(resource.Members))
+			}
+			continue
+		}
+
+		if match := memberPathPattern.FindStringSubmatch(path); match != nil {
+			if op != "remove" {
+				return model, &PatchError{ScimType: "invalidPath", Detail: "filtered member paths support only remove"}
+			}
+			model.Members = removeMembers(model.Members, []group.Member{
+				{Type: group.MemberTypeUser, Value: match[1]},
+				{Type: group.MemberTypeGroup, Value: match[1]},
+			})
+			continue
+		}
+
+		switch strings.ToLower(path) {
+		case "displayname":
+			value, err := stringValue(operation.Value)
+			if err != nil || value == "" || op == "remove" {
+				return model, &PatchError{ScimType: "invalidValue", Detail: "displayName must be a non-empty string"}
+			}
+			model.Name = value
+		case "externalid":
+			if op == "remove" {
+				model.ExternalId = ""
+				continue
+			}
+			value, err := stringValue(operation.Value)
+			if err != nil {
+				return model, &PatchError{ScimType: "invalidValue", Detail: "externalId must be a string"}
+			}
+			model.ExternalId = value
+		case "members":
+			var values []MultiValue
+			if len(operation.Value) > 0 {
+				if err := json.Unmarshal(operation.Value, &values); err != nil {
+					return model, &PatchError{ScimType: "invalidValue", Detail: "members must be a list"}
+				}
+			}
+			if op == "remove" && len(values) == 0 {
+				model.Members = []group.Member{}
+				continue
+			}
+			model.Members = mergeMembers(op, model.Members, membersFromValues(values))
+		default:
+			return model, &PatchError{ScimType: "invalidPath", Detail: "unsupported path " + path}
+		}
+	}
+
+	return model, nil
+}
+
+func mergeMembers(op string, current, changes []group.Member) []group.Member {
+	switch op {
+	case "replace":
+		return changes
+	case "remove":
+		return removeMembers(current, changes)
+	}
+
+	for _, change := range changes {
+		if !containsMember(current, change) {
+			current = append(current, change)
+		}
+	}
+
+	return current
+}
+
+func removeMembers(current, removed []group.Member) []group.Member {
+	result := []group.Member{}
+	for _, member := range current {
+		if !containsMember(removed, member) {
+			result = append(result, member)
+		}
+	}
+
+	return result
+}
+
+func containsMember(members []group.Member, member group.Member) bool {
+	for _, candidate := range members {
+		if candidate == member {
+			return true
+		}
+	}
+
+	return false
+}
+
+func stringValue(raw json.RawMessage) (string, error) {
+	var value string
+	err := json.Unmarshal(raw, &value)
+
+	return value, err
+}
+
+// boolValue accepts JSON booleans as well as the "True"/"False" strings some identity providers send.
+func boolValue(raw json.RawMessage) (bool, error) {
+	var value bool
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return value, nil
+	}
+
+	text, err := stringValue(raw)
+	if err != nil {
+		return false, err
+	}
+
+	value, err = strconv.ParseBool(strings.ToLower(text))
+	if err != nil {
+		return false, fmt.Errorf("invalid boolean %q", text)
+	}
+
+	return value, nil
+}
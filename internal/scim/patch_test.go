@@ -0,0 +1,189 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"userService/internal/group"
+	"userService/internal/user"
+)
+
+func operation(op, path, value string) PatchOperation {
+	operation := PatchOperation{Op: op, Path: path}
+	if value != "" {
+		operation.Value = json.RawMessage(value)
+	}
+
+	return operation
+}
+
+func TestApplyUserPatch(t *testing.T) {
+	stored := user.Data{UserId: 7, TenantId: "tenant-a", Name: "Ada", Email: "ada@example.com", ExternalId: "ext-1", Roles: []string{"member"}}
+
+	tests := []struct {
+		name       string
+		operations []PatchOperation
+		want       user.Data
+		scimType   string
+	}{
+		{
+			name:       "replace userName",
+			operations: []PatchOperation{operation("replace", "userName", `"Ada Lovelace"`)},
+			want:       user.Data{UserId: 7, TenantId: "tenant-a", Name: "Ada Lovelace", Email: "ada@example.com", ExternalId: "ext-1", Roles: []string{"member"}},
+		},
+		{
+			name:       "add with schema prefix and op case",
+			operations: []PatchOperation{operation("Add", UserSchema+":displayName", `"Countess"`)},
+			want:       user.Data{UserId: 7, TenantId: "tenant-a", Name: "Countess", Email: "ada@example.com", ExternalId: "ext-1", Roles: []string{"member"}},
+		},
+		{
+			name:       "replace name object",
+			operations: []PatchOperation{operation("replace", "name", `{"formatted":"A. L."}`)},
+			want:       user.Data{UserId: 7, TenantId: "tenant-a", Name: "A. L.", Email: "ada@example.com", ExternalId: "ext-1", Roles: []string{"member"}},
+		},
+		{
+			name:       "deactivate with string boolean",
+			operations: []PatchOperation{operation("replace", "active", `"False"`)},
+			want:       user.Data{UserId: 7, TenantId: "tenant-a", Name: "Ada", Email: "ada@example.com", ExternalId: "ext-1", Roles: []string{"member"}, Disabled: true},
+		},
+		{
+			name:       "replace primary email",
+			operations: []PatchOperation{operation("replace", "emails", `[{"value":"Other@Example.com"},{"value":"Work@Example.com","primary":true}]`)},
+			want:       user.Data{UserId: 7, TenantId: "tenant-a", Name: "Ada", Email: "work@example.com", ExternalId: "ext-1", Roles: []string{"member"}},
+		},
+		{
+			name:       "replace filtered email value",
+			operations: []PatchOperation{operation("replace", `emails[type eq "work"].value`, `"New@Example.com"`)},
+			want:       user.Data{UserId: 7, TenantId: "tenant-a", Name: "Ada", Email: "new@example.com", ExternalId: "ext-1", Roles: []string{"member"}},
+		},
+		{
+			name:       "remove externalId and emails",
+			operations: []PatchOperation{operation("remove", "externalId", ""), operation("remove", "emails", "")},
+			want:       user.Data{UserId: 7, TenantId: "tenant-a", Name: "Ada", Roles: []string{"member"}},
+		},
+		{
+			name:       "replace without path",
+			operations: []PatchOperation{operation("replace", "", `{"externalId":"ext-2","active":false}`)},
+			want:       user.Data{UserId: 7, TenantId: "tenant-a", Name: "Ada", Email: "ada@example.com", ExternalId: "ext-2", Roles: []string{"member"}, Disabled: true},
+		},
+		{name: "remove without path", operations: []PatchOperation{operation("remove", "", "")}, scimType: "noTarget"},
+		{name: "remove userName", operations: []PatchOperation{operation("remove", "userName", "")}, scimType: "mutability"},
+		{name: "empty userName", operations: []PatchOperation{operation("replace", "userName", `""`)}, scimType: "invalidValue"},
+		{name: "active as number", operations: []PatchOperation{operation("replace", "active", `1`)}, scimType: "invalidValue"},
+		{name: "emails as object", operations: []PatchOperation{operation("replace", "emails", `{"value":"a@example.com"}`)}, scimType: "invalidValue"},
+		{name: "value not an object", operations: []PatchOperation{operation("add", "", `"ada"`)}, scimType: "invalidValue"},
+		{name: "unsupported op", operations: []PatchOperation{operation("move", "userName", `"x"`)}, scimType: "invalidSyntax"},
+		{name: "roles are not patchable", operations: []PatchOperation{operation("add", "roles", `["admin"]`)}, scimType: "invalidPath"},
+		{name: "tenant is not patchable", operations: []PatchOperation{operation("replace", "", `{"tenantId":"other"}`)}, scimType: "invalidPath"},
+		{name: "id is not patchable", operations: []PatchOperation{operation("replace", "id", `"8"`)}, scimType: "invalidPath"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := stored
+			original.Roles = append([]string(nil), stored.Roles...)
+
+			got, err := ApplyUserPatch(original, PatchRequest{Schemas: []string{PatchOpSchema}, Operations: test.operations})
+			if test.scimType != "" {
+				var patchErr *PatchError
+				if !errors.As(err, &patchErr) || patchErr.ScimType != test.scimType {
+					t.Fatalf("error %v, want scimType %s", err, test.scimType)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyGroupPatch(t *testing.T) {
+	ada := group.Member{Type: group.MemberTypeUser, Value: "1"}
+	bob := group.Member{Type: group.MemberTypeUser, Value: "2"}
+	admins := group.Member{Type: group.MemberTypeGroup, Value: "64b000000000000000000001"}
+	stored := group.Group{Name: "Team", ExternalId: "ext-1", Members: []group.Member{ada}}
+
+	withMembers := func(members ...group.Member) group.Group {
+		return group.Group{Name: "Team", ExternalId: "ext-1", Members: append([]group.Member{}, members...)}
+	}
+
+	tests := []struct {
+		name       string
+		operations []PatchOperation
+		want       group.Group
+		scimType   string
+	}{
+		{
+			name:       "replace displayName",
+			operations: []PatchOperation{operation("replace", "displayName", `"Crew"`)},
+			want:       group.Group{Name: "Crew", ExternalId: "ext-1", Members: []group.Member{ada}},
+		},
+		{
+			name:       "remove externalId",
+			operations: []PatchOperation{operation("remove", "externalId", "")},
+			want:       group.Group{Name: "Team", Members: []group.Member{ada}},
+		},
+		{
+			name:       "add members skips existing ones",
+			operations: []PatchOperation{operation("add", "members", `[{"value":"1"},{"value":"2"},{"value":"64b000000000000000000001","type":"Group"}]`)},
+			want:       withMembers(ada, bob, admins),
+		},
+		{
+			name:       "replace members",
+			operations: []PatchOperation{operation("replace", "members", `[{"value":"2"}]`)},
+			want:       withMembers(bob),
+		},
+		{
+			name:       "remove listed members",
+			operations: []PatchOperation{operation("add", "members", `[{"value":"2"}]`), operation("remove", "members", `[{"value":"1"}]`)},
+			want:       withMembers(bob),
+		},
+		{
+			name:       "remove all members",
+			operations: []PatchOperation{operation("remove", "members", "")},
+			want:       withMembers(),
+		},
+		{
+			name:       "remove filtered member",
+			operations: []PatchOperation{operation("add", "members", `[{"value":"2"}]`), operation("remove", `members[value eq "1"]`, "")},
+			want:       withMembers(bob),
+		},
+		{
+			name:       "add without path",
+			operations: []PatchOperation{operation("add", "", `{"displayName":"Crew","members":[{"value":"2"}]}`)},
+			want:       group.Group{Name: "Crew", ExternalId: "ext-1", Members: []group.Member{ada, bob}},
+		},
+		{name: "remove without path", operations: []PatchOperation{operation("remove", "", "")}, scimType: "noTarget"},
+		{name: "remove displayName", operations: []PatchOperation{operation("remove", "displayName", "")}, scimType: "invalidValue"},
+		{name: "members as object", operations: []PatchOperation{operation("add", "members", `{"value":"1"}`)}, scimType: "invalidValue"},
+		{name: "replace filtered member", operations: []PatchOperation{operation("replace", `members[value eq "1"]`, `{"value":"2"}`)}, scimType: "invalidPath"},
+		{name: "orgId is not patchable", operations: []PatchOperation{operation("replace", "orgId", `"x"`)}, scimType: "invalidPath"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := stored
+			original.Members = append([]group.Member(nil), stored.Members...)
+
+			got, err := ApplyGroupPatch(original, PatchRequest{Schemas: []string{PatchOpSchema}, Operations: test.operations})
+			if test.scimType != "" {
+				var patchErr *PatchError
+				if !errors.As(err, &patchErr) || patchErr.ScimType != test.scimType {
+					t.Fatalf("error %v, want scimType %s", err, test.scimType)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package scim
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"userService/internal/group"
+	"userService/internal/user"
+)
+
+const (
+	UserSchema         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	GroupSchema        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ListResponseSchema = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	PatchOpSchema      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ErrorSchema        = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location,omitempty"`
+	Version      string `json:"version,omitempty"`
+}
+
+type Name struct {
+	Formatted string `json:"formatted,omitempty"`
+}
+
+type MultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type User struct {
+	Schemas     []string     `json:"schemas"`
+	Id          string       `json:"id,omitempty"`
+	ExternalId  string       `json:"externalId,omitempty"`
+	UserName    string       `json:"userName"`
+	DisplayName string       `json:"displayName,omitempty"`
+	Name        *Name        `json:"name,omitempty"`
+	Emails      []MultiValue `json:"emails,omitempty"`
+	Active      *bool        `json:"active,omitempty"`
+	Meta        *Meta        `json:"meta,omitempty"`
+}
+
+type Group struct {
+	Schemas     []string     `json:"schemas"`
+	Id          string       `json:"id,omitempty"`
+	ExternalId  string       `json:"externalId,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []MultiValue `json:"members"`
+	Meta        *Meta        `json:"meta,omitempty"`
+}
+
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int64    `json:"totalResults"`
+	StartIndex   int64    `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    any      `json:"Resources"`
+}
+
+func UserFromData(data user.Data, baseURL string) User {
+	active := !data.Disabled
+	resource := User{
+		Schemas:     []string{UserSchema},
+		Id:          strconv.FormatInt(data.UserId, 10),
+		ExternalId:  data.ExternalId,
+		UserName:    data.Name,
+		DisplayName: data.Name,
+		Name:        &Name{Formatted: data.Name},
+		Active:      &active,
+	}
+	if data.Email != "" {
+		resource.Emails = []MultiValue{{Value: data.Email, Type: "work", Primary: true}}
+	}
+
+	resource.Meta = &Meta{
+		ResourceType: "User",
+		Location:     baseURL + "/Users/" + resource.Id,
+		Version:      etag(resource),
+	}
+
+	return resource
+}
+
+// ToData copies the attributes of the resource that the service stores onto data.
+func (u User) ToData(data user.Data) user.Data {
+	data.Name = u.UserName
+	if data.Name == "" {
+		data.Name = u.DisplayName
+	}
+	if data.Name == "" && u.Name != nil {
+		data.Name = u.Name.Formatted
+	}
+
+	data.Email = u.primaryEmail()
+	data.ExternalId = u.ExternalId
+	data.Disabled = u.Active != nil && !*u.Active
+
+	return data
+}
+
+func (u User) primaryEmail() string {
+	for _, email := range u.Emails {
+		if email.Primary {
+			return strings.ToLower(email.Value)
+		}
+	}
+
+	if len(u.Emails) > 0 {
+		return strings.ToLower(u.Emails[0].Value)
+	}
+
+	return ""
+}
+
+func GroupFromModel(model group.Group, baseURL string) Group {
+	resource := Group{
+		Schemas:     []string{GroupSchema},
+		Id:          model.Id.Hex(),
+		ExternalId:  model.ExternalId,
+		DisplayName: model.Name,
+		Members:     []MultiValue{},
+	}
+
+	for _, member := range model.Members {
+		resource.Members = append(resource.Members, MultiValue{
+			Value: member.Value,
+			Type:  member.Type,
+			Ref:   baseURL + "/" + member.Type + "s/" + member.Value,
+		})
+	}
+
+	resource.Meta = &Meta{
+		ResourceType: "Group",
+		Location:     baseURL + "/Groups/" + resource.Id,
+		Version:      etag(resource),
+	}
+
+	return resource
+}
+
+func (g Group) ToModel(model group.Group) group.Group {
+	model.Name = g.DisplayName
+	model.ExternalId = g.ExternalId
+	model.Members = membersFromValues(g.Members)
+
+	return model
+}
+
+func membersFromValues(values []MultiValue) []group.Member {
+	members := []group.Member{}
+	for _, value := range values {
+		memberType := group.MemberTypeUser
+		if value.Type == group.MemberTypeGroup {
+			memberType = group.MemberTypeGroup
+		}
+		members = append(members, group.Member{Type: memberType, Value: value.Value})
+	}
+
+	return members
+}
+
+// etag derives a strong entity tag from the resource representation, ignoring meta. It changes
+// with every visible change, so If-Match can compare it strongly.
+func etag(resource any) string {
+	payload, _ := json.Marshal(resource)
+	sum := sha256.Sum256(payload)
+
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
@@ -0,0 +1,37 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var ErrMissingTenant = errors.New("tenant is not set on the request context")
+
+type contextKey struct{}
+
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(contextKey{}).(string)
+
+	return id, ok && id != ""
+}
+
+// Scope restricts a repository filter to the tenant carried by ctx. Repositories must build
+// every query through it so that a handler that forgets about tenants still cannot leak data.
+func Scope(ctx context.Context, filter bson.M) (bson.M, error) {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return nil, ErrMissingTenant
+	}
+
+	scoped := bson.M{"tenantId": id}
+	if len(filter) > 0 {
+		scoped = bson.M{"$and": []bson.M{scoped, filter}}
+	}
+
+	return scoped, nil
+}
@@ -0,0 +1,126 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+	"time"
+)
+
+var (
+	ErrNotFound      = errors.New("tenant not found")
+	ErrAlreadyExists = errors.New("tenant already exists")
+	ErrInvalidId     = errors.New("tenant id must be 1-63 lowercase letters, digits or dashes")
+)
+
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+type Tenant struct {
+	Id        string    `json:"id" bson:"_id"`
+	Name      string    `json:"name" bson:"name"`
+	Disabled  bool      `json:"disabled" bson:"disabled"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+var collection *mongo.Collection
+
+func UseDatabase(database *mongo.Database) {
+	collection = database.Collection("tenant")
+}
+
+func ValidId(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+func CreateTenant(ctx context.Context, id, name string) (Tenant, error) {
+	if !ValidId(id) {
+		return Tenant{}, ErrInvalidId
+	}
+
+	now := time.Now().UTC()
+	created := Tenant{Id: id, Name: name, CreatedAt: now, UpdatedAt: now}
+
+	if _, err := collection.InsertOne(ctx, created); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return Tenant{}, ErrAlreadyExists
+		}
+		return Tenant{}, err
+	}
+
+	return created, nil
+}
+
+// EnsureTenant creates the tenant if it does not exist yet.
+func EnsureTenant(ctx context.Context, id, name string) error {
+	_, err := CreateTenant(ctx, id, name)
+	if errors.Is(err, ErrAlreadyExists) {
+		return nil
+	}
+
+	return err
+}
+
+func GetTenant(ctx context.Context, id string) (Tenant, error) {
+	result := Tenant{}
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Tenant{}, ErrNotFound
+	}
+
+	return result, err
+}
+
+func ListTenants(ctx context.Context, skip, limit int64) ([]Tenant, int64, error) {
+	total, err := collection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetSkip(skip)
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	result := []Tenant{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, 0, err
+	}
+
+	return result, total, nil
+}
+
+func UpdateTenant(ctx context.Context, id, name string, disabled bool) (Tenant, error) {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	update := bson.M{"$set": bson.M{"name": name, "disabled": disabled, "updatedAt": time.Now().UTC()}}
+
+	result := Tenant{}
+	err := collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, update, opts).Decode(&result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Tenant{}, ErrNotFound
+	}
+
+	return result, err
+}
+
+func DeleteTenant(ctx context.Context, id string) error {
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
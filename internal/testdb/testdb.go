@@ -0,0 +1,45 @@
+// Package testdb connects tests to the MongoDB given by MONGO_TEST_URI. Tests that need a
+// database are skipped without it.
+package testdb
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"os"
+	"sync"
+	"testing"
+	"time"
+	"userService/internal/config"
+	"userService/internal/tenant"
+	"userService/internal/user"
+)
+
+var (
+	connect    sync.Once
+	connectErr error
+)
+
+// Tenant connects to the test database and returns a context for a tenant of its own, so that
+// tests do not see each other's data.
+func Tenant(t testing.TB) context.Context {
+	t.Helper()
+
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+
+	connect.Do(func() {
+		connectErr = user.ConnectToMongo(context.Background(), config.Mongo{
+			URL:                    uri,
+			ServerSelectionTimeout: 5 * time.Second,
+			OperationTimeout:       10 * time.Second,
+			ConnectTimeout:         10 * time.Second,
+		})
+	})
+	if connectErr != nil {
+		t.Fatalf("connect to test database: %v", connectErr)
+	}
+
+	return tenant.WithTenant(context.Background(), "test-"+primitive.NewObjectID().Hex())
+}
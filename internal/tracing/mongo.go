@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+)
+
+// CommandMonitor starts a client span for every Mongo command as a child of the span in the
+// operation's context and forwards all events to next, since the driver accepts one monitor.
+// Command bodies are not recorded because they contain user data.
+func CommandMonitor(next *event.CommandMonitor) *event.CommandMonitor {
+	var spans sync.Map
+
+	end := func(requestId int64, failure string) {
+		value, ok := spans.LoadAndDelete(requestId)
+		if !ok {
+			return
+		}
+
+		span := value.(trace.Span)
+		if failure != "" {
+			span.SetStatus(codes.Error, failure)
+		}
+		span.End()
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			collection := ""
+			if value, err := e.Command.IndexErr(0); err == nil {
+				collection, _ = value.Value().StringValueOK()
+			}
+
+			name := e.CommandName
+			if collection != "" {
+				name += " " + collection
+			}
+
+			_, span := Tracer().Start(ctx, name,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					semconv.DBSystemMongoDB,
+					semconv.DBNamespace(e.DatabaseName),
+					semconv.DBOperationName(e.CommandName),
+					semconv.DBCollectionName(collection),
+				),
+			)
+			spans.Store(e.RequestID, span)
+
+			if next != nil && next.Started != nil {
+				next.Started(ctx, e)
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			end(e.RequestID, "")
+
+			if next != nil && next.Succeeded != nil {
+				next.Succeeded(ctx, e)
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			end(e.RequestID, e.Failure)
+
+			if next != nil && next.Failed != nil {
+				next.Failed(ctx, e)
+			}
+		},
+	}
+}
@@ -0,0 +1,108 @@
+package tracing
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"testing"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	return recorder
+}
+
+func startedEvent(t *testing.T, requestId int64, command bson.D) *event.CommandStartedEvent {
+	t.Helper()
+
+	raw, err := bson.Marshal(command)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &event.CommandStartedEvent{Command: raw, CommandName: command[0].Key, DatabaseName: "UserService", RequestID: requestId}
+}
+
+func TestCommandMonitorStartsChildSpans(t *testing.T) {
+	recorder := recordSpans(t)
+
+	var forwarded []string
+	monitor := CommandMonitor(&event.CommandMonitor{
+		Started:   func(context.Context, *event.CommandStartedEvent) { forwarded = append(forwarded, "started") },
+		Succeeded: func(context.Context, *event.CommandSucceededEvent) { forwarded = append(forwarded, "succeeded") },
+		Failed:    func(context.Context, *event.CommandFailedEvent) { forwarded = append(forwarded, "failed") },
+	})
+
+	ctx, parent := Tracer().Start(context.Background(), "GET /v1/users/{userId}")
+	monitor.Started(ctx, startedEvent(t, 1, bson.D{{Key: "find", Value: "user"}, {Key: "filter", Value: bson.M{"email": "ada@example.com"}}}))
+	monitor.Started(ctx, startedEvent(t, 2, bson.D{{Key: "insert", Value: "audit"}}))
+	monitor.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", RequestID: 1}})
+	monitor.Failed(ctx, &event.CommandFailedEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "insert", RequestID: 2}, Failure: "duplicate key"})
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("ended %d spans, want 3", len(spans))
+	}
+
+	find, insert := spans[0], spans[1]
+	if find.Name() != "find user" || insert.Name() != "insert audit" {
+		t.Errorf("span names = %q, %q", find.Name(), insert.Name())
+	}
+	for _, span := range []sdktrace.ReadOnlySpan{find, insert} {
+		if span.SpanKind() != trace.SpanKindClient {
+			t.Errorf("%s kind = %v, want client", span.Name(), span.SpanKind())
+		}
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() || span.SpanContext().TraceID() != parent.SpanContext().TraceID() {
+			t.Errorf("%s is not a child of the request span", span.Name())
+		}
+		for _, attribute := range span.Attributes() {
+			if attribute.Value.Emit() == "ada@example.com" {
+				t.Errorf("%s records the command body", span.Name())
+			}
+		}
+	}
+	if find.Status().Code != codes.Unset {
+		t.Errorf("find status = %v", find.Status())
+	}
+	if insert.Status().Code != codes.Error || insert.Status().Description != "duplicate key" {
+		t.Errorf("insert status = %v, want the failure", insert.Status())
+	}
+
+	attributes := map[string]string{}
+	for _, attribute := range find.Attributes() {
+		attributes[string(attribute.Key)] = attribute.Value.Emit()
+	}
+	for key, want := range map[string]string{"db.system": "mongodb", "db.namespace": "UserService", "db.operation.name": "find", "db.collection.name": "user"} {
+		if attributes[key] != want {
+			t.Errorf("%s = %q, want %q", key, attributes[key], want)
+		}
+	}
+
+	if want := []string{"started", "started", "succeeded", "failed"}; len(forwarded) != len(want) {
+		t.Errorf("forwarded %v, want %v", forwarded, want)
+	}
+}
+
+func TestCommandMonitorIgnoresUnknownRequests(t *testing.T) {
+	recorder := recordSpans(t)
+	monitor := CommandMonitor(nil)
+
+	monitor.Succeeded(context.Background(), &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{RequestID: 7}})
+	monitor.Failed(context.Background(), &event.CommandFailedEvent{CommandFinishedEvent: event.CommandFinishedEvent{RequestID: 8}})
+
+	if spans := recorder.Ended(); len(spans) != 0 {
+		t.Errorf("ended %d spans for commands that never started", len(spans))
+	}
+}
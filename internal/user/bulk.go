@@ -0,0 +1,144 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"userService/internal/audit"
+	"userService/internal/events"
+	"userService/internal/metrics"
+	"userService/internal/tenant"
+)
+
+// InsertUsers writes users with unordered bulk writes, so a bad document does not stop the
+// rest. Ids are assigned in place. The returned map holds the error for each index that was not
+// inserted; ids reserved for those are not reused.
+func InsertUsers(ctx context.Context, users []Data) (map[int]error, error) {
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tenantId, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, tenant.ErrMissingTenant
+	}
+
+	firstId, err := reserveUserIds(ctx, tenantId, int64(len(users)))
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]mongo.WriteModel, len(users))
+	for i := range users {
+		users[i].UserId = firstId + int64(i)
+		users[i].TenantId = tenantId
+		users[i].DeletedAt, users[i].ErasedAt = nil, nil
+		users[i].Version = 1
+		stored, err := encrypt(ctx, users[i])
+		if err != nil {
+			return nil, err
+		}
+		models[i] = mongo.NewInsertOneModel().SetDocument(stored)
+	}
+
+	failures := map[int]error{}
+	pending := make([]int, len(users))
+	for i := range pending {
+		pending[i] = i
+	}
+
+	// With the outbox the write is a transaction, which the first failed insert aborts as a
+	// whole. The failed users are then taken out and the others written again.
+	for len(pending) > 0 {
+		err := write(ctx, func(ctx context.Context) ([]events.Event, error) {
+			batch := make([]mongo.WriteModel, len(pending))
+			created := make([]events.Event, len(pending))
+			for j, i := range pending {
+				batch[j] = models[i]
+				created[j] = userEvent(events.UserCreated, users[i])
+			}
+
+			_, err := collection.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false))
+			return created, err
+		})
+
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil || len(bulkErr.WriteErrors) == 0 {
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+
+		failed := map[int]bool{}
+		for _, writeErr := range bulkErr.WriteErrors {
+			failures[pending[writeErr.Index]] = writeErr
+			failed[writeErr.Index] = true
+		}
+		if !events.Outbox {
+			break
+		}
+
+		var remaining []int
+		for j, i := range pending {
+			if !failed[j] {
+				remaining = append(remaining, i)
+			}
+		}
+		pending = remaining
+	}
+
+	metrics.UsersCreated.Add(float64(len(users) - len(failures)))
+
+	audited := make([]audit.Event, 0, len(users))
+	for i := range users {
+		if _, failed := failures[i]; !failed {
+			audited = append(audited, audit.Event{Action: audit.ActionCreate, UserId: users[i].UserId, Changes: diff(Data{}, users[i])})
+		}
+	}
+	record(ctx, audited...)
+
+	return failures, nil
+}
+
+// ExistingEmails returns which of the given emails already belong to a user in the tenant.
+// Soft deleted users count, since they keep their email until they are purged.
+func ExistingEmails(ctx context.Context, emails []string) (map[string]bool, error) {
+	existing := map[string]bool{}
+	if len(emails) == 0 {
+		return existing, nil
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter, err := encryptionScope(ctx, bson.M{"email": bson.M{"$in": emails}})
+	if err != nil {
+		return nil, err
+	}
+
+	projection := bson.M{"email": 1, "tenantId": 1, "userId": 1}
+	cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var found Data
+		if err := cursor.Decode(&found); err != nil {
+			return nil, err
+		}
+		if err := decrypt(ctx, &found); err != nil {
+			return nil, err
+		}
+		existing[found.Email] = true
+	}
+
+	return existing, cursor.Err()
+}
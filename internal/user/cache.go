@@ -0,0 +1,135 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/sync/singleflight"
+	"log/slog"
+	"strconv"
+	"time"
+	"userService/internal/cache"
+	"userService/internal/events"
+	"userService/internal/logging"
+	"userService/internal/metrics"
+	"userService/internal/tenant"
+)
+
+var (
+	userCache   cache.Cache
+	cacheTTL    time.Duration
+	negativeTTL time.Duration
+	// loads makes concurrent misses on the same user share one query.
+	loads singleflight.Group
+)
+
+// UseCache puts c in front of GetUser. Users are kept for ttl and ids that do not exist for
+// negative, or not at all when it is zero. Entries hold the stored document, so encrypted
+// fields stay encrypted in the cache.
+func UseCache(c cache.Cache, ttl, negative time.Duration) {
+	userCache, cacheTTL, negativeTTL = c, ttl, negative
+}
+
+func cacheKey(tenantId string, id int64) string {
+	return "user:" + tenantId + ":" + strconv.FormatInt(id, 10)
+}
+
+// cached returns the stored user with id in the tenant of ctx from the cache, or from load on
+// a miss. Lookups that include soft deleted users bypass the cache.
+func cached(ctx context.Context, id int64, load func(ctx context.Context) (Data, error)) (Data, error) {
+	tenantId, ok := tenant.FromContext(ctx)
+	if userCache == nil || includeDeleted(ctx) || !ok {
+		return load(ctx)
+	}
+
+	key := cacheKey(tenantId, id)
+	value, found, err := userCache.Get(ctx, key)
+	switch {
+	case err != nil:
+		metrics.UserCacheLookups.WithLabelValues("error").Inc()
+		logging.FromContext(ctx).Warn("user cache read failed", slog.Any("error", err))
+	case found && len(value) == 0:
+		metrics.UserCacheLookups.WithLabelValues("negative_hit").Inc()
+		return Data{}, mongo.ErrNoDocuments
+	case found:
+		var stored Data
+		if err := bson.Unmarshal(value, &stored); err == nil {
+			metrics.UserCacheLookups.WithLabelValues("hit").Inc()
+			return stored, nil
+		}
+		fallthrough
+	default:
+		metrics.UserCacheLookups.WithLabelValues("miss").Inc()
+	}
+
+	// The query is shared, so it must not fail because the caller that started it went away.
+	result, err, _ := loads.Do(key, func() (any, error) {
+		ctx, cancel := withTimeout(context.WithoutCancel(ctx))
+		defer cancel()
+
+		stored, err := load(ctx)
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments) && negativeTTL > 0:
+			remember(ctx, key, []byte{}, negativeTTL)
+		case err == nil:
+			if value, err := bson.Marshal(stored); err == nil {
+				remember(ctx, key, value, cacheTTL)
+			}
+		}
+
+		return stored, err
+	})
+
+	return result.(Data), err
+}
+
+func remember(ctx context.Context, key string, value []byte, ttl time.Duration) {
+	if err := userCache.Set(ctx, key, value, ttl); err != nil {
+		logging.FromContext(ctx).Warn("user cache write failed", slog.Any("error", err))
+	}
+}
+
+// forget drops cached users, including ids that did not exist before, since their absence
+// may be cached.
+func forget(ctx context.Context, keys ...string) {
+	if userCache == nil || len(keys) == 0 {
+		return
+	}
+
+	if err := userCache.Delete(context.WithoutCancel(ctx), keys...); err != nil {
+		logging.FromContext(ctx).Error("user cache invalidation failed", slog.Any("error", err))
+	}
+}
+
+// RunCacheInvalidator drops cached users as change events of any replica arrive, until ctx is
+// done. Writes already invalidate the cache of the replica that made them; this covers the
+// others, and reads that raced a write and cached what it replaced.
+func RunCacheInvalidator(ctx context.Context, source events.Source) {
+	if userCache == nil {
+		return
+	}
+
+	var token string
+	for {
+		err := source.Watch(ctx, events.Filter{AllTenants: true}, token, func(event events.Event, next string) error {
+			forget(ctx, cacheKey(event.TenantId, event.UserId))
+			token = next
+			return nil
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, events.ErrInvalidResumeToken) || errors.Is(err, events.ErrResumeTokenExpired) {
+			// Changes in between are missed; their entries are only corrected by the TTL.
+			token = ""
+		}
+		slog.Warn("user cache invalidation stopped, restarting", slog.Any("error", err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
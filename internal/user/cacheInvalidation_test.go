@@ -0,0 +1,73 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"strconv"
+	"testing"
+	"time"
+	"userService/internal/cache"
+	"userService/internal/tenant"
+	"userService/internal/testdb"
+	"userService/internal/user"
+)
+
+func TestCacheInvalidatedByWrites(t *testing.T) {
+	ctx := testdb.Tenant(t)
+	lru := cache.NewLRU(100)
+	user.UseCache(lru, time.Minute, time.Minute)
+	t.Cleanup(func() { user.UseCache(nil, 0, 0) })
+
+	tenantId, _ := tenant.FromContext(ctx)
+	cached := func(id int64) bool {
+		_, found, _ := lru.Get(context.Background(), "user:"+tenantId+":"+strconv.FormatInt(id, 10))
+		return found
+	}
+
+	created, err := user.InsertUser(ctx, user.Data{Name: "Ada", Email: "ada@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := user.GetUser(ctx, created.UserId); err != nil {
+		t.Fatal(err)
+	}
+	if !cached(created.UserId) {
+		t.Fatal("GetUser did not fill the cache")
+	}
+
+	created.Name = "Ada Lovelace"
+	updated, err := user.UpdateUser(ctx, created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached(created.UserId) {
+		t.Error("UpdateUser left the old user cached")
+	}
+	if got, err := user.GetUser(ctx, created.UserId); err != nil || got.Name != "Ada Lovelace" {
+		t.Errorf("GetUser() after update = %+v, %v", got, err)
+	}
+
+	if err := user.DeleteUser(ctx, updated.UserId, updated.Version); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := user.GetUser(ctx, created.UserId); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("GetUser() after delete error = %v, want ErrNoDocuments", err)
+	}
+
+	// A user created with an id whose absence was cached is found right away.
+	missing := updated.UserId + 1
+	if _, err := user.GetUser(ctx, missing); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatalf("GetUser(%d) error = %v", missing, err)
+	}
+	next, err := user.InsertUser(ctx, user.Data{Name: "Bob", Email: "bob@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.UserId != missing {
+		t.Skipf("user ids are not sequential here: got %d", next.UserId)
+	}
+	if got, err := user.GetUser(ctx, missing); err != nil || got.Name != "Bob" {
+		t.Errorf("GetUser() of a new user = %+v, %v", got, err)
+	}
+}
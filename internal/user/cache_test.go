@@ -0,0 +1,185 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"userService/internal/cache"
+	"userService/internal/tenant"
+)
+
+func useCache(t *testing.T, negative time.Duration) *cache.LRU {
+	t.Helper()
+
+	lru := cache.NewLRU(100)
+	UseCache(lru, time.Minute, negative)
+	t.Cleanup(func() { UseCache(nil, 0, 0) })
+
+	return lru
+}
+
+// loader counts the loads of a user that cached falls back to.
+type loader struct {
+	calls atomic.Int32
+	data  Data
+	err   error
+}
+
+func (l *loader) load(context.Context) (Data, error) {
+	l.calls.Add(1)
+
+	return l.data, l.err
+}
+
+func TestCachedServesHits(t *testing.T) {
+	useCache(t, 0)
+	ctx := tenant.WithTenant(context.Background(), "tenant-a")
+	source := &loader{data: Data{UserId: 7, TenantId: "tenant-a", Name: "Ada", Version: 3}}
+
+	for range 3 {
+		got, err := cached(ctx, 7, source.load)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Name != "Ada" || got.Version != 3 {
+			t.Errorf("cached() = %+v", got)
+		}
+	}
+	if source.calls.Load() != 1 {
+		t.Errorf("loaded %d times, want once", source.calls.Load())
+	}
+
+	// Reads that include deleted users always go to the database.
+	if _, err := cached(WithDeleted(ctx), 7, source.load); err != nil {
+		t.Fatal(err)
+	}
+	if source.calls.Load() != 2 {
+		t.Error("a read including deleted users was served from the cache")
+	}
+}
+
+func TestCachedRemembersMissingUsers(t *testing.T) {
+	ctx := tenant.WithTenant(context.Background(), "tenant-a")
+
+	for _, test := range []struct {
+		name     string
+		negative time.Duration
+		loads    int32
+	}{
+		{name: "negative ttl", negative: time.Minute, loads: 1},
+		{name: "no negative ttl", loads: 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useCache(t, test.negative)
+			source := &loader{err: mongo.ErrNoDocuments}
+
+			for range 2 {
+				if _, err := cached(ctx, 7, source.load); !errors.Is(err, mongo.ErrNoDocuments) {
+					t.Fatalf("cached() error = %v, want ErrNoDocuments", err)
+				}
+			}
+			if source.calls.Load() != test.loads {
+				t.Errorf("loaded %d times, want %d", source.calls.Load(), test.loads)
+			}
+		})
+	}
+}
+
+func TestCachedDoesNotRememberErrors(t *testing.T) {
+	useCache(t, time.Minute)
+	ctx := tenant.WithTenant(context.Background(), "tenant-a")
+	source := &loader{err: errors.New("connection reset")}
+
+	for range 2 {
+		if _, err := cached(ctx, 7, source.load); err == nil {
+			t.Fatal("cached() hid the load error")
+		}
+	}
+	if source.calls.Load() != 2 {
+		t.Errorf("loaded %d times, want a failed load retried", source.calls.Load())
+	}
+}
+
+func TestCachedKeepsTenantsApart(t *testing.T) {
+	lru := useCache(t, 0)
+	first := tenant.WithTenant(context.Background(), "tenant-a")
+	second := tenant.WithTenant(context.Background(), "tenant-b")
+
+	a := &loader{data: Data{UserId: 7, TenantId: "tenant-a", Name: "Ada"}}
+	b := &loader{data: Data{UserId: 7, TenantId: "tenant-b", Name: "Bob"}}
+	for range 2 {
+		if got, _ := cached(first, 7, a.load); got.Name != "Ada" {
+			t.Errorf("tenant-a user 7 = %q", got.Name)
+		}
+		if got, _ := cached(second, 7, b.load); got.Name != "Bob" {
+			t.Errorf("tenant-b user 7 = %q", got.Name)
+		}
+	}
+	if a.calls.Load() != 1 || b.calls.Load() != 1 {
+		t.Errorf("loads = %d, %d, want one per tenant", a.calls.Load(), b.calls.Load())
+	}
+
+	// Forgetting the user of one tenant leaves the other cached.
+	forget(first, cacheKey("tenant-a", 7))
+	if _, found, _ := lru.Get(context.Background(), cacheKey("tenant-b", 7)); !found {
+		t.Error("forgetting tenant-a's user dropped tenant-b's")
+	}
+	if _, err := cached(first, 7, a.load); err != nil || a.calls.Load() != 2 {
+		t.Errorf("tenant-a user 7 was not reloaded after forget: %v", err)
+	}
+}
+
+func TestCachedCoalescesMisses(t *testing.T) {
+	useCache(t, 0)
+	ctx := tenant.WithTenant(context.Background(), "tenant-a")
+
+	release := make(chan struct{})
+	var calls atomic.Int32
+	load := func(context.Context) (Data, error) {
+		calls.Add(1)
+		<-release
+		return Data{UserId: 7, TenantId: "tenant-a", Name: "Ada"}, nil
+	}
+
+	const readers = 10
+	var started, done sync.WaitGroup
+	started.Add(readers)
+	done.Add(readers)
+	for range readers {
+		go func() {
+			defer done.Done()
+			started.Done()
+			if got, err := cached(ctx, 7, load); err != nil || got.Name != "Ada" {
+				t.Errorf("cached() = %+v, %v", got, err)
+			}
+		}()
+	}
+	started.Wait()
+	// Let the readers reach the shared load before it returns.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	done.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("loaded %d times for %d concurrent misses, want once", calls.Load(), readers)
+	}
+}
+
+func TestCachedSurvivesCallerCancellation(t *testing.T) {
+	useCache(t, 0)
+	ctx, cancel := context.WithCancel(tenant.WithTenant(context.Background(), "tenant-a"))
+	cancel()
+
+	var loadErr error
+	_, _ = cached(ctx, 7, func(ctx context.Context) (Data, error) {
+		loadErr = ctx.Err()
+		return Data{UserId: 7}, nil
+	})
+	if loadErr != nil {
+		t.Errorf("the shared load ran with a cancelled context: %v", loadErr)
+	}
+}
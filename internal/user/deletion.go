@@ -0,0 +1,233 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log/slog"
+	"time"
+	"userService/internal/audit"
+	"userService/internal/events"
+	"userService/internal/tenant"
+)
+
+type includeDeletedKey struct{}
+
+var notDeleted = bson.M{"deletedAt": bson.M{"$exists": false}}
+
+// WithDeleted makes the lookups in this package return soft deleted users as well. It is meant
+// for admin tooling; everything else should never see deleted users.
+func WithDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, includeDeletedKey{}, true)
+}
+
+func includeDeleted(ctx context.Context) bool {
+	include, _ := ctx.Value(includeDeletedKey{}).(bool)
+
+	return include
+}
+
+// scope is tenant.Scope for the user collection, leaving out soft deleted users unless ctx asks
+// for them and rewriting conditions on encrypted fields.
+func scope(ctx context.Context, filter bson.M) (bson.M, error) {
+	if !includeDeleted(ctx) {
+		if len(filter) == 0 {
+			filter = notDeleted
+		} else {
+			filter = bson.M{"$and": []bson.M{filter, notDeleted}}
+		}
+	}
+
+	return encryptionScope(ctx, filter)
+}
+
+// DeletedIds returns which of ids belong to soft deleted or erased users of the tenant in ctx.
+func DeletedIds(ctx context.Context, ids []int64) (map[int64]bool, error) {
+	deleted := map[int64]bool{}
+	if len(ids) == 0 {
+		return deleted, nil
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter, err := tenant.Scope(ctx, bson.M{"userId": bson.M{"$in": ids}, "deletedAt": bson.M{"$exists": true}})
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"userId": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var found []Data
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	for _, data := range found {
+		deleted[data.UserId] = true
+	}
+
+	return deleted, nil
+}
+
+// RestoreUser undoes a soft delete. It returns mongo.ErrNoDocuments when the user does not
+// exist, is not deleted, or has already been purged or erased.
+func RestoreUser(ctx context.Context, id int64) (Data, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter, err := tenant.Scope(ctx, bson.M{"userId": id, "deletedAt": bson.M{"$exists": true}, "erasedAt": bson.M{"$exists": false}})
+	if err != nil {
+		return Data{}, err
+	}
+
+	var deleted, restored Data
+	err = write(ctx, func(ctx context.Context) ([]events.Event, error) {
+		deleted = Data{}
+		update := bson.M{"$unset": bson.M{"deletedAt": ""}, "$inc": nextVersion}
+		if err := collection.FindOneAndUpdate(ctx, filter, update).Decode(&deleted); err != nil {
+			return nil, err
+		}
+		if err := decrypt(ctx, &deleted); err != nil {
+			return nil, err
+		}
+
+		restored = deleted
+		restored.DeletedAt = nil
+		restored.Version++
+
+		return []events.Event{userEvent(events.UserUpdated, restored, changedFields(deleted, restored)...)}, nil
+	})
+	if err != nil {
+		return Data{}, err
+	}
+	record(ctx, audit.Event{Action: audit.ActionRestore, UserId: id, Changes: diff(deleted, restored)})
+
+	return restored, nil
+}
+
+// purgeBatch is how many users PurgeDeleted removes per database timeout.
+const purgeBatch = 100
+
+// PurgeDeleted hard deletes users of every tenant that were soft deleted before cutoff, along
+// with their identities, and returns how many users were removed. also runs first for each user,
+// with ctx scoped to its tenant, to remove what other packages keep about it, such as group
+// memberships. Erased tombstones are kept so that audit events keep pointing at a user.
+func PurgeDeleted(ctx context.Context, cutoff time.Time, also func(ctx context.Context, deleted Data) error) (int64, error) {
+	var purged int64
+	for {
+		batch, more, err := purgeDeletedBatch(ctx, cutoff, also)
+		purged += batch
+		if err != nil || !more {
+			return purged, err
+		}
+	}
+}
+
+// purgeDeletedBatch purges up to purgeBatch users within one timeout and reports whether there
+// may be more. Purged users no longer match, so every batch starts with the oldest remaining.
+func purgeDeletedBatch(ctx context.Context, cutoff time.Time, also func(ctx context.Context, deleted Data) error) (int64, bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"deletedAt": bson.M{"$lt": cutoff}, "erasedAt": bson.M{"$exists": false}}
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.M{"deletedAt": 1}).SetLimit(purgeBatch))
+	if err != nil {
+		return 0, false, err
+	}
+	var batch []Data
+	if err := cursor.All(ctx, &batch); err != nil {
+		return 0, false, err
+	}
+
+	var purged int64
+	for _, deleted := range batch {
+		if also != nil {
+			if err := also(tenant.WithTenant(ctx, deleted.TenantId), deleted); err != nil {
+				return purged, false, err
+			}
+		}
+
+		owner := bson.M{"tenantId": deleted.TenantId, "userId": deleted.UserId}
+		if _, err := identities.DeleteMany(ctx, owner); err != nil {
+			return purged, false, err
+		}
+
+		owner["deletedAt"], owner["erasedAt"] = filter["deletedAt"], filter["erasedAt"]
+		result, err := collection.DeleteOne(ctx, owner)
+		if err != nil {
+			return purged, false, err
+		}
+		purged += result.DeletedCount
+		if result.DeletedCount > 0 {
+			record(ctx, audit.Event{TenantId: deleted.TenantId, Action: audit.ActionPurge, UserId: deleted.UserId})
+		}
+	}
+
+	return purged, len(batch) == purgeBatch, nil
+}
+
+// RunPurger calls PurgeDeleted with also every interval for users deleted longer than retention
+// ago, until ctx is done. Running it on several replicas at once is harmless.
+func RunPurger(ctx context.Context, retention, interval time.Duration, also func(ctx context.Context, deleted Data) error) {
+	ctx = audit.WithActor(ctx, audit.ActorSystem)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := PurgeDeleted(ctx, time.Now().UTC().Add(-retention), also)
+		switch {
+		case err != nil && !errors.Is(err, context.Canceled):
+			slog.Error("purge deleted users failed", slog.Any("error", err))
+		case purged > 0:
+			slog.Info("purged deleted users", slog.Int64("users", purged))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// EraseUser removes the personal data of a user, deleted or not. The document is reduced to a
+// tombstone with its id and tenant, and its identities are deleted.
+func EraseUser(ctx context.Context, id int64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter, err := tenant.Scope(ctx, bson.M{"userId": id})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	update := bson.A{bson.M{"$set": bson.M{
+		"name":      "",
+		"disabled":  true,
+		"deletedAt": bson.M{"$ifNull": bson.A{"$deletedAt", now}},
+		"erasedAt":  now,
+		"version":   bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$version", 0}}, 1}},
+	}}, bson.M{"$unset": bson.A{"email", "externalId", "roles", "nameIndex", "emailIndex", "externalIdIndex"}}}
+
+	err = write(ctx, func(ctx context.Context) ([]events.Event, error) {
+		var erased Data
+		if err := collection.FindOneAndUpdate(ctx, filter, update, returnVersion).Decode(&erased); err != nil {
+			return nil, err
+		}
+		if _, err := identities.DeleteMany(ctx, filter); err != nil {
+			return nil, err
+		}
+
+		return []events.Event{userEvent(events.UserDeleted, erased)}, nil
+	})
+	if err != nil {
+		return err
+	}
+	record(ctx, audit.Event{Action: audit.ActionErase, UserId: id})
+
+	return nil
+}
@@ -0,0 +1,420 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+	"strconv"
+	"strings"
+	"userService/internal/encryption"
+	"userService/internal/tenant"
+)
+
+var ErrEncryptedFilter = errors.New("only equality filters are supported on encrypted fields")
+
+// encryptedField describes a field of Data that can be encrypted at rest, with the blind index
+// stored next to it for equality lookups.
+type encryptedField struct {
+	value     func(*Data) *string
+	index     func(*Data) *string
+	indexName string
+	normalize func(string) string
+}
+
+var encryptable = map[string]encryptedField{
+	"name": {
+		value:     func(d *Data) *string { return &d.Name },
+		index:     func(d *Data) *string { return &d.NameIndex },
+		indexName: "nameIndex",
+		normalize: strings.ToLower,
+	},
+	"email": {
+		value:     func(d *Data) *string { return &d.Email },
+		index:     func(d *Data) *string { return &d.EmailIndex },
+		indexName: "emailIndex",
+		normalize: strings.ToLower,
+	},
+	"externalId": {
+		value:     func(d *Data) *string { return &d.ExternalId },
+		index:     func(d *Data) *string { return &d.ExternalIdIndex },
+		indexName: "externalIdIndex",
+		normalize: func(value string) string { return value },
+	},
+}
+
+var fieldCipher *encryption.Cipher
+var encryptedFields = map[string]bool{}
+
+// UseEncryption encrypts the given fields of new and updated users from now on. Existing plain
+// values stay readable until RotateEncryption rewrites them.
+func UseEncryption(cipher *encryption.Cipher, fields []string) error {
+	enabled := map[string]bool{}
+	for _, field := range fields {
+		if _, ok := encryptable[field]; !ok {
+			return fmt.Errorf("field %q cannot be encrypted", field)
+		}
+		enabled[field] = true
+	}
+
+	fieldCipher = cipher
+	encryptedFields = enabled
+
+	return nil
+}
+
+func binding(tenantId string, userId int64, field string) string {
+	return tenantId + "/" + strconv.FormatInt(userId, 10) + "/" + field
+}
+
+// encrypt returns the stored form of data with the enabled fields encrypted and indexed.
+func encrypt(ctx context.Context, data Data) (Data, error) {
+	for name, field := range encryptable {
+		plain := *field.value(&data)
+		*field.index(&data) = ""
+		if !encryptedFields[name] || plain == "" {
+			continue
+		}
+
+		index, err := blindIndex(ctx, field, plain)
+		if err != nil {
+			return Data{}, err
+		}
+		sealed, err := fieldCipher.Encrypt(ctx, plain, binding(data.TenantId, data.UserId, name))
+		if err != nil {
+			return Data{}, err
+		}
+
+		*field.value(&data), *field.index(&data) = sealed, index
+	}
+
+	return data, nil
+}
+
+// decrypt turns a stored user back into plain values. Plain values are left alone, so it also
+// works for users written before encryption was enabled.
+func decrypt(ctx context.Context, data *Data) error {
+	for name, field := range encryptable {
+		*field.index(data) = ""
+
+		value := field.value(data)
+		if !encryption.IsEncrypted(*value) {
+			continue
+		}
+		if fieldCipher == nil {
+			return fmt.Errorf("user %d has an encrypted %s but no keyring is configured", data.UserId, name)
+		}
+
+		plain, err := fieldCipher.Decrypt(ctx, *value, binding(data.TenantId, data.UserId, name))
+		if err != nil {
+			return fmt.Errorf("decrypt %s of user %d: %w", name, data.UserId, err)
+		}
+		*value = plain
+	}
+
+	return nil
+}
+
+func decryptAll(ctx context.Context, users []Data) error {
+	for i := range users {
+		if err := decrypt(ctx, &users[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encryptedUpdate is the $set and $unset for writing the given plain values of encrypted fields.
+func encryptedUpdate(ctx context.Context, data Data, set, unset bson.M) error {
+	stored, err := encrypt(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	for name, field := range encryptable {
+		set[name] = *field.value(&stored)
+		if index := *field.index(&stored); index != "" {
+			set[field.indexName] = index
+		} else {
+			unset[field.indexName] = ""
+		}
+	}
+
+	return nil
+}
+
+// encryptFilter rewrites conditions on encrypted fields into conditions on their blind indexes.
+// Only exact matches can be rewritten; anything else fails with ErrEncryptedFilter. Users that
+// RotateEncryption has not reached yet have no index, so for them the plain condition is kept.
+func encryptFilter(ctx context.Context, filter bson.M) (bson.M, error) {
+	if len(encryptedFields) == 0 {
+		return filter, nil
+	}
+
+	result := bson.M{}
+	var encrypted []bson.M
+	for key, value := range filter {
+		switch {
+		case key == "$and" || key == "$or" || key == "$nor":
+			clauses, err := encryptClauses(ctx, value)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = clauses
+		case encryptedFields[key]:
+			condition, err := encryptCondition(ctx, encryptable[key], value)
+			if err != nil {
+				return nil, err
+			}
+			index := encryptable[key].indexName
+			encrypted = append(encrypted, bson.M{"$or": []bson.M{
+				{"$and": []bson.M{{index: bson.M{"$exists": true}}, {index: condition}}},
+				{index: bson.M{"$exists": false}, key: value},
+			}})
+		default:
+			result[key] = value
+		}
+	}
+
+	if len(encrypted) > 0 {
+		if clauses, ok := result["$and"].([]bson.M); ok {
+			encrypted = append(clauses, encrypted...)
+		}
+		result["$and"] = encrypted
+	}
+
+	return result, nil
+}
+
+func encryptClauses(ctx context.Context, value any) ([]bson.M, error) {
+	var clauses []bson.M
+	switch typed := value.(type) {
+	case []bson.M:
+		clauses = typed
+	case bson.A:
+		for _, clause := range typed {
+			m, ok := clause.(bson.M)
+			if !ok {
+				return nil, ErrEncryptedFilter
+			}
+			clauses = append(clauses, m)
+		}
+	default:
+		return nil, ErrEncryptedFilter
+	}
+
+	result := make([]bson.M, len(clauses))
+	for i, clause := range clauses {
+		rewritten, err := encryptFilter(ctx, clause)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = rewritten
+	}
+
+	return result, nil
+}
+
+func encryptCondition(ctx context.Context, field encryptedField, value any) (any, error) {
+	switch typed := value.(type) {
+	case string:
+		return blindIndex(ctx, field, typed)
+	case primitive.Regex:
+		if text, ok := exactPattern(typed.Pattern); ok {
+			return blindIndex(ctx, field, text)
+		}
+	case bson.M:
+		result := bson.M{}
+		for operator, operand := range typed {
+			switch operator {
+			case "$exists":
+				result[operator] = operand
+			case "$eq", "$ne":
+				text, ok := operand.(string)
+				if !ok {
+					return nil, ErrEncryptedFilter
+				}
+				index, err := blindIndex(ctx, field, text)
+				if err != nil {
+					return nil, err
+				}
+				result[operator] = index
+			case "$in", "$nin":
+				indexes, err := blindIndexes(ctx, field, operand)
+				if err != nil {
+					return nil, err
+				}
+				result[operator] = indexes
+			default:
+				return nil, ErrEncryptedFilter
+			}
+		}
+		return result, nil
+	}
+
+	return nil, ErrEncryptedFilter
+}
+
+func blindIndex(ctx context.Context, field encryptedField, text string) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+
+	// The index name keeps equal values of different fields from having equal indexes.
+	return fieldCipher.BlindIndex(ctx, field.indexName+":"+field.normalize(text))
+}
+
+// blindIndexes maps a list of values to their indexes; empty values and nil are kept since
+// they match the same documents either way.
+func blindIndexes(ctx context.Context, field encryptedField, operand any) (bson.A, error) {
+	var values []any
+	switch typed := operand.(type) {
+	case []string:
+		for _, value := range typed {
+			values = append(values, value)
+		}
+	case bson.A:
+		values = typed
+	case []any:
+		values = typed
+	default:
+		return nil, ErrEncryptedFilter
+	}
+
+	result := bson.A{}
+	for _, value := range values {
+		switch typed := value.(type) {
+		case nil:
+			result = append(result, nil)
+		case string:
+			index, err := blindIndex(ctx, field, typed)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, index)
+		default:
+			return nil, ErrEncryptedFilter
+		}
+	}
+
+	return result, nil
+}
+
+// exactPattern recognizes the anchored, fully quoted patterns used for case-insensitive equality,
+// such as SCIM's eq operator, and returns the text they match.
+func exactPattern(pattern string) (string, bool) {
+	if len(pattern) < 2 || pattern[0] != '^' || pattern[len(pattern)-1] != '$' {
+		return "", false
+	}
+
+	quoted := pattern[1 : len(pattern)-1]
+	var text strings.Builder
+	for i := 0; i < len(quoted); i++ {
+		if quoted[i] == '\\' && i+1 < len(quoted) {
+			i++
+		}
+		text.WriteByte(quoted[i])
+	}
+
+	if regexp.QuoteMeta(text.String()) != quoted {
+		return "", false
+	}
+
+	return text.String(), true
+}
+
+// RotateEncryption rewrites the users of every tenant whose fields are not encrypted the way the
+// current configuration asks: plain values of encrypted fields, values under an old key, and
+// encrypted values of fields that are no longer encrypted. It returns how many users changed.
+func RotateEncryption(ctx context.Context) (int64, error) {
+	var currentKey string
+	if fieldCipher != nil {
+		id, err := fieldCipher.CurrentKeyId(ctx)
+		if err != nil {
+			return 0, err
+		}
+		currentKey = id
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetBatchSize(500))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(context.Background())
+
+	var rotated int64
+	for cursor.Next(ctx) {
+		var stored Data
+		if err := cursor.Decode(&stored); err != nil {
+			return rotated, err
+		}
+		if !needsRotation(stored, currentKey) {
+			continue
+		}
+
+		plain := stored
+		if err := decrypt(ctx, &plain); err != nil {
+			return rotated, err
+		}
+
+		set, unset := bson.M{}, bson.M{}
+		if err := encryptedUpdate(ctx, plain, set, unset); err != nil {
+			return rotated, err
+		}
+
+		// Matching the old values skips users changed since they were read; the next run picks
+		// them up if they still need it.
+		filter := bson.M{"tenantId": stored.TenantId, "userId": stored.UserId}
+		for name, field := range encryptable {
+			filter[name] = *field.value(&stored)
+			if *field.value(&stored) == "" {
+				filter[name] = bson.M{"$in": bson.A{"", nil}}
+			}
+		}
+
+		update := bson.M{"$set": set, "$inc": nextVersion}
+		if len(unset) > 0 {
+			update["$unset"] = unset
+		}
+		result, err := collection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return rotated, err
+		}
+		if result.ModifiedCount > 0 {
+			forget(ctx, cacheKey(stored.TenantId, stored.UserId))
+		}
+		rotated += result.ModifiedCount
+	}
+
+	return rotated, cursor.Err()
+}
+
+func needsRotation(stored Data, currentKey string) bool {
+	for name, field := range encryptable {
+		value := *field.value(&stored)
+		if value == "" {
+			continue
+		}
+
+		keyId := encryption.KeyId(value)
+		if (encryptedFields[name] && keyId != currentKey) || (!encryptedFields[name] && keyId != "") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// encryptionScope is tenant.Scope with conditions on encrypted fields rewritten.
+func encryptionScope(ctx context.Context, filter bson.M) (bson.M, error) {
+	filter, err := encryptFilter(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return tenant.Scope(ctx, filter)
+}
@@ -0,0 +1,157 @@
+package user
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"userService/internal/encryption"
+)
+
+func useEncryption(t *testing.T, fields ...string) {
+	t.Helper()
+
+	key := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	content := `{"current":"k1","keys":{"k1":"` + key + `"},"indexKey":"` + key + `"}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keyring, err := encryption.LoadKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := UseEncryption(encryption.NewCipher(keyring), fields); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		fieldCipher, encryptedFields = nil, map[string]bool{}
+	})
+}
+
+// either matches the blind index of users that have one and the plain field of the others.
+func either(field, index string, indexed, plain any) bson.M {
+	return bson.M{"$or": []bson.M{
+		{"$and": []bson.M{{index: bson.M{"$exists": true}}, {index: indexed}}},
+		{index: bson.M{"$exists": false}, field: plain},
+	}}
+}
+
+func TestEncryptFilter(t *testing.T) {
+	ctx := context.Background()
+	useEncryption(t, "email", "externalId")
+
+	ada, err := blindIndex(ctx, encryptable["email"], "Ada@Example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	external, err := blindIndex(ctx, encryptable["externalId"], "ext-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exact := primitive.Regex{Pattern: "^ada@example\\.com$", Options: "i"}
+
+	tests := []struct {
+		name    string
+		filter  bson.M
+		want    bson.M
+		wantErr bool
+	}{
+		{
+			name:   "plain fields are kept",
+			filter: bson.M{"name": "Ada", "userId": int64(1)},
+			want:   bson.M{"name": "Ada", "userId": int64(1)},
+		},
+		{
+			name:   "equality",
+			filter: bson.M{"email": "Ada@Example.com", "name": "Ada"},
+			want:   bson.M{"name": "Ada", "$and": []bson.M{either("email", "emailIndex", ada, "Ada@Example.com")}},
+		},
+		{
+			name:   "exact pattern",
+			filter: bson.M{"email": exact},
+			want:   bson.M{"$and": []bson.M{either("email", "emailIndex", ada, exact)}},
+		},
+		{
+			name:   "operators",
+			filter: bson.M{"email": bson.M{"$ne": "ada@example.com"}},
+			want:   bson.M{"$and": []bson.M{either("email", "emailIndex", bson.M{"$ne": ada}, bson.M{"$ne": "ada@example.com"})}},
+		},
+		{
+			name:   "lists keep empty values",
+			filter: bson.M{"email": bson.M{"$in": []string{"ada@example.com", ""}}},
+			want:   bson.M{"$and": []bson.M{either("email", "emailIndex", bson.M{"$in": bson.A{ada, ""}}, bson.M{"$in": []string{"ada@example.com", ""}})}},
+		},
+		{
+			name:   "nested clauses",
+			filter: bson.M{"$or": bson.A{bson.M{"externalId": "ext-1"}, bson.M{"name": "Ada"}}},
+			want: bson.M{"$or": []bson.M{
+				{"$and": []bson.M{either("externalId", "externalIdIndex", external, "ext-1")}},
+				{"name": "Ada"},
+			}},
+		},
+		{
+			name:   "joins an existing and",
+			filter: bson.M{"$and": []bson.M{{"name": "Ada"}}, "email": "ada@example.com"},
+			want: bson.M{"$and": []bson.M{
+				{"name": "Ada"},
+				either("email", "emailIndex", ada, "ada@example.com"),
+			}},
+		},
+		{name: "range", filter: bson.M{"email": bson.M{"$gt": "a"}}, wantErr: true},
+		{name: "substring", filter: bson.M{"email": primitive.Regex{Pattern: "ada", Options: "i"}}, wantErr: true},
+		{name: "non string", filter: bson.M{"externalId": 5}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := encryptFilter(ctx, test.filter)
+			if test.wantErr {
+				if !errors.Is(err, ErrEncryptedFilter) {
+					t.Fatalf("error %v, want %v", err, ErrEncryptedFilter)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	useEncryption(t, "email")
+
+	data := Data{TenantId: "tenant-a", UserId: 7, Name: "Ada", Email: "ada@example.com"}
+	stored, err := encrypt(ctx, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !encryption.IsEncrypted(stored.Email) || stored.EmailIndex == "" || stored.Name != "Ada" || stored.NameIndex != "" {
+		t.Fatalf("stored %+v", stored)
+	}
+
+	moved := stored
+	moved.UserId = 8
+	if err := decrypt(ctx, &moved); err == nil {
+		t.Error("an email copied to another user decrypted")
+	}
+
+	if err := decrypt(ctx, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stored, data) {
+		t.Errorf("got %+v, want %+v", stored, data)
+	}
+}
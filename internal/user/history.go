@@ -0,0 +1,65 @@
+package user
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"slices"
+	"userService/internal/audit"
+	"userService/internal/logging"
+)
+
+// record writes audit events for changes that have already been made. A failure is logged
+// rather than returned, since the caller cannot undo the change anyway.
+func record(ctx context.Context, events ...audit.Event) {
+	if err := audit.Record(ctx, events...); err != nil {
+		logging.FromContext(ctx).Error("audit record failed", slog.Int("events", len(events)), slog.Any("error", err))
+	}
+}
+
+func auditFields(data Data) map[string]any {
+	fields := map[string]any{
+		"name":       data.Name,
+		"email":      data.Email,
+		"externalId": data.ExternalId,
+		"disabled":   data.Disabled,
+		"roles":      data.Roles,
+		"deletedAt":  data.DeletedAt,
+	}
+
+	for name, value := range fields {
+		if reflect.ValueOf(value).IsZero() || (name == "roles" && len(data.Roles) == 0) {
+			fields[name] = nil
+		}
+	}
+
+	return fields
+}
+
+// diff lists the fields that differ between two versions of a user. Personal fields are only
+// named, without their values, so the audit trail does not keep a copy of personal data.
+func diff(before, after Data) map[string]audit.Change {
+	old, current := auditFields(before), auditFields(after)
+
+	changes := map[string]audit.Change{}
+	for name := range current {
+		if reflect.DeepEqual(old[name], current[name]) {
+			continue
+		}
+		if slices.Contains(audit.PersonalFields, name) {
+			changes[name] = audit.Change{}
+			continue
+		}
+		changes[name] = audit.Change{Before: old[name], After: current[name]}
+	}
+
+	return changes
+}
+
+func updateAction(changes map[string]audit.Change) string {
+	if _, ok := changes["roles"]; ok && len(changes) == 1 {
+		return audit.ActionRoleChange
+	}
+
+	return audit.ActionUpdate
+}
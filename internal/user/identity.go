@@ -0,0 +1,78 @@
+package user
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+	"userService/internal/tenant"
+)
+
+type Identity struct {
+	Issuer      string    `json:"issuer" bson:"issuer"`
+	Subject     string    `json:"subject" bson:"subject"`
+	UserId      int64     `json:"userId" bson:"userId"`
+	TenantId    string    `json:"tenantId" bson:"tenantId"`
+	Email       string    `json:"email,omitempty" bson:"email,omitempty"`
+	CreatedAt   time.Time `json:"createdAt" bson:"createdAt"`
+	LastLoginAt time.Time `json:"lastLoginAt" bson:"lastLoginAt"`
+}
+
+func FindIdentity(ctx context.Context, issuer, subject string) (Identity, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter, err := tenant.Scope(ctx, bson.M{"issuer": issuer, "subject": subject})
+	if err != nil {
+		return Identity{}, err
+	}
+
+	result := Identity{}
+	err = identities.FindOne(ctx, filter).Decode(&result)
+
+	return result, err
+}
+
+func LinkIdentity(ctx context.Context, identity Identity) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	now := time.Now().UTC()
+	filter, err := tenant.Scope(ctx, bson.M{"issuer": identity.Issuer, "subject": identity.Subject})
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set":         bson.M{"userId": identity.UserId, "email": identity.Email, "lastLoginAt": now},
+		"$setOnInsert": bson.M{"createdAt": now},
+	}
+
+	_, err = identities.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+
+	return err
+}
+
+func GetIdentities(ctx context.Context, userId int64) ([]Identity, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var result []Identity
+
+	filter, err := tenant.Scope(ctx, bson.M{"userId": userId})
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := identities.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
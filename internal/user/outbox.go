@@ -0,0 +1,58 @@
+package user
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/mongo"
+	"maps"
+	"slices"
+	"userService/internal/events"
+)
+
+// write runs fn and stores the events it returns in the outbox within the same transaction.
+// fn may run more than once when the transaction is retried. Without the outbox it just runs fn.
+// Either way the users of the events are dropped from the cache afterwards.
+func write(ctx context.Context, fn func(ctx context.Context) ([]events.Event, error)) error {
+	var pending []events.Event
+	defer func() {
+		keys := make([]string, len(pending))
+		for i, event := range pending {
+			keys[i] = cacheKey(event.TenantId, event.UserId)
+		}
+		forget(ctx, keys...)
+	}()
+
+	if !events.Outbox {
+		var err error
+		pending, err = fn(ctx)
+		return err
+	}
+
+	session, err := database.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(context.WithoutCancel(ctx))
+
+	_, err = session.WithTransaction(ctx, func(ctx mongo.SessionContext) (any, error) {
+		var err error
+		pending, err = fn(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, events.Add(ctx, pending...)
+	})
+
+	return err
+}
+
+// userEvent describes a change to data. Events carry no personal data, only the names of the
+// fields that changed, so consumers that need the user read it through the API.
+func userEvent(eventType string, data Data, fields ...string) events.Event {
+	return events.Event{Type: eventType, TenantId: data.TenantId, UserId: data.UserId, Version: data.Version, Fields: fields}
+}
+
+// changedFields lists the names of the fields that differ between two versions of a user.
+func changedFields(before, after Data) []string {
+	return slices.Sorted(maps.Keys(diff(before, after)))
+}
@@ -2,99 +2,532 @@ package user
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"log"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"log/slog"
+	"strconv"
 	"time"
+	"userService/internal/audit"
+	"userService/internal/config"
+	"userService/internal/events"
+	"userService/internal/logging"
+	"userService/internal/metrics"
+	"userService/internal/tenant"
+	"userService/internal/tracing"
 )
 
 type Data struct {
-	UserId int64  `json:"userId"`
-	Name   string `json:"name"`
+	UserId     int64    `json:"userId" bson:"userId"`
+	TenantId   string   `json:"tenantId" bson:"tenantId"`
+	Name       string   `json:"name" bson:"name"`
+	Email      string   `json:"email,omitempty" bson:"email,omitempty"`
+	ExternalId string   `json:"externalId,omitempty" bson:"externalId,omitempty"`
+	Disabled   bool     `json:"disabled,omitempty" bson:"disabled,omitempty"`
+	Roles      []string `json:"roles,omitempty" bson:"roles,omitempty"`
+	// Version starts at 1 and goes up with every write, for optimistic concurrency.
+	Version int64 `json:"version" bson:"version"`
+	// DeletedAt is set while the user is soft deleted and waiting to be purged.
+	DeletedAt *time.Time `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	// ErasedAt marks a tombstone left by an erasure; it holds no personal data and is never purged.
+	ErasedAt *time.Time `json:"erasedAt,omitempty" bson:"erasedAt,omitempty"`
+	// The blind indexes of encrypted fields; they are only set on stored documents.
+	NameIndex       string `json:"-" bson:"nameIndex,omitempty"`
+	EmailIndex      string `json:"-" bson:"emailIndex,omitempty"`
+	ExternalIdIndex string `json:"-" bson:"externalIdIndex,omitempty"`
 }
 
+// LogValue keeps personal fields such as name and email out of the logs.
+func (d Data) LogValue() slog.Value {
+	return slog.GroupValue(slog.Int64("userId", d.UserId), slog.String("tenantId", d.TenantId))
+}
+
+var database *mongo.Database
 var collection *mongo.Collection
+var identities *mongo.Collection
+var counters *mongo.Collection
+
+// operationTimeout caps every call in this package, even when the caller's context allows
+// longer, so a stuck database cannot hold a request indefinitely.
+var operationTimeout = 10 * time.Second
 
-func ConnectToMongo() {
-	url := "mongodb://localhost:27017"
-	clientOptions := options.Client().ApplyURI(url)
+const maxConnectBackoff = 10 * time.Second
 
-	client, err := mongo.Connect(context.TODO(), clientOptions)
+// ConnectToMongo retries until the database answers a ping or cfg.ConnectTimeout elapses, so
+// the service can start alongside a database that is still booting.
+func ConnectToMongo(ctx context.Context, cfg config.Mongo) error {
+	clientOptions, err := mongoOptions(cfg)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	err = client.Ping(context.TODO(), nil)
+	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	connectCtx, cancel := context.WithTimeout(ctx, cfg.ConnectTimeout)
+	defer cancel()
+
+	backoff := 500 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err = client.Ping(connectCtx, nil)
+		if err == nil {
+			break
+		}
+
+		slog.Warn("mongodb is not reachable", slog.Int("attempt", attempt), slog.Duration("retry_in", backoff), slog.Any("error", err))
+
+		select {
+		case <-connectCtx.Done():
+			_ = client.Disconnect(context.Background())
+			return fmt.Errorf("connect to mongodb: %w", err)
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, maxConnectBackoff)
+	}
+
+	slog.Info("connected to mongodb")
+	if cfg.OperationTimeout > 0 {
+		operationTimeout = cfg.OperationTimeout
+	}
+	database = client.Database("UserService")
+	collection = database.Collection("user")
+	identities = database.Collection("user.identities")
+	counters = database.Collection("user.counters")
+	tenant.UseDatabase(database)
+	audit.UseDatabase(database)
+	events.UseDatabase(database)
+
+	return nil
+}
+
+func mongoOptions(cfg config.Mongo) (*options.ClientOptions, error) {
+	clientOptions := options.Client().
+		ApplyURI(cfg.URL).
+		SetMaxPoolSize(cfg.MaxPoolSize).
+		SetMinPoolSize(cfg.MinPoolSize).
+		SetServerSelectionTimeout(cfg.ServerSelectionTimeout).
+		SetTimeout(cfg.OperationTimeout).
+		SetMonitor(tracing.CommandMonitor(metrics.CommandMonitor())).
+		SetPoolMonitor(metrics.PoolMonitor())
+
+	if cfg.ReadPreference != "" {
+		mode, err := readpref.ModeFromString(cfg.ReadPreference)
+		if err != nil {
+			return nil, err
+		}
+
+		preference, err := readpref.New(mode)
+		if err != nil {
+			return nil, err
+		}
+		clientOptions.SetReadPreference(preference)
+	}
+
+	switch cfg.WriteConcern {
+	case "":
+	case "majority":
+		clientOptions.SetWriteConcern(writeconcern.Majority())
+	default:
+		nodes, err := strconv.Atoi(cfg.WriteConcern)
+		if err != nil || nodes < 0 {
+			return nil, fmt.Errorf("invalid write concern %q", cfg.WriteConcern)
+		}
+		clientOptions.SetWriteConcern(&writeconcern.WriteConcern{W: nodes})
 	}
 
-	fmt.Println("Connected to MongoDB!")
-	collection = client.Database("UserService").Collection("user")
+	return clientOptions, clientOptions.Validate()
+}
+
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, operationTimeout)
 }
 
-func CreateUser(user Data) *mongo.InsertOneResult {
-	user.UserId = getNextUserID()
-	insertResult, err := collection.InsertOne(context.TODO(), user)
+func Ping(ctx context.Context) error {
+	if database == nil {
+		return errors.New("mongodb is not connected")
+	}
+
+	return database.Client().Ping(ctx, nil)
+}
+
+func Disconnect(ctx context.Context) error {
+	if database == nil {
+		return nil
+	}
+
+	return database.Client().Disconnect(ctx)
+}
+
+func Database() *mongo.Database {
+	return database
+}
+
+func CreateUser(ctx context.Context, user Data) (Data, *mongo.InsertOneResult, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	tenantId, ok := tenant.FromContext(ctx)
+	if !ok {
+		return Data{}, nil, tenant.ErrMissingTenant
+	}
+
+	userId, err := getNextUserID(ctx, tenantId)
 	if err != nil {
-		log.Fatal(err)
+		return Data{}, nil, err
 	}
-	fmt.Println("Inserted document with ID:", insertResult.InsertedID)
 
-	return insertResult
+	user.UserId = userId
+	user.TenantId = tenantId
+	user.DeletedAt, user.ErasedAt = nil, nil
+	user.Version = 1
+	insertResult, err := insert(ctx, user, nil)
+	if err != nil {
+		return Data{}, nil, err
+	}
+	metrics.UsersCreated.Inc()
+	logging.FromContext(ctx).Info("user created", slog.Any("user", user))
+	record(ctx, audit.Event{Action: audit.ActionCreate, UserId: user.UserId, Changes: diff(Data{}, user)})
+
+	return user, insertResult, nil
 }
 
-func GetUserByID(id int64) Data {
-	filter := map[string]interface{}{"userId": id}
+func InsertUser(ctx context.Context, user Data) (Data, error) {
+	return InsertUserWith(ctx, user, nil)
+}
 
-	result := Data{}
-	err := collection.FindOne(context.TODO(), filter).Decode(&result)
+// InsertUserWith inserts user like InsertUser and calls also with it in the same write, which is
+// a transaction when there is an outbox. When also fails, the user is not created.
+func InsertUserWith(ctx context.Context, user Data, also func(ctx context.Context, created Data) error) (Data, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
 
+	tenantId, ok := tenant.FromContext(ctx)
+	if !ok {
+		return Data{}, tenant.ErrMissingTenant
+	}
+
+	userId, err := getNextUserID(ctx, tenantId)
 	if err != nil {
-		log.Fatal(err)
-		return Data{}
+		return Data{}, err
 	}
 
-	fmt.Printf("Found document: %+v\n", result)
+	user.UserId = userId
+	user.TenantId = tenantId
+	user.DeletedAt, user.ErasedAt = nil, nil
+	user.Version = 1
+	if _, err := insert(ctx, user, also); err != nil {
+		return Data{}, err
+	}
+	metrics.UsersCreated.Inc()
+	record(ctx, audit.Event{Action: audit.ActionCreate, UserId: user.UserId, Changes: diff(Data{}, user)})
 
-	return result
+	return user, nil
 }
 
-func GetUsers() []Data {
+func insert(ctx context.Context, user Data, also func(ctx context.Context, created Data) error) (*mongo.InsertOneResult, error) {
+	stored, err := encrypt(ctx, user)
+	if err != nil {
+		return nil, err
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	var result *mongo.InsertOneResult
+	err = write(ctx, func(ctx context.Context) ([]events.Event, error) {
+		var err error
+		if result, err = collection.InsertOne(ctx, stored); err != nil {
+			return nil, err
+		}
+		if also != nil {
+			if err := also(ctx, user); err != nil {
+				if !events.Outbox {
+					// There is no transaction to abort.
+					_, _ = collection.DeleteOne(context.WithoutCancel(ctx), bson.M{"_id": result.InsertedID})
+				}
+				return nil, err
+			}
+		}
+
+		return []events.Event{userEvent(events.UserCreated, user)}, nil
+	})
+
+	return result, err
+}
+
+func GetUser(ctx context.Context, id int64) (Data, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter, err := scope(ctx, bson.M{"userId": id})
+	if err != nil {
+		return Data{}, err
+	}
+
+	result, err := cached(ctx, id, func(ctx context.Context) (Data, error) {
+		var stored Data
+		err := collection.FindOne(ctx, filter).Decode(&stored)
+		return stored, err
+	})
+	if err != nil {
+		return Data{}, err
+	}
+
+	return result, decrypt(ctx, &result)
+}
+
+func GetUserByEmail(ctx context.Context, email string) (Data, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter, err := scope(ctx, bson.M{"email": email})
+	if err != nil {
+		return Data{}, err
+	}
+
+	result := Data{}
+	if err := collection.FindOne(ctx, filter).Decode(&result); err != nil {
+		return Data{}, err
+	}
+
+	return result, decrypt(ctx, &result)
+}
+
+func GetUsers(ctx context.Context) ([]Data, error) {
+
+	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
 	var result []Data
 
-	cursor, err := collection.Find(context.TODO(), bson.M{})
+	filter, err := scope(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := collection.Find(ctx, filter)
 
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	defer cursor.Close(ctx)
 
 	if err := cursor.All(ctx, &result); err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	return result
+	return result, decryptAll(ctx, result)
 }
 
-func getNextUserID() int64 {
-	opts := options.FindOne().SetSort(bson.D{{Key: "userId", Value: -1}})
+func FindUsers(ctx context.Context, filter bson.M, skip, limit int64) ([]Data, int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
 
-	var lastUser Data
-	err := collection.FindOne(context.TODO(), bson.D{}, opts).Decode(&lastUser)
+	filter, err := scope(ctx, filter)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return 1
+		return nil, 0, err
+	}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "userId", Value: 1}}).SetSkip(skip)
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	result := []Data{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, 0, err
+	}
+
+	if err := decryptAll(ctx, result); err != nil {
+		return nil, 0, err
+	}
+
+	return result, total, nil
+}
+
+// StreamUsers calls fn for every user matching filter in id order, reading from the cursor
+// as it goes. It is not bound by the operation timeout, since exports can run far longer;
+// the caller's context limits it instead.
+func StreamUsers(ctx context.Context, filter bson.M, fn func(Data) error) error {
+	filter, err := scope(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "userId", Value: 1}}).SetBatchSize(500)
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(ctx) {
+		var current Data
+		if err := cursor.Decode(&current); err != nil {
+			return err
+		}
+		if err := decrypt(ctx, &current); err != nil {
+			return err
+		}
+		if err := fn(current); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+// CountUsers returns how many users match filter without reading them.
+func CountUsers(ctx context.Context, filter bson.M) (int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter, err := scope(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	return collection.CountDocuments(ctx, filter)
+}
+
+// UpdateUser writes the mutable fields of user and returns it as stored. When user.Version is
+// set, the update only applies to that version and fails with ErrVersionMismatch otherwise.
+func UpdateUser(ctx context.Context, user Data) (Data, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter, err := scope(ctx, bson.M{"userId": user.UserId})
+	if err != nil {
+		return Data{}, err
+	}
+
+	user.TenantId, _ = tenant.FromContext(ctx)
+	set := bson.M{"disabled": user.Disabled, "roles": user.Roles}
+	unset := bson.M{}
+	if err := encryptedUpdate(ctx, user, set, unset); err != nil {
+		return Data{}, err
+	}
+
+	update := bson.M{"$set": set, "$inc": nextVersion}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	var before, after Data
+	err = write(ctx, func(ctx context.Context) ([]events.Event, error) {
+		before = Data{}
+		if err := collection.FindOneAndUpdate(ctx, versioned(filter, user.Version), update).Decode(&before); err != nil {
+			return nil, err
 		}
-		log.Fatal(err)
+		if err := decrypt(ctx, &before); err != nil {
+			return nil, err
+		}
+
+		after = before
+		after.Name, after.Email, after.ExternalId = user.Name, user.Email, user.ExternalId
+		after.Disabled, after.Roles = user.Disabled, user.Roles
+		after.Version++
+
+		return []events.Event{userEvent(events.UserUpdated, after, changedFields(before, after)...)}, nil
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) && user.Version != 0 {
+		return Data{}, mismatch(ctx, filter)
+	}
+	if err != nil {
+		return Data{}, err
 	}
 
-	return lastUser.UserId + 1
+	if changes := diff(before, after); len(changes) > 0 {
+		record(ctx, audit.Event{Action: updateAction(changes), UserId: before.UserId, Changes: changes})
+	}
+
+	return after, nil
+}
+
+// DeleteUser soft deletes a user. It disappears from every lookup but keeps its identities
+// until the purger removes it, so it can still be restored. A non-zero version makes the delete
+// conditional, like in UpdateUser.
+func DeleteUser(ctx context.Context, id int64, version int64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	filter, err := tenant.Scope(ctx, bson.M{"userId": id, "deletedAt": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+
+	deletedAt := time.Now().UTC()
+	update := bson.M{"$set": bson.M{"deletedAt": deletedAt}, "$inc": nextVersion}
+	err = write(ctx, func(ctx context.Context) ([]events.Event, error) {
+		var deleted Data
+		if err := collection.FindOneAndUpdate(ctx, versioned(filter, version), update, returnVersion).Decode(&deleted); err != nil {
+			return nil, err
+		}
+
+		return []events.Event{userEvent(events.UserDeleted, deleted)}, nil
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) && version != 0 {
+		return mismatch(ctx, filter)
+	}
+	if err != nil {
+		return err
+	}
+	record(ctx, audit.Event{Action: audit.ActionDelete, UserId: id, Changes: map[string]audit.Change{"deletedAt": {After: deletedAt}}})
+
+	return nil
+}
+
+func getNextUserID(ctx context.Context, tenantId string) (int64, error) {
+	return reserveUserIds(ctx, tenantId, 1)
+}
+
+// reserveUserIds takes count consecutive ids from a per-tenant counter and returns the first.
+// The counter is seeded from the highest existing id the first time a tenant allocates one.
+func reserveUserIds(ctx context.Context, tenantId string, count int64) (int64, error) {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+
+	for {
+		err := counters.FindOneAndUpdate(ctx, bson.M{"_id": tenantId}, bson.M{"$inc": bson.M{"seq": count}}, opts).Decode(&counter)
+		if err == nil {
+			return counter.Seq - count + 1, nil
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return 0, err
+		}
+
+		var lastUser Data
+		findOpts := options.FindOne().SetSort(bson.D{{Key: "userId", Value: -1}})
+		err = collection.FindOne(ctx, bson.M{"tenantId": tenantId}, findOpts).Decode(&lastUser)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return 0, err
+		}
+
+		_, err = counters.InsertOne(ctx, bson.M{"_id": tenantId, "seq": lastUser.UserId + count})
+		if err == nil {
+			return lastUser.UserId + 1, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return 0, err
+		}
+	}
 }
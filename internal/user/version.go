@@ -0,0 +1,44 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrVersionMismatch is returned by a conditional write when the user exists but was changed
+// since the expected version was read.
+var ErrVersionMismatch = errors.New("user version does not match")
+
+// nextVersion is added to every update of a user document.
+var nextVersion = bson.M{"version": int64(1)}
+
+// returnVersion makes FindOneAndUpdate return just the identity and new version of a user.
+var returnVersion = options.FindOneAndUpdate().
+	SetReturnDocument(options.After).
+	SetProjection(bson.M{"userId": 1, "tenantId": 1, "version": 1})
+
+// versioned narrows filter to the expected version; zero matches any version.
+func versioned(filter bson.M, version int64) bson.M {
+	if version == 0 {
+		return filter
+	}
+
+	return bson.M{"$and": []bson.M{filter, {"version": version}}}
+}
+
+// mismatch tells why a conditional write matched nothing: ErrVersionMismatch when a user
+// still matches filter, mongo.ErrNoDocuments when none does.
+func mismatch(ctx context.Context, filter bson.M) error {
+	count, err := collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrVersionMismatch
+	}
+
+	return mongo.ErrNoDocuments
+}
@@ -0,0 +1,223 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+	"userService/internal/events"
+	"userService/internal/tenant"
+	"userService/internal/user"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	// StatusDead marks a delivery that failed MaxAttempts times; only a redeliver retries it.
+	StatusDead = "dead"
+
+	// maxLoggedAttempts bounds the attempt log kept on a delivery.
+	maxLoggedAttempts = 20
+)
+
+var ErrDeliveryNotFound = errors.New("delivery not found")
+
+// Attempt is one entry of the delivery log. StatusCode is zero when no response arrived.
+type Attempt struct {
+	At         time.Time `json:"at" bson:"at"`
+	StatusCode int       `json:"statusCode,omitempty" bson:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty" bson:"error,omitempty"`
+	DurationMs int64     `json:"durationMs" bson:"durationMs"`
+}
+
+// Delivery is one event on its way to one subscription.
+type Delivery struct {
+	Id             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TenantId       string             `json:"tenantId" bson:"tenantId"`
+	SubscriptionId primitive.ObjectID `json:"subscriptionId" bson:"subscriptionId"`
+	EventId        primitive.ObjectID `json:"eventId" bson:"eventId"`
+	EventType      string             `json:"eventType" bson:"eventType"`
+	UserId         int64              `json:"userId" bson:"userId"`
+	Payload        []byte             `json:"-" bson:"payload"`
+	Status         string             `json:"status" bson:"status"`
+	Attempts       int                `json:"attempts" bson:"attempts"`
+	NextAttemptAt  time.Time          `json:"nextAttemptAt" bson:"nextAttemptAt"`
+	Log            []Attempt          `json:"log" bson:"log"`
+	CreatedAt      time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+func deliveries() *mongo.Collection {
+	return user.Database().Collection("webhook.deliveries")
+}
+
+// Publisher is the events.EventPublisher that turns each event into a pending delivery for
+// every matching subscription of its tenant. The dispatcher sends them from there.
+type Publisher struct{}
+
+func (Publisher) Publish(ctx context.Context, event events.Event) error {
+	filter := bson.M{
+		"tenantId": event.TenantId,
+		"disabled": false,
+		"$or":      []bson.M{{"eventTypes": event.Type}, {"eventTypes": bson.M{"$size": 0}}},
+	}
+	cursor, err := subscriptions().Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+
+	var matched []Subscription
+	if err := cursor.All(ctx, &matched); err != nil {
+		return err
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	documents := make([]any, len(matched))
+	for i, subscription := range matched {
+		documents[i] = Delivery{
+			Id:             primitive.NewObjectID(),
+			TenantId:       event.TenantId,
+			SubscriptionId: subscription.Id,
+			EventId:        event.Id,
+			EventType:      event.Type,
+			UserId:         event.UserId,
+			Payload:        payload,
+			Status:         StatusPending,
+			NextAttemptAt:  now,
+			Log:            []Attempt{},
+			CreatedAt:      now,
+		}
+	}
+
+	// The relay may publish an event again; the unique subscriptionId_eventId index turns that
+	// into duplicate key errors, which are fine.
+	_, err = deliveries().InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, writeErr := range bulkErr.WriteErrors {
+			if !mongo.IsDuplicateKeyError(writeErr) {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return err
+}
+
+func (Publisher) Close() error {
+	return nil
+}
+
+// ListDeliveries returns the deliveries of a subscription, newest first, optionally only those
+// with the given status.
+func ListDeliveries(ctx context.Context, subscriptionId, status string, skip, limit int64) ([]Delivery, int64, error) {
+	subscription, err := GetSubscription(ctx, subscriptionId)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := bson.M{"subscriptionId": subscription.Id}
+	if status != "" {
+		query["status"] = status
+	}
+	filter, err := tenant.Scope(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := deliveries().CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetSkip(skip).SetProjection(bson.M{"payload": 0})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := deliveries().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	result := []Delivery{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, 0, err
+	}
+
+	return result, total, nil
+}
+
+func deliveryFilter(ctx context.Context, subscriptionId, deliveryId string) (bson.M, error) {
+	subscription, err := parseId(subscriptionId)
+	if err != nil {
+		return nil, err
+	}
+	delivery, err := primitive.ObjectIDFromHex(deliveryId)
+	if err != nil {
+		return nil, ErrDeliveryNotFound
+	}
+
+	return tenant.Scope(ctx, bson.M{"_id": delivery, "subscriptionId": subscription})
+}
+
+func GetDelivery(ctx context.Context, subscriptionId, deliveryId string) (Delivery, error) {
+	filter, err := deliveryFilter(ctx, subscriptionId, deliveryId)
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	var result Delivery
+	err = deliveries().FindOne(ctx, filter, options.FindOne().SetProjection(bson.M{"payload": 0})).Decode(&result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+
+	return result, err
+}
+
+// Redeliver queues a delivery to be sent again right away, whatever its status, with a fresh
+// set of attempts. Its log is kept.
+func Redeliver(ctx context.Context, subscriptionId, deliveryId string) (Delivery, error) {
+	filter, err := deliveryFilter(ctx, subscriptionId, deliveryId)
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	update := bson.M{"$set": bson.M{"status": StatusPending, "attempts": 0, "nextAttemptAt": time.Now().UTC()}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"payload": 0})
+
+	var result Delivery
+	err = deliveries().FindOneAndUpdate(ctx, filter, update, opts).Decode(&result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+
+	return result, err
+}
+
+// EraseUser removes the deliveries about a user, including those whose payloads were written
+// while events still carried user data.
+func EraseUser(ctx context.Context, userId int64) error {
+	filter, err := tenant.Scope(ctx, bson.M{"userId": userId})
+	if err != nil {
+		return err
+	}
+
+	_, err = deliveries().DeleteMany(ctx, filter)
+
+	return err
+}
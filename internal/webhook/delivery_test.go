@@ -0,0 +1,112 @@
+package webhook
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"userService/internal/events"
+	"userService/internal/testdb"
+)
+
+// deliverDue sends every delivery that is due, as one pass of the dispatcher does.
+func deliverDue(t *testing.T, ctx context.Context) {
+	t.Helper()
+
+	for {
+		sent, err := deliverNext(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sent {
+			return
+		}
+	}
+}
+
+func TestDeliveryDeadLetterAndRedeliver(t *testing.T) {
+	ctx := testdb.Tenant(t)
+	allowPrivateTargets(t)
+	previous := MaxAttempts
+	MaxAttempts = 2
+	t.Cleanup(func() { MaxAttempts = previous })
+
+	var healthy atomic.Bool
+	var received atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		received.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer receiver.Close()
+
+	subscription, err := CreateSubscription(ctx, Subscription{URL: receiver.URL, EventTypes: []string{events.UserCreated}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := events.Event{Id: primitive.NewObjectID(), Type: events.UserCreated, TenantId: subscription.TenantId, UserId: 7, Version: 1}
+	if err := (Publisher{}).Publish(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+	// Publishing again, as the relay may, does not queue a second delivery.
+	if err := (Publisher{}).Publish(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(status string) []Delivery {
+		t.Helper()
+		result, _, err := ListDeliveries(ctx, subscription.Id.Hex(), status, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	if pending := list(StatusPending); len(pending) != 1 {
+		t.Fatalf("%d pending deliveries, want 1", len(pending))
+	}
+	deliveryId := list("")[0].Id
+
+	deliverDue(t, ctx)
+	retry := list(StatusPending)
+	if len(retry) != 1 || retry[0].Attempts != 1 || time.Until(retry[0].NextAttemptAt) < retryBase-time.Second {
+		t.Fatalf("after one failure = %+v, want a retry after the backoff", retry)
+	}
+
+	// Make the retry due instead of waiting for the backoff.
+	if _, err := deliveries().UpdateByID(ctx, deliveryId, bson.M{"$set": bson.M{"nextAttemptAt": time.Now().UTC()}}); err != nil {
+		t.Fatal(err)
+	}
+	deliverDue(t, ctx)
+	dead := list(StatusDead)
+	if len(dead) != 1 || dead[0].Attempts != 2 || len(dead[0].Log) != 2 || dead[0].Log[1].StatusCode != http.StatusInternalServerError {
+		t.Fatalf("after the last attempt = %+v, want a dead delivery with two logged attempts", dead)
+	}
+
+	deliverDue(t, ctx)
+	if received.Load() != 2 {
+		t.Fatalf("receiver called %d times, want a dead delivery to stay dead", received.Load())
+	}
+
+	healthy.Store(true)
+	redelivered, err := Redeliver(ctx, subscription.Id.Hex(), deliveryId.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redelivered.Status != StatusPending || redelivered.Attempts != 0 {
+		t.Fatalf("Redeliver() = %+v", redelivered)
+	}
+	deliverDue(t, ctx)
+
+	delivered, err := GetDelivery(ctx, subscription.Id.Hex(), deliveryId.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivered.Status != StatusDelivered || delivered.Attempts != 1 || len(delivered.Log) != 3 {
+		t.Errorf("after redelivery = %+v, want delivered with the earlier attempts kept", delivered)
+	}
+}
@@ -0,0 +1,198 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	dispatchWorkers = 4
+	// claimTimeout is how long a claimed delivery stays with one worker before another replica
+	// may take it over.
+	claimTimeout = time.Minute
+	retryBase    = 30 * time.Second
+	retryMax     = 6 * time.Hour
+)
+
+// MaxAttempts is how often a delivery is tried before it is marked dead.
+var MaxAttempts = 8
+
+var client = &http.Client{
+	Timeout: 10 * time.Second,
+	// A redirect counts as a failure, so deliveries only go where the subscription says.
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+	// No proxy, so that the dialer sees the address of the receiver.
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 5 * time.Second, Control: dialControl}).DialContext,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+}
+
+// Sign returns the Webhook-Signature of a delivery: v1= followed by the hex HMAC-SHA256 of
+// "<Webhook-Id>.<Webhook-Timestamp>.<body>". Receivers should also reject old timestamps.
+func Sign(secret, id, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(body)
+
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff doubles the wait after every failed attempt, with some jitter so that deliveries that
+// failed together are not retried together.
+func backoff(attempts int) time.Duration {
+	wait := retryMax
+	if attempts < 20 {
+		wait = min(retryBase<<(attempts-1), retryMax)
+	}
+
+	return wait + rand.N(wait/10+1)
+}
+
+// RunDispatcher sends due deliveries every interval until ctx is done. Deliveries are claimed
+// one at a time, so any number of replicas can run it.
+func RunDispatcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var wg sync.WaitGroup
+		for range dispatchWorkers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					sent, err := deliverNext(ctx)
+					if err != nil && !errors.Is(err, context.Canceled) {
+						slog.Error("webhook delivery failed", slog.Any("error", err))
+					}
+					if !sent || err != nil {
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverNext claims the most overdue delivery, sends it and records the attempt. It reports
+// false when nothing is due.
+func deliverNext(ctx context.Context) (bool, error) {
+	now := time.Now().UTC()
+	filter := bson.M{"status": StatusPending, "nextAttemptAt": bson.M{"$lte": now}}
+	claim := bson.M{"$set": bson.M{"nextAttemptAt": now.Add(claimTimeout)}}
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}})
+
+	var delivery Delivery
+	err := deliveries().FindOneAndUpdate(ctx, filter, claim, opts).Decode(&delivery)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var subscription Subscription
+	err = subscriptions().FindOne(ctx, bson.M{"_id": delivery.SubscriptionId, "tenantId": delivery.TenantId}).Decode(&subscription)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		_, err = deliveries().DeleteOne(ctx, bson.M{"_id": delivery.Id})
+		return true, err
+	}
+	if err != nil {
+		return true, err
+	}
+
+	attempt := Attempt{At: now, Error: "webhook is disabled"}
+	if !subscription.Disabled {
+		attempt = send(ctx, subscription, delivery)
+	}
+
+	update := bson.M{
+		"$set":  settle(delivery.Attempts+1, attempt, subscription.Disabled),
+		"$push": bson.M{"log": bson.M{"$each": []Attempt{attempt}, "$slice": -maxLoggedAttempts}},
+	}
+	_, err = deliveries().UpdateByID(ctx, delivery.Id, update)
+
+	return true, err
+}
+
+// settle returns the fields to set on a delivery after its attempts-th attempt: it is delivered
+// on success, dead once MaxAttempts failed or the subscription is disabled, and retried after a
+// backoff otherwise.
+func settle(attempts int, attempt Attempt, disabled bool) bson.M {
+	set := bson.M{"attempts": attempts}
+	switch {
+	case attempt.Error == "":
+		set["status"] = StatusDelivered
+	case disabled || attempts >= MaxAttempts:
+		set["status"] = StatusDead
+	default:
+		set["nextAttemptAt"] = time.Now().UTC().Add(backoff(attempts))
+	}
+
+	return set
+}
+
+func send(ctx context.Context, subscription Subscription, delivery Delivery) Attempt {
+	started := time.Now().UTC()
+	attempt := Attempt{At: started}
+
+	id := delivery.Id.Hex()
+	timestamp := strconv.FormatInt(started.Unix(), 10)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "userService-webhooks")
+	request.Header.Set("Webhook-Id", id)
+	request.Header.Set("Webhook-Event", delivery.EventType)
+	request.Header.Set("Webhook-Timestamp", timestamp)
+	request.Header.Set("Webhook-Signature", Sign(subscription.Secret, id, timestamp, delivery.Payload))
+
+	response, err := client.Do(request)
+	attempt.DurationMs = time.Since(started).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	attempt.StatusCode = response.StatusCode
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("receiver answered %s", response.Status)
+	}
+
+	return attempt
+}
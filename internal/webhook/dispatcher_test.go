@@ -0,0 +1,185 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// allowPrivateTargets lets a test deliver to httptest receivers on the loopback address.
+func allowPrivateTargets(t *testing.T) {
+	t.Helper()
+
+	previous := AllowPrivateTargets
+	AllowPrivateTargets = true
+	t.Cleanup(func() { AllowPrivateTargets = previous })
+}
+
+func TestSign(t *testing.T) {
+	got := Sign("whsec_test", "delivery-1", "1700000000", []byte(`{"type":"user.created"}`))
+
+	if want := "v1=77b4a10388508ca37cba2c3012c8a2c9c520946864654137b71822498e24e794"; got != want {
+		t.Errorf("Sign() = %s, want %s", got, want)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		base     time.Duration
+	}{
+		{attempts: 1, base: 30 * time.Second},
+		{attempts: 2, base: time.Minute},
+		{attempts: 5, base: 8 * time.Minute},
+		{attempts: 10, base: 30 * time.Second << 9},
+		{attempts: 11, base: retryMax},
+		{attempts: 64, base: retryMax},
+	}
+	for _, test := range tests {
+		for range 20 {
+			wait := backoff(test.attempts)
+			if wait < test.base || wait > test.base+test.base/10 {
+				t.Errorf("backoff(%d) = %v, want %v plus at most 10%% jitter", test.attempts, wait, test.base)
+			}
+		}
+	}
+}
+
+func TestSettle(t *testing.T) {
+	previous := MaxAttempts
+	MaxAttempts = 3
+	t.Cleanup(func() { MaxAttempts = previous })
+
+	failed := Attempt{StatusCode: http.StatusInternalServerError, Error: "receiver answered 500"}
+	tests := []struct {
+		name     string
+		attempts int
+		attempt  Attempt
+		disabled bool
+		status   string
+		retry    bool
+	}{
+		{name: "delivered", attempts: 1, attempt: Attempt{StatusCode: http.StatusOK}, status: StatusDelivered},
+		{name: "delivered on the last attempt", attempts: 3, attempt: Attempt{StatusCode: http.StatusNoContent}, status: StatusDelivered},
+		{name: "retried", attempts: 1, attempt: failed, retry: true},
+		{name: "retried before the last attempt", attempts: 2, attempt: failed, retry: true},
+		{name: "dead after the last attempt", attempts: 3, attempt: failed, status: StatusDead},
+		{name: "dead when the webhook is disabled", attempts: 1, attempt: Attempt{Error: "webhook is disabled"}, disabled: true, status: StatusDead},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			set := settle(test.attempts, test.attempt, test.disabled)
+
+			if set["attempts"] != test.attempts {
+				t.Errorf("attempts = %v, want %d", set["attempts"], test.attempts)
+			}
+			if status, _ := set["status"].(string); status != test.status {
+				t.Errorf("status = %q, want %q", status, test.status)
+			}
+			next, retried := set["nextAttemptAt"].(time.Time)
+			if retried != test.retry {
+				t.Fatalf("retried = %v, want %v", retried, test.retry)
+			}
+			if retried && time.Until(next) < backoff(test.attempts)*10/11-time.Second {
+				t.Errorf("next attempt in %v, before the backoff", time.Until(next))
+			}
+		})
+	}
+}
+
+func TestSend(t *testing.T) {
+	allowPrivateTargets(t)
+
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan received, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		requests <- received{header: request.Header, body: body}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	subscription := Subscription{URL: receiver.URL + "/hooks", Secret: "whsec_test"}
+	delivery := Delivery{Id: primitive.NewObjectID(), EventType: "user.created", Payload: []byte(`{"type":"user.created","userId":7}`)}
+
+	attempt := send(context.Background(), subscription, delivery)
+	if attempt.Error != "" || attempt.StatusCode != http.StatusNoContent {
+		t.Fatalf("send() = %+v", attempt)
+	}
+
+	got := <-requests
+	if string(got.body) != string(delivery.Payload) {
+		t.Errorf("body = %s", got.body)
+	}
+	if got.header.Get("Webhook-Id") != delivery.Id.Hex() || got.header.Get("Webhook-Event") != "user.created" {
+		t.Errorf("headers = %v", got.header)
+	}
+	timestamp := got.header.Get("Webhook-Timestamp")
+	if seconds, err := strconv.ParseInt(timestamp, 10, 64); err != nil || time.Since(time.Unix(seconds, 0)) > time.Minute {
+		t.Errorf("Webhook-Timestamp = %q", timestamp)
+	}
+	// The receiver checks the signature the way the documentation tells it to.
+	if want := Sign("whsec_test", got.header.Get("Webhook-Id"), timestamp, got.body); got.header.Get("Webhook-Signature") != want {
+		t.Errorf("Webhook-Signature = %q, want %q", got.header.Get("Webhook-Signature"), want)
+	}
+}
+
+func TestSendFailures(t *testing.T) {
+	allowPrivateTargets(t)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	redirecting := httptest.NewServer(http.RedirectHandler(failing.URL, http.StatusFound))
+	defer redirecting.Close()
+
+	tests := []struct {
+		url        string
+		statusCode int
+	}{
+		{url: failing.URL, statusCode: http.StatusServiceUnavailable},
+		{url: redirecting.URL, statusCode: http.StatusFound},
+	}
+	for _, test := range tests {
+		attempt := send(context.Background(), Subscription{URL: test.url, Secret: "whsec_test"}, Delivery{Id: primitive.NewObjectID(), Payload: []byte(`{}`)})
+		if attempt.StatusCode != test.statusCode || attempt.Error == "" {
+			t.Errorf("send(%s) = %+v, want a failed attempt with status %d", test.url, attempt, test.statusCode)
+		}
+	}
+}
+
+func TestSendRefusesPrivateAddresses(t *testing.T) {
+	called := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		called = true
+	}))
+	defer receiver.Close()
+
+	attempt := send(context.Background(), Subscription{URL: receiver.URL, Secret: "whsec_test"}, Delivery{Id: primitive.NewObjectID(), Payload: []byte(`{}`)})
+	if attempt.Error == "" || called {
+		t.Fatalf("send() reached a loopback receiver: %+v", attempt)
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	for _, host := range []string{"127.0.0.1", "localhost", "10.1.2.3", "169.254.169.254", "::1", "fd00::1", "100.64.0.1", "0.0.0.0"} {
+		if err := checkHost(context.Background(), host); !errors.Is(err, ErrInvalid) {
+			t.Errorf("checkHost(%q) = %v, want ErrInvalid", host, err)
+		}
+	}
+	for _, host := range []string{"8.8.8.8", "2606:4700:4700::1111"} {
+		if err := checkHost(context.Background(), host); err != nil {
+			t.Errorf("checkHost(%q) = %v", host, err)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"net/url"
+	"slices"
+	"time"
+	"userService/internal/events"
+	"userService/internal/tenant"
+	"userService/internal/user"
+)
+
+var (
+	ErrNotFound = errors.New("webhook not found")
+	// ErrInvalid wraps validation errors of a subscription.
+	ErrInvalid = errors.New("invalid webhook")
+)
+
+// EventTypes are the events a subscription can ask for; an empty list means all of them.
+var EventTypes = []string{events.UserCreated, events.UserUpdated, events.UserDeleted}
+
+type Subscription struct {
+	Id         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TenantId   string             `json:"tenantId" bson:"tenantId"`
+	URL        string             `json:"url" bson:"url"`
+	EventTypes []string           `json:"eventTypes" bson:"eventTypes"`
+	// Secret signs the deliveries. It is only returned when the subscription is created or the
+	// secret is replaced.
+	Secret    string    `json:"secret,omitempty" bson:"secret"`
+	Disabled  bool      `json:"disabled" bson:"disabled"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+func subscriptions() *mongo.Collection {
+	return user.Database().Collection("webhook")
+}
+
+func (s *Subscription) validate(ctx context.Context) error {
+	target, err := url.Parse(s.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https url", ErrInvalid)
+	}
+	if err := checkHost(ctx, target.Hostname()); err != nil {
+		return err
+	}
+
+	if s.EventTypes == nil {
+		s.EventTypes = []string{}
+	}
+	for _, eventType := range s.EventTypes {
+		if !slices.Contains(EventTypes, eventType) {
+			return fmt.Errorf("%w: unknown event type %q", ErrInvalid, eventType)
+		}
+	}
+
+	return nil
+}
+
+func newSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// CreateSubscription stores a subscription for the tenant of ctx, generating a secret unless
+// one is given, and returns it with the secret.
+func CreateSubscription(ctx context.Context, subscription Subscription) (Subscription, error) {
+	tenantId, ok := tenant.FromContext(ctx)
+	if !ok {
+		return Subscription{}, tenant.ErrMissingTenant
+	}
+
+	if err := subscription.validate(ctx); err != nil {
+		return Subscription{}, err
+	}
+	if subscription.Secret == "" {
+		secret, err := newSecret()
+		if err != nil {
+			return Subscription{}, err
+		}
+		subscription.Secret = secret
+	}
+
+	now := time.Now().UTC()
+	subscription.Id, subscription.TenantId = primitive.NewObjectID(), tenantId
+	subscription.CreatedAt, subscription.UpdatedAt = now, now
+
+	if _, err := subscriptions().InsertOne(ctx, subscription); err != nil {
+		return Subscription{}, err
+	}
+
+	return subscription, nil
+}
+
+func parseId(id string) (primitive.ObjectID, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, ErrNotFound
+	}
+
+	return objectId, nil
+}
+
+func scopeId(ctx context.Context, id string) (bson.M, error) {
+	objectId, err := parseId(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return tenant.Scope(ctx, bson.M{"_id": objectId})
+}
+
+// GetSubscription returns a subscription without its secret.
+func GetSubscription(ctx context.Context, id string) (Subscription, error) {
+	filter, err := scopeId(ctx, id)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	var result Subscription
+	err = subscriptions().FindOne(ctx, filter).Decode(&result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Subscription{}, ErrNotFound
+	}
+	result.Secret = ""
+
+	return result, err
+}
+
+func ListSubscriptions(ctx context.Context, skip, limit int64) ([]Subscription, int64, error) {
+	filter, err := tenant.Scope(ctx, bson.M{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := subscriptions().CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetSkip(skip).SetProjection(bson.M{"secret": 0})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := subscriptions().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	result := []Subscription{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, 0, err
+	}
+
+	return result, total, nil
+}
+
+// UpdateSubscription replaces the url, event types and disabled flag. The secret is only
+// replaced when one is given, and is then returned.
+func UpdateSubscription(ctx context.Context, id string, changes Subscription) (Subscription, error) {
+	filter, err := scopeId(ctx, id)
+	if err != nil {
+		return Subscription{}, err
+	}
+	if err := changes.validate(ctx); err != nil {
+		return Subscription{}, err
+	}
+
+	set := bson.M{"url": changes.URL, "eventTypes": changes.EventTypes, "disabled": changes.Disabled, "updatedAt": time.Now().UTC()}
+	if changes.Secret != "" {
+		set["secret"] = changes.Secret
+	}
+
+	var result Subscription
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = subscriptions().FindOneAndUpdate(ctx, filter, bson.M{"$set": set}, opts).Decode(&result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Subscription{}, ErrNotFound
+	}
+	if changes.Secret == "" {
+		result.Secret = ""
+	}
+
+	return result, err
+}
+
+// DeleteSubscription removes a subscription along with its deliveries.
+func DeleteSubscription(ctx context.Context, id string) error {
+	objectId, err := parseId(id)
+	if err != nil {
+		return err
+	}
+
+	filter, err := tenant.Scope(ctx, bson.M{"_id": objectId})
+	if err != nil {
+		return err
+	}
+
+	result, err := subscriptions().DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	filter, err = tenant.Scope(ctx, bson.M{"subscriptionId": objectId})
+	if err != nil {
+		return err
+	}
+	_, err = deliveries().DeleteMany(ctx, filter)
+
+	return err
+}
@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+// AllowPrivateTargets lets subscriptions reach loopback, private and link-local addresses, for
+// receivers on a developer machine. Otherwise tenants could use webhooks to reach services
+// inside the network the service runs in.
+var AllowPrivateTargets bool
+
+var errPrivateTarget = errors.New("webhook target is not a public address")
+
+// blockedPrefixes are ranges that are not covered by the netip predicates but are not public
+// either: this network, shared address space, IETF protocol assignments, benchmarking,
+// reserved space and NAT64.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkHost resolves host and fails unless all of its addresses are public. The dialer checks
+// again, since the name may resolve differently when a delivery is made.
+func checkHost(ctx context.Context, host string) error {
+	if AllowPrivateTargets {
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("%w: url host cannot be resolved", ErrInvalid)
+	}
+	for _, addr := range addrs {
+		if !publicAddress(addr) {
+			return fmt.Errorf("%w: url must not point to a loopback, private or link-local address", ErrInvalid)
+		}
+	}
+
+	return nil
+}
+
+// dialControl refuses connections to addresses that are not public, whatever the url host
+// resolved to.
+func dialControl(_, address string, _ syscall.RawConn) error {
+	if AllowPrivateTargets {
+		return nil
+	}
+
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !publicAddress(addrPort.Addr()) {
+		return errPrivateTarget
+	}
+
+	return nil
+}
@@ -1,12 +1,164 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 	"userService/api/server"
+	"userService/internal/audit"
+	"userService/internal/cache"
+	"userService/internal/config"
+	"userService/internal/encryption"
+	"userService/internal/events"
+	"userService/internal/idempotency"
+	"userService/internal/logging"
+	"userService/internal/tenant"
+	"userService/internal/tracing"
 	"userService/internal/user"
+	"userService/internal/webhook"
 )
 
+const usage = `usage: userService <command> [arguments]
+
+commands:
+  serve                                  run the HTTP and gRPC servers (default)
+  migrate up [-to version]               apply pending migrations
+  migrate down [-steps n]                revert applied migrations
+  migrate status                         list migrations and when they were applied
+  seed [-count n] [-tenant id]           insert generated users
+  user create -name n [-email e] [-roles a,b] [-tenant id]
+  user get [-tenant id] [-include-deleted] <userId>
+  user list [-tenant id] [-offset n] [-limit n] [-include-deleted]
+  user delete [-tenant id] <userId>      soft delete, purged after DELETED_RETENTION
+  user restore [-tenant id] <userId>     undo a soft delete
+  export [-tenant id] [-out file] [-format csv|ndjson|parquet] [-fields a,b] [-gzip]
+         [-disabled true|false] [-role r] [-email e] [-name n]
+                                         write users, NDJSON by default
+  import [-tenant id] [-in file] [-format csv|ndjson] [-dry-run] [-report]
+                                         create users from CSV or NDJSON
+  reencrypt                              encrypt plain fields and move users to the current key
+`
+
+type command func(ctx context.Context, cfg *config.Config, args []string) error
+
+var commands = map[string]command{
+	"serve":     serve,
+	"migrate":   runMigrate,
+	"seed":      runSeed,
+	"user":      runUser,
+	"export":    runExport,
+	"import":    runImport,
+	"reencrypt": runReencrypt,
+}
+
 func main() {
-	user.ConnectToMongo()
-	server.StartServer()
-	server.StartRpc()
+	cfg := config.Load()
+
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+
+	run, ok := commands[name]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	// Only the server logs to stdout; commands keep it free for their output.
+	logOutput := os.Stderr
+	if name == "serve" {
+		logOutput = os.Stdout
+	}
+	slog.SetDefault(logging.New(logOutput, logging.ParseLevel(cfg.LogLevel), cfg.LogFormat))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := run(ctx, cfg, args)
+	stop()
+
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		slog.Error("exiting", slog.Any("error", err))
+		os.Exit(1)
+	}
+}
+
+func serve(ctx context.Context, cfg *config.Config, _ []string) error {
+	shutdownTracing, err := tracing.Setup(ctx, cfg.TraceExporter)
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing(context.Background())
+
+	return withDatabase(ctx, cfg, func() error {
+		if cfg.MigrateOnStart {
+			if _, err := migrationRunner(cfg).Up(ctx, 0); err != nil {
+				return err
+			}
+		}
+
+		if cfg.DefaultTenant != "" {
+			if err := tenant.EnsureTenant(ctx, cfg.DefaultTenant, cfg.DefaultTenant); err != nil {
+				return err
+			}
+		}
+
+		return server.Run(ctx, cfg)
+	})
+}
+
+func withDatabase(ctx context.Context, cfg *config.Config, fn func() error) error {
+	if err := user.ConnectToMongo(ctx, cfg.Mongo); err != nil {
+		return err
+	}
+	audit.HashChain = cfg.AuditHashChain
+	idempotency.TTL = cfg.IdempotencyTTL
+	events.Outbox = cfg.Events.Publisher != "" || cfg.Webhooks.Enabled
+	webhook.MaxAttempts = cfg.Webhooks.MaxAttempts
+	webhook.AllowPrivateTargets = cfg.Webhooks.AllowPrivateTargets
+
+	if cfg.Encryption.Keyring != "" {
+		keyring, err := encryption.LoadKeyring(cfg.Encryption.Keyring)
+		if err != nil {
+			return err
+		}
+		if err := user.UseEncryption(encryption.NewCipher(keyring), cfg.Encryption.Fields); err != nil {
+			return err
+		}
+	}
+	if cfg.Cache.Backend != "" {
+		userCache, err := cache.New(cfg.Cache)
+		if err != nil {
+			return err
+		}
+		defer userCache.Close()
+		user.UseCache(userCache, cfg.Cache.TTL, cfg.Cache.NegativeTTL)
+	}
+	defer user.Disconnect(context.Background())
+
+	return fn()
+}
+
+// tenantContext scopes a command to a tenant, which must exist, falling back to the default
+// tenant.
+func tenantContext(ctx context.Context, cfg *config.Config, tenantId string) (context.Context, error) {
+	if tenantId == "" {
+		tenantId = cfg.DefaultTenant
+	}
+	if tenantId == "" {
+		return nil, errors.New("a tenant is required")
+	}
+
+	if _, err := tenant.GetTenant(ctx, tenantId); err != nil {
+		return nil, fmt.Errorf("tenant %q: %w", tenantId, err)
+	}
+
+	return audit.WithActor(tenant.WithTenant(ctx, tenantId), "cli"), nil
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+	"userService/internal/config"
+	"userService/internal/migration"
+	"userService/internal/user"
+)
+
+func migrationRunner(cfg *config.Config) *migration.Runner {
+	return migration.NewRunner(migration.Env{Database: user.Database(), DefaultTenant: cfg.DefaultTenant})
+}
+
+// runMigrate implements "migrate up [-to version]", "migrate down [-steps n]" and
+// "migrate status".
+func runMigrate(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate up|down|status")
+	}
+
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ContinueOnError)
+	to := flags.Int("to", 0, "apply migrations up to this version, all when zero")
+	steps := flags.Int("steps", 1, "number of migrations to revert")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	return withDatabase(ctx, cfg, func() error {
+		return migrate(ctx, migrationRunner(cfg), args[0], *to, *steps)
+	})
+}
+
+func migrate(ctx context.Context, runner *migration.Runner, action string, to, steps int) error {
+	switch action {
+	case "up":
+		applied, err := runner.Up(ctx, to)
+		for _, m := range applied {
+			fmt.Printf("applied %d %s\n", m.Version, m.Description)
+		}
+
+		return err
+	case "down":
+		reverted, err := runner.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %d %s\n", m.Version, m.Description)
+		}
+
+		return err
+	case "status":
+		states, err := runner.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tAPPLIED\tDESCRIPTION")
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != nil {
+				applied = state.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", state.Version, applied, state.Description)
+		}
+
+		return w.Flush()
+	}
+
+	return fmt.Errorf("unknown migrate command %q", action)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"userService/internal/config"
+	"userService/internal/user"
+)
+
+// runReencrypt is the key rotation job: after a new current key is added to the keyring, it
+// moves every user to it so the old key can be retired. It also encrypts values written before
+// a field was configured for encryption, and decrypts fields that no longer are.
+func runReencrypt(ctx context.Context, cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("reencrypt", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if cfg.Encryption.Keyring == "" {
+		return errors.New("ENCRYPTION_KEYRING is not set")
+	}
+
+	return withDatabase(ctx, cfg, func() error {
+		rotated, err := user.RotateEncryption(ctx)
+		if err != nil {
+			return err
+		}
+		slog.Info("re-encryption finished", slog.Int64("users", rotated))
+
+		return nil
+	})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"userService/internal/config"
+	"userService/internal/user"
+)
+
+var (
+	firstNames = []string{"Alex", "Maria", "Ivan", "Olga", "Sam", "Nina", "Dmitry", "Elena", "Chris", "Anna", "Pavel", "Irina"}
+	lastNames  = []string{"Smirnov", "Ivanova", "Petrov", "Kuznetsova", "Miller", "Garcia", "Novak", "Sokolova", "Brown", "Volkov"}
+)
+
+func runSeed(ctx context.Context, cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	count := flags.Int("count", 10, "number of users to create")
+	tenantId := flags.String("tenant", "", "tenant to seed, the default tenant when empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	return withDatabase(ctx, cfg, func() error {
+		ctx, err := tenantContext(ctx, cfg, *tenantId)
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < *count; i++ {
+			created, err := user.InsertUser(ctx, fakeUser())
+			if err != nil {
+				return fmt.Errorf("seeded %d of %d users: %w", i, *count, err)
+			}
+			fmt.Printf("created %d %s\n", created.UserId, created.Email)
+		}
+
+		return nil
+	})
+}
+
+func fakeUser() user.Data {
+	first := firstNames[rand.IntN(len(firstNames))]
+	last := lastNames[rand.IntN(len(lastNames))]
+
+	return user.Data{
+		Name:  first + " " + last,
+		Email: fmt.Sprintf("%s.%s.%06d@example.test", strings.ToLower(first), strings.ToLower(last), rand.IntN(1000000)),
+		Roles: []string{"member"},
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"userService/internal/config"
+	"userService/internal/exporter"
+	"userService/internal/importer"
+)
+
+func runExport(ctx context.Context, cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	tenantId := flags.String("tenant", "", "tenant to export, the default tenant when empty")
+	out := flags.String("out", "", "output file, stdout when empty")
+	format := flags.String("format", "", "csv, ndjson or parquet, taken from the file extension when empty")
+	fields := flags.String("fields", "", "comma separated fields to export, all when empty")
+	compress := flags.Bool("gzip", false, "gzip the output, also implied by a .gz file extension")
+	disabled := flags.String("disabled", "", "only export disabled (true) or enabled (false) users")
+	role := flags.String("role", "", "only export users with this role")
+	email := flags.String("email", "", "only export users whose email contains this text")
+	name := flags.String("name", "", "only export users whose name contains this text")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	opts := exporter.Options{
+		Format: *format,
+		Gzip:   *compress || strings.EqualFold(filepath.Ext(*out), ".gz"),
+		Filter: exporter.Filter{Role: *role, Email: *email, Name: *name},
+	}
+	if opts.Format == "" {
+		opts.Format = exportFormat(*out)
+	}
+
+	var err error
+	if opts.Fields, err = exporter.ParseFields(*fields); err != nil {
+		return err
+	}
+	if *disabled != "" {
+		value, err := strconv.ParseBool(*disabled)
+		if err != nil {
+			return errors.New("-disabled must be true or false")
+		}
+		opts.Filter.Disabled = &value
+	}
+
+	return withDatabase(ctx, cfg, func() error {
+		ctx, err := tenantContext(ctx, cfg, *tenantId)
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer = os.Stdout
+		if *out != "" {
+			file, err := os.Create(*out)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			w = file
+		}
+
+		exported, err := exporter.Export(ctx, w, opts)
+		if err != nil {
+			return err
+		}
+		slog.Info("export finished", slog.Int("users", exported))
+
+		return nil
+	})
+}
+
+// exportFormat picks the format from the extension of the output file, ignoring a trailing .gz.
+func exportFormat(path string) string {
+	path = strings.TrimSuffix(strings.ToLower(path), ".gz")
+
+	switch filepath.Ext(path) {
+	case ".csv":
+		return exporter.FormatCSV
+	case ".parquet":
+		return exporter.FormatParquet
+	}
+
+	return exporter.FormatNDJSON
+}
+
+// runImport creates users from CSV or NDJSON through the same importer as the HTTP endpoint.
+// Users get new ids in the target tenant, so an export can be imported into another tenant.
+func runImport(ctx context.Context, cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	tenantId := flags.String("tenant", "", "tenant to import into, the default tenant when empty")
+	in := flags.String("in", "", "input file, stdin when empty")
+	format := flags.String("format", "", "csv or ndjson, taken from the file extension when empty")
+	dryRun := flags.Bool("dry-run", false, "validate without creating users")
+	report := flags.Bool("report", false, "print the per-row report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *format == "" {
+		*format = importer.FormatNDJSON
+		if strings.EqualFold(filepath.Ext(*in), ".csv") {
+			*format = importer.FormatCSV
+		}
+	}
+
+	return withDatabase(ctx, cfg, func() error {
+		ctx, err := tenantContext(ctx, cfg, *tenantId)
+		if err != nil {
+			return err
+		}
+
+		var r io.Reader = os.Stdin
+		if *in != "" {
+			file, err := os.Open(*in)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			r = file
+		}
+
+		result, err := importer.Import(ctx, r, importer.Options{Format: *format, DryRun: *dryRun})
+		if *report {
+			if err := printJSON(result); err != nil {
+				return err
+			}
+		} else {
+			for _, row := range result.Rows {
+				if row.Status != importer.StatusCreated {
+					fmt.Fprintf(os.Stderr, "line %d: %s: %s\n", row.Line, row.Status, row.Error)
+				}
+			}
+		}
+		if err != nil && result.StoppedAtLine > 0 {
+			return fmt.Errorf("import stopped at line %d: %w", result.StoppedAtLine, err)
+		}
+		if err != nil {
+			return err
+		}
+
+		verb := "created"
+		if *dryRun {
+			verb = "would create"
+		}
+		fmt.Fprintf(os.Stderr, "%s %d users, %d skipped, %d failed\n", verb, result.Created, result.Skipped, result.Failed)
+
+		return nil
+	})
+}
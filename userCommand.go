@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"os"
+	"strconv"
+	"strings"
+	"userService/internal/config"
+	"userService/internal/user"
+)
+
+func runUser(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: user create|get|list|delete|restore")
+	}
+
+	var name, email, roles string
+	var offset, limit int64
+	var withDeleted bool
+
+	flags := flag.NewFlagSet("user "+args[0], flag.ContinueOnError)
+	tenantId := flags.String("tenant", "", "tenant of the user, the default tenant when empty")
+	switch args[0] {
+	case "create":
+		flags.StringVar(&name, "name", "", "name of the new user")
+		flags.StringVar(&email, "email", "", "email of the new user")
+		flags.StringVar(&roles, "roles", "", "comma separated roles of the new user")
+	case "get":
+		flags.BoolVar(&withDeleted, "include-deleted", false, "also find a soft deleted user")
+	case "list":
+		flags.Int64Var(&offset, "offset", 0, "users to skip")
+		flags.Int64Var(&limit, "limit", 50, "maximum users to list")
+		flags.BoolVar(&withDeleted, "include-deleted", false, "also list soft deleted users")
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	return withDatabase(ctx, cfg, func() error {
+		ctx, err := tenantContext(ctx, cfg, *tenantId)
+		if err != nil {
+			return err
+		}
+		if withDeleted {
+			ctx = user.WithDeleted(ctx)
+		}
+
+		switch args[0] {
+		case "create":
+			if strings.TrimSpace(name) == "" {
+				return errors.New("-name is required")
+			}
+
+			data := user.Data{Name: name, Email: strings.ToLower(email)}
+			for _, role := range strings.Split(roles, ",") {
+				if role = strings.TrimSpace(role); role != "" {
+					data.Roles = append(data.Roles, role)
+				}
+			}
+
+			created, err := user.InsertUser(ctx, data)
+			if err != nil {
+				return err
+			}
+
+			return printJSON(created)
+		case "get":
+			id, err := userIdArg(flags)
+			if err != nil {
+				return err
+			}
+
+			found, err := user.GetUser(ctx, id)
+			if err != nil {
+				return err
+			}
+
+			return printJSON(found)
+		case "list":
+			users, total, err := user.FindUsers(ctx, bson.M{}, offset, limit)
+			if err != nil {
+				return err
+			}
+
+			return printJSON(map[string]any{"items": users, "total": total})
+		case "delete":
+			id, err := userIdArg(flags)
+			if err != nil {
+				return err
+			}
+
+			if err := user.DeleteUser(ctx, id, 0); err != nil {
+				return err
+			}
+			fmt.Printf("deleted %d\n", id)
+
+			return nil
+		case "restore":
+			id, err := userIdArg(flags)
+			if err != nil {
+				return err
+			}
+
+			restored, err := user.RestoreUser(ctx, id)
+			if err != nil {
+				return err
+			}
+
+			return printJSON(restored)
+		}
+
+		return fmt.Errorf("unknown user command %q", args[0])
+	})
+}
+
+func userIdArg(flags *flag.FlagSet) (int64, error) {
+	if flags.NArg() != 1 {
+		return 0, errors.New("exactly one user id is required")
+	}
+
+	id, err := strconv.ParseInt(flags.Arg(0), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user id %q", flags.Arg(0))
+	}
+
+	return id, nil
+}
+
+func printJSON(value any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(value)
+}